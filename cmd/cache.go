@@ -0,0 +1,251 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/rickcrawford/markdowninthemiddle/internal/cache"
+	"github.com/rickcrawford/markdowninthemiddle/internal/config"
+)
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Inspect and purge the disk cache",
+	Long: `Inspect and purge the response cache. The cache directory is taken from
+the config file (cache.dir) unless --cache-dir is given.`,
+}
+
+var cacheListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List cached entries",
+	Args:  cobra.NoArgs,
+	RunE:  runCacheList,
+}
+
+var cacheShowCmd = &cobra.Command{
+	Use:   "show <url>",
+	Short: "Show the cached entries for a URL",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runCacheShow,
+}
+
+var cachePurgeCmd = &cobra.Command{
+	Use:   "purge",
+	Short: "Remove cached entries",
+	Long:  `Removes the entries matching all of the given filters. At least one of --url, --host, --expired or --all is required.`,
+	Args:  cobra.NoArgs,
+	RunE:  runCachePurge,
+}
+
+var cacheStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Summarize the cache",
+	Args:  cobra.NoArgs,
+	RunE:  runCacheStats,
+}
+
+func init() {
+	cacheCmd.PersistentFlags().String("cache-dir", "", "cache directory (overrides config)")
+	cachePurgeCmd.Flags().String("url", "", "remove entries for this URL")
+	cachePurgeCmd.Flags().String("host", "", "remove entries for this host")
+	cachePurgeCmd.Flags().Bool("expired", false, "remove expired entries")
+	cachePurgeCmd.Flags().Bool("all", false, "remove every entry")
+
+	cacheCmd.AddCommand(cacheListCmd, cacheShowCmd, cachePurgeCmd, cacheStatsCmd)
+	rootCmd.AddCommand(cacheCmd)
+}
+
+// openCache opens the configured cache directory without creating it.
+func openCache(cmd *cobra.Command) (*cache.DiskCache, error) {
+	dir, _ := cmd.Flags().GetString("cache-dir")
+	if dir == "" {
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading config: %w", err)
+		}
+		dir = cfg.Cache.Dir
+	}
+	if dir == "" {
+		return nil, fmt.Errorf("no cache directory configured (set cache.dir or --cache-dir)")
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("opening cache: %w", err)
+	}
+	return cache.New(dir)
+}
+
+func runCacheList(cmd *cobra.Command, args []string) error {
+	dc, err := openCache(cmd)
+	if err != nil {
+		return err
+	}
+	infos, err := dc.Entries()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "URL\tKIND\tSIZE\tHITS\tEXPIRES")
+	for i := range infos {
+		info := &infos[i]
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n",
+			displayURL(info), info.Kind, formatBytes(info.Size), info.Hits, formatExpiry(info.ExpiresAt))
+	}
+	return w.Flush()
+}
+
+func runCacheShow(cmd *cobra.Command, args []string) error {
+	dc, err := openCache(cmd)
+	if err != nil {
+		return err
+	}
+	infos, err := dc.Find(args[0])
+	if err != nil {
+		return err
+	}
+	if len(infos) == 0 {
+		return fmt.Errorf("no cached entries for %s", args[0])
+	}
+
+	out := cmd.OutOrStdout()
+	for i := range infos {
+		info := &infos[i]
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "Key:\t%s\n", info.Key)
+		fmt.Fprintf(w, "URL:\t%s\n", info.URL)
+		fmt.Fprintf(w, "Kind:\t%s\n", info.Kind)
+		if info.Variant != "" {
+			fmt.Fprintf(w, "Variant:\t%s\n", strings.ReplaceAll(info.Variant, "\n", "; "))
+		}
+		fmt.Fprintf(w, "Status:\t%d\n", info.StatusCode)
+		if info.ContentType != "" {
+			fmt.Fprintf(w, "Content-Type:\t%s\n", info.ContentType)
+		}
+		if info.ETag != "" {
+			fmt.Fprintf(w, "ETag:\t%s\n", info.ETag)
+		}
+		if info.LastModified != "" {
+			fmt.Fprintf(w, "Last-Modified:\t%s\n", info.LastModified)
+		}
+		if info.CacheControl != "" {
+			fmt.Fprintf(w, "Cache-Control:\t%s\n", info.CacheControl)
+		}
+		if info.Vary != "" {
+			fmt.Fprintf(w, "Vary:\t%s\n", info.Vary)
+		}
+		if info.TokenCount != nil {
+			fmt.Fprintf(w, "Tokens:\t%d\n", *info.TokenCount)
+		}
+		fmt.Fprintf(w, "Size:\t%s\n", formatBytes(info.Size))
+		fmt.Fprintf(w, "Hits:\t%d\n", info.Hits)
+		fmt.Fprintf(w, "Fetched:\t%s\n", formatTime(info.FetchedAt))
+		fmt.Fprintf(w, "Expires:\t%s (%s)\n", formatTime(info.ExpiresAt), formatExpiry(info.ExpiresAt))
+		fmt.Fprintf(w, "Last access:\t%s\n", formatTime(info.LastAccess))
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runCachePurge(cmd *cobra.Command, args []string) error {
+	rawURL, _ := cmd.Flags().GetString("url")
+	host, _ := cmd.Flags().GetString("host")
+	expired, _ := cmd.Flags().GetBool("expired")
+	all, _ := cmd.Flags().GetBool("all")
+	if rawURL == "" && host == "" && !expired && !all {
+		return fmt.Errorf("purge requires --url, --host, --expired or --all")
+	}
+
+	dc, err := openCache(cmd)
+	if err != nil {
+		return err
+	}
+	removed, freed, err := dc.Purge(func(info *cache.Info) bool {
+		if rawURL != "" && info.URL != rawURL {
+			return false
+		}
+		if host != "" && !strings.EqualFold(info.Host(), host) {
+			return false
+		}
+		if expired && info.Fresh() {
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "removed %d entries (%s)\n", removed, formatBytes(freed))
+	return nil
+}
+
+func runCacheStats(cmd *cobra.Command, args []string) error {
+	dc, err := openCache(cmd)
+	if err != nil {
+		return err
+	}
+	stats, err := dc.Stats()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Entries:\t%d (%d html, %d markdown)\n", stats.Entries, stats.HTML, stats.Markdown)
+	fmt.Fprintf(w, "Expired:\t%d\n", stats.Expired)
+	fmt.Fprintf(w, "Size:\t%s\n", formatBytes(stats.Bytes))
+	fmt.Fprintf(w, "Hits:\t%d\n", stats.Hits)
+	if stats.Entries > 0 {
+		fmt.Fprintf(w, "Oldest fetch:\t%s\n", formatTime(stats.Oldest))
+		fmt.Fprintf(w, "Newest fetch:\t%s\n", formatTime(stats.Newest))
+	}
+	return w.Flush()
+}
+
+// displayURL returns the entry's URL, or a placeholder for entries written
+// before URLs were recorded.
+func displayURL(info *cache.Info) string {
+	if info.URL == "" {
+		return "(unknown " + info.Key[:12] + ")"
+	}
+	return info.URL
+}
+
+// formatBytes renders n with a binary unit suffix.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// formatTime renders t in local time, or "-" when unset.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format(time.RFC3339)
+}
+
+// formatExpiry describes t relative to now.
+func formatExpiry(t time.Time) string {
+	d := time.Until(t).Round(time.Second)
+	if d <= 0 {
+		return "expired " + (-d).String() + " ago"
+	}
+	return "in " + d.String()
+}
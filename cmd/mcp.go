@@ -20,6 +20,7 @@ import (
 	"github.com/rickcrawford/markdowninthemiddle/internal/config"
 	mcpserver "github.com/rickcrawford/markdowninthemiddle/internal/mcp"
 	"github.com/rickcrawford/markdowninthemiddle/internal/output"
+	"github.com/rickcrawford/markdowninthemiddle/internal/rules"
 	"github.com/rickcrawford/markdowninthemiddle/internal/templates"
 	"github.com/rickcrawford/markdowninthemiddle/internal/tokens"
 )
@@ -43,6 +44,7 @@ func init() {
 	mcpCmd.Flags().Int("chrome-pool-size", 0, "max concurrent Chrome tabs (default: 5)")
 	mcpCmd.Flags().Bool("tls-insecure", false, "skip TLS certificate verification for upstream requests")
 	mcpCmd.Flags().String("template-dir", "", "directory containing .mustache template files for JSON conversion")
+	mcpCmd.Flags().String("rules-dir", "", "directory containing per-site CSS selector rules for HTML conversion")
 	mcpCmd.Flags().Bool("convert-json", false, "enable JSON-to-Markdown conversion via Mustache templates")
 }
 
@@ -100,6 +102,9 @@ func runMCP(cmd *cobra.Command, args []string) error {
 	if v, _ := cmd.Flags().GetBool("convert-json"); v {
 		cfg.Conversion.ConvertJSON = true
 	}
+	if v, _ := cmd.Flags().GetString("rules-dir"); v != "" {
+		cfg.Conversion.RulesDir = v
+	}
 
 	// Load templates if configured
 	var templateStore *templates.Store
@@ -111,6 +116,21 @@ func runMCP(cmd *cobra.Command, args []string) error {
 		log.Printf("Mustache templates loaded from: %s", cfg.Conversion.TemplateDir)
 	}
 
+	// Load selector rules if configured
+	var ruleStore *rules.Store
+	if cfg.Conversion.RulesDir != "" {
+		ruleStore, err = rules.New(cfg.Conversion.RulesDir)
+		if err != nil {
+			return fmt.Errorf("loading rules: %w", err)
+		}
+		log.Printf("Loaded %d selector rule(s) from: %s", ruleStore.Len(), cfg.Conversion.RulesDir)
+	}
+
+	markdownOpts, err := markdownOptions(cfg)
+	if err != nil {
+		return err
+	}
+
 	// Token counter
 	tokenCounter, err := tokens.NewCounter(cfg.Conversion.TiktokenEncoding)
 	if err != nil {
@@ -159,10 +179,16 @@ func runMCP(cmd *cobra.Command, args []string) error {
 
 	// Create MCP server
 	mcpServer := mcpserver.New(mcpserver.Deps{
-		HTTPClient:    httpClient,
-		TokenCounter:  tokenCounter,
-		OutputWriter:  outputWriter,
-		TemplateStore: templateStore,
+		HTTPClient:        httpClient,
+		TokenCounter:      tokenCounter,
+		OutputWriter:      outputWriter,
+		TemplateStore:     templateStore,
+		RuleStore:         ruleStore,
+		Markdown:          markdownOpts,
+		MaxFeedEntries:    cfg.Conversion.MaxFeedEntries,
+		OutputFrontMatter: cfg.Output.FrontMatter,
+		StructuredData:    cfg.Conversion.StructuredData,
+		Compact:           cfg.Conversion.Compact,
 	})
 
 	// Setup graceful shutdown
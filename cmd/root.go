@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -18,10 +19,12 @@ import (
 	"github.com/rickcrawford/markdowninthemiddle/internal/cache"
 	"github.com/rickcrawford/markdowninthemiddle/internal/certs"
 	"github.com/rickcrawford/markdowninthemiddle/internal/config"
+	"github.com/rickcrawford/markdowninthemiddle/internal/converter"
 	"github.com/rickcrawford/markdowninthemiddle/internal/filter"
 	"github.com/rickcrawford/markdowninthemiddle/internal/mitm"
 	"github.com/rickcrawford/markdowninthemiddle/internal/output"
 	"github.com/rickcrawford/markdowninthemiddle/internal/proxy"
+	"github.com/rickcrawford/markdowninthemiddle/internal/rules"
 	"github.com/rickcrawford/markdowninthemiddle/internal/templates"
 	"github.com/rickcrawford/markdowninthemiddle/internal/tokens"
 )
@@ -52,8 +55,11 @@ func init() {
 	rootCmd.Flags().Bool("negotiate-only", false, "only convert when client sends Accept: text/markdown")
 	rootCmd.Flags().Bool("convert-json", false, "enable JSON-to-Markdown conversion via Mustache templates")
 	rootCmd.Flags().String("template-dir", "", "directory containing .mustache template files for JSON conversion")
+	rootCmd.Flags().String("rules-dir", "", "directory containing per-site CSS selector rules for HTML conversion")
+	rootCmd.Flags().String("extract", "", "part of HTML pages to convert: full or article (overrides config)")
 	rootCmd.Flags().String("transport", "", "transport type: http (standard reverse proxy) or chromedp (headless Chrome rendering)")
 	rootCmd.Flags().StringSlice("allow", []string{}, "regex patterns for allowed URLs (repeatable)")
+	rootCmd.Flags().Bool("offline", false, "answer only from the cache, never contacting upstream servers")
 }
 
 // Execute runs the root command.
@@ -104,12 +110,21 @@ func run(cmd *cobra.Command, args []string) error {
 	if v, _ := cmd.Flags().GetString("template-dir"); v != "" {
 		cfg.Conversion.TemplateDir = v
 	}
+	if v, _ := cmd.Flags().GetString("rules-dir"); v != "" {
+		cfg.Conversion.RulesDir = v
+	}
+	if v, _ := cmd.Flags().GetString("extract"); v != "" {
+		cfg.Conversion.Extract = v
+	}
 	if v, _ := cmd.Flags().GetString("transport"); v != "" {
 		cfg.Transport.Type = v
 	}
 	if v, _ := cmd.Flags().GetStringSlice("allow"); len(v) > 0 {
 		cfg.Filter.Allowed = v
 	}
+	if v, _ := cmd.Flags().GetBool("offline"); v {
+		cfg.Cache.Offline = true
+	}
 
 	// Auto-enable MITM if TLS is enabled (no need for separate flag)
 	if cfg.TLS.Enabled {
@@ -125,11 +140,24 @@ func run(cmd *cobra.Command, args []string) error {
 	// Cache.
 	var diskCache *cache.DiskCache
 	if cfg.Cache.Enabled && cfg.Cache.Dir != "" {
-		diskCache, err = cache.New(cfg.Cache.Dir)
+		diskCache, err = cache.NewWithOptions(cfg.Cache.Dir, cache.Options{
+			MaxBytes:          cfg.Cache.MaxBytes,
+			MaxEntries:        cfg.Cache.MaxEntries,
+			IgnoreHeaders:     !cfg.Cache.RespectHeaders,
+			ServeStaleOnError: cfg.Cache.ServeStaleOnError,
+			StaleRetention:    cfg.Cache.StaleRetention,
+		})
 		if err != nil {
 			return fmt.Errorf("initializing cache: %w", err)
 		}
-		log.Printf("HTML cache enabled: %s", cfg.Cache.Dir)
+		log.Printf("HTML cache enabled: %s (max bytes: %d, max entries: %d, sweep: %s)",
+			cfg.Cache.Dir, cfg.Cache.MaxBytes, cfg.Cache.MaxEntries, cfg.Cache.SweepInterval)
+	}
+	if cfg.Cache.Offline {
+		if diskCache == nil {
+			return fmt.Errorf("offline mode requires the cache (set cache.dir or --cache-dir)")
+		}
+		log.Println("Offline mode: answering from cache only")
 	}
 
 	// TLS config for the proxy listener.
@@ -197,6 +225,27 @@ func run(cmd *cobra.Command, args []string) error {
 		log.Println("JSON-to-Markdown conversion enabled")
 	}
 
+	// Selector rules for HTML conversion.
+	var ruleStore *rules.Store
+	if cfg.Conversion.RulesDir != "" {
+		ruleStore, err = rules.New(cfg.Conversion.RulesDir)
+		if err != nil {
+			return fmt.Errorf("loading rules: %w", err)
+		}
+		log.Printf("Loaded %d selector rule(s) from: %s", ruleStore.Len(), cfg.Conversion.RulesDir)
+	}
+
+	if !converter.ValidExtract(cfg.Conversion.Extract) {
+		return fmt.Errorf("invalid conversion.extract %q (want full or article)", cfg.Conversion.Extract)
+	}
+	if cfg.Conversion.Extract == converter.ExtractArticle {
+		log.Println("Article extraction enabled (clients can send X-Extract: full)")
+	}
+	markdownOpts, err := markdownOptions(cfg)
+	if err != nil {
+		return err
+	}
+
 	if cfg.TLS.Insecure {
 		log.Println("WARNING: TLS certificate verification disabled for upstream requests")
 	}
@@ -235,10 +284,12 @@ func run(cmd *cobra.Command, args []string) error {
 	}
 
 	// Initialize browser pool if chromedp transport is configured
-	ctx := context.Background()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	var chromePool http.RoundTripper
 
-	if cfg.Transport.Type == "chromedp" {
+	// Offline mode never contacts upstream, so Chrome is not needed.
+	if cfg.Transport.Type == "chromedp" && !cfg.Cache.Offline {
 		log.Println("chromedp transport enabled. Connecting to Chrome...")
 		chromeURL := cfg.Transport.Chromedp.URL
 		if chromeURL == "" {
@@ -264,27 +315,43 @@ func run(cmd *cobra.Command, args []string) error {
 	}
 
 	opts := proxy.Options{
-		Addr:         cfg.Proxy.Addr,
-		ReadTimeout:  cfg.Proxy.ReadTimeout,
-		WriteTimeout: cfg.Proxy.WriteTimeout,
-		TLSConfig:    tlsCfg,
-		ConvertHTML:   cfg.Conversion.Enabled,
-		ConvertJSON:   cfg.Conversion.ConvertJSON,
-		NegotiateOnly: cfg.Conversion.NegotiateOnly,
-		MaxBodySize:   cfg.MaxBodySize,
-		TLSInsecure:  cfg.TLS.Insecure,
-		TokenCounter: tokenCounter,
-		Cache:         diskCache,
-		OutputWriter:  outputWriter,
-		TemplateStore: templateStore,
-		Filter:        reqFilter,
-		Transport:     chromePool,
-		TransportType: transportType,
-		MITM:          mitmMgr,
+		Addr:              cfg.Proxy.Addr,
+		ReadTimeout:       cfg.Proxy.ReadTimeout,
+		WriteTimeout:      cfg.Proxy.WriteTimeout,
+		TLSConfig:         tlsCfg,
+		ConvertHTML:       cfg.Conversion.Enabled,
+		ConvertJSON:       cfg.Conversion.ConvertJSON,
+		NegotiateOnly:     cfg.Conversion.NegotiateOnly,
+		Extract:           cfg.Conversion.Extract,
+		Markdown:          markdownOpts,
+		MaxFeedEntries:    cfg.Conversion.MaxFeedEntries,
+		MaxBodySize:       cfg.MaxBodySize,
+		TLSInsecure:       cfg.TLS.Insecure,
+		TokenCounter:      tokenCounter,
+		Cache:             diskCache,
+		OutputWriter:      outputWriter,
+		TemplateStore:     templateStore,
+		RuleStore:         ruleStore,
+		FrontMatter:       cfg.Conversion.FrontMatter,
+		OutputFrontMatter: cfg.Output.FrontMatter,
+		StructuredData:    cfg.Conversion.StructuredData,
+		Compact:           cfg.Conversion.Compact,
+		Filter:            reqFilter,
+		Transport:         chromePool,
+		TransportType:     transportType,
+		MITM:              mitmMgr,
+		Offline:           cfg.Cache.Offline,
+		Coalesce:          cfg.Proxy.CoalesceRequests,
 	}
 
 	srv := proxy.New(opts)
 
+	// Background janitor removes expired cache entries and enforces limits.
+	// Offline runs keep every recorded entry, expired or not.
+	if !cfg.Cache.Offline {
+		go diskCache.RunJanitor(ctx, cfg.Cache.SweepInterval)
+	}
+
 	// Schedule cleanup of browser pool on shutdown
 	var browserPoolCleanup func()
 	if chromePool != nil {
@@ -324,3 +391,19 @@ func run(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// markdownOptions returns the validated Markdown style from
+// conversion.markdown.
+func markdownOptions(cfg *config.Config) (converter.MarkdownOptions, error) {
+	m := converter.MarkdownOptions{
+		HeadingStyle: strings.ToLower(cfg.Conversion.Markdown.HeadingStyle),
+		LinkStyle:    strings.ToLower(cfg.Conversion.Markdown.LinkStyle),
+		Bullet:       cfg.Conversion.Markdown.Bullet,
+		DropImages:   cfg.Conversion.Markdown.DropImages,
+		RawTables:    cfg.Conversion.Markdown.RawTables,
+	}
+	if err := m.Validate(); err != nil {
+		return m, fmt.Errorf("conversion.markdown: %w", err)
+	}
+	return m, nil
+}
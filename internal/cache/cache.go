@@ -2,61 +2,123 @@ package cache
 
 import (
 	"crypto/sha256"
+	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/rickcrawford/markdowninthemiddle/internal/fsutil"
 )
 
 // Entry represents a cached response.
 type Entry struct {
-	Body      []byte
-	ExpiresAt time.Time
+	Body []byte
+	Metadata
+}
+
+// Markdown is a converted document kept in the Markdown cache layer.
+type Markdown struct {
+	Text string
+	// Tokens is the token count of Text, or -1 if it was not counted.
+	Tokens int
+	Metadata
 }
 
-// DiskCache stores HTML response bodies on disk, keyed by request URL.
-// It respects RFC 7234 Cache-Control and Expires headers.
+// DiskCache stores HTML response bodies on disk, keyed by request URL, and
+// the Markdown converted from them (<sha>.md), keyed by URL and conversion
+// settings. It respects RFC 7234 Cache-Control and Expires headers.
 type DiskCache struct {
-	dir string
+	dir  string
+	opts Options
+}
+
+// Options configures a DiskCache. Size limits of zero mean unlimited; they
+// are enforced by Sweep, which evicts least recently used entries.
+type Options struct {
+	// IgnoreHeaders disables Cache-Control handling: every 2xx response is
+	// stored for a fixed lifetime and client directives are ignored.
+	IgnoreHeaders bool
+	// MaxBytes caps the total size of cached bodies and metadata.
+	MaxBytes int64
+	// MaxEntries caps the number of cached entries.
+	MaxEntries int
+	// ServeStaleOnError allows expired entries to be served when the origin
+	// is unreachable or answers with a 5xx, even without stale-if-error.
+	ServeStaleOnError bool
+	// StaleRetention is how long Sweep keeps entries after they expire, so
+	// they can still be revalidated or served stale.
+	StaleRetention time.Duration
 }
 
 // New creates a new DiskCache writing to the given directory.
 // Returns nil if dir is empty.
 func New(dir string) (*DiskCache, error) {
+	return NewWithOptions(dir, Options{})
+}
+
+// NewWithOptions creates a new DiskCache with size limits.
+// Returns nil if dir is empty.
+func NewWithOptions(dir string, opts Options) (*DiskCache, error) {
 	if dir == "" {
 		return nil, nil
 	}
-	if err := os.MkdirAll(dir, 0o755); err != nil {
+	if err := os.MkdirAll(filepath.Join(dir, lockDir), 0o755); err != nil {
 		return nil, fmt.Errorf("creating cache dir: %w", err)
 	}
-	return &DiskCache{dir: dir}, nil
+	return &DiskCache{dir: dir, opts: opts}, nil
 }
 
-// IsCacheable checks RFC 7234 headers to determine if a response may be cached.
+// lockDir is the subdirectory of the cache dir holding the lock files.
+const lockDir = ".locks"
+
+// defaultTTL is the heuristic freshness lifetime for responses that carry
+// validators but no explicit expiry, and for every response when cache
+// headers are ignored.
+const defaultTTL = 5 * time.Minute
+
+// IsCacheable checks RFC 9111 headers to determine if a response may be
+// stored by a shared cache.
 func IsCacheable(resp *http.Response) bool {
-	// Don't cache non-success responses.
-	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+	// Don't cache non-success responses. Redirects are left out too: the
+	// metadata does not keep the Location a replayed redirect would need.
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		return false
 	}
 
-	cc := resp.Header.Get("Cache-Control")
-	ccLower := strings.ToLower(cc)
+	cc := ParseCacheControl(resp.Header.Values("Cache-Control")...)
 
 	// Explicit no-store directive: must not cache.
-	if strings.Contains(ccLower, "no-store") {
+	if cc.Has("no-store") {
 		return false
 	}
 	// Private responses should not be stored in shared caches.
-	if strings.Contains(ccLower, "private") {
+	if cc.Has("private") {
 		return false
 	}
+	// Vary: * can never be matched by a later request.
+	if VaryAll(resp.Header) {
+		return false
+	}
+
+	hasValidators := resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != ""
+
+	// no-cache responses may be stored, but every use must be revalidated,
+	// which is only possible with validators.
+	if cc.Has("no-cache") {
+		return hasValidators
+	}
 
-	// If max-age or s-maxage is present, it's cacheable.
-	if strings.Contains(ccLower, "max-age") || strings.Contains(ccLower, "s-maxage") {
-		return true
+	// An explicit lifetime makes the response cacheable; a zero lifetime is
+	// only useful when the response can be revalidated.
+	for _, name := range []string{"s-maxage", "max-age"} {
+		if d, ok := cc.Duration(name); ok {
+			return d > 0 || hasValidators
+		}
 	}
 
 	// If Expires header is present and in the future, it's cacheable.
@@ -68,55 +130,44 @@ func IsCacheable(resp *http.Response) bool {
 	}
 
 	// If there's an ETag or Last-Modified, consider it cacheable for validation.
-	if resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != "" {
-		return true
-	}
-
-	return false
+	return hasValidators
 }
 
-// TTL computes how long a response should be cached based on RFC cache headers.
+// TTL computes how long a response stays fresh based on RFC 9111 headers.
+// A zero TTL means the response must be revalidated before every use.
 func TTL(resp *http.Response) time.Duration {
-	cc := resp.Header.Get("Cache-Control")
-	ccLower := strings.ToLower(cc)
+	cc := ParseCacheControl(resp.Header.Values("Cache-Control")...)
 
-	// Check s-maxage first (takes priority for shared caches).
-	if idx := strings.Index(ccLower, "s-maxage="); idx >= 0 {
-		if d := parseMaxAge(cc[idx+9:]); d > 0 {
-			return d
-		}
+	if cc.Has("no-cache") {
+		return 0
 	}
 
-	// Then max-age.
-	if idx := strings.Index(ccLower, "max-age="); idx >= 0 {
-		if d := parseMaxAge(cc[idx+8:]); d > 0 {
-			return d
+	// Check s-maxage first (takes priority for shared caches), then max-age.
+	// Both are relative to when the origin generated the response, so time
+	// already spent in other caches (the Age header) is subtracted.
+	for _, name := range []string{"s-maxage", "max-age"} {
+		if d, ok := cc.Duration(name); ok {
+			return max(d-age(resp), 0)
 		}
 	}
 
-	// Fall back to Expires header.
+	// Fall back to Expires header. An invalid or past date means stale.
 	if exp := resp.Header.Get("Expires"); exp != "" {
 		t, err := http.ParseTime(exp)
-		if err == nil {
-			ttl := time.Until(t)
-			if ttl > 0 {
-				return ttl
-			}
+		if err != nil {
+			return 0
 		}
+		return max(time.Until(t), 0)
 	}
 
 	// Default TTL for responses with ETag/Last-Modified but no explicit expiry.
-	return 5 * time.Minute
+	return defaultTTL
 }
 
-func parseMaxAge(s string) time.Duration {
-	// Extract the numeric portion, stopping at comma or space.
-	end := strings.IndexAny(s, ", ")
-	if end == -1 {
-		end = len(s)
-	}
-	secs, err := strconv.Atoi(strings.TrimSpace(s[:end]))
-	if err != nil || secs <= 0 {
+// age returns the value of the response's Age header.
+func age(resp *http.Response) time.Duration {
+	secs, err := strconv.Atoi(resp.Header.Get("Age"))
+	if err != nil || secs < 0 {
 		return 0
 	}
 	return time.Duration(secs) * time.Second
@@ -130,46 +181,240 @@ func keyFor(rawURL string) string {
 
 // Get returns cached body bytes if a valid cache entry exists and hasn't expired.
 func (c *DiskCache) Get(rawURL string) ([]byte, bool) {
+	entry, ok := c.Lookup(rawURL)
+	if !ok {
+		return nil, false
+	}
+	if !entry.Fresh() {
+		// Expired — clean up.
+		c.remove(keyFor(rawURL))
+		return nil, false
+	}
+	return entry.Body, true
+}
+
+// Lookup returns the cache entry for rawURL whether or not it has expired,
+// so callers can revalidate stale entries instead of refetching them.
+// rawURL may also be a key from RequestKey.
+func (c *DiskCache) Lookup(rawURL string) (*Entry, bool) {
 	if c == nil {
 		return nil, false
 	}
-	key := keyFor(rawURL)
-	metaPath := filepath.Join(c.dir, key+".meta")
-	bodyPath := filepath.Join(c.dir, key+".html")
+	return c.lookup(keyFor(rawURL), ".html")
+}
 
-	metaBytes, err := os.ReadFile(metaPath)
+// lookup reads the entry for key and records the access: the hit count
+// and last-access time are updated, and legacy meta files are rewritten as
+// JSON. The rewrite is not synced to disk, as losing an access costs
+// little. ext is the body file extension.
+func (c *DiskCache) lookup(key, ext string) (*Entry, bool) {
+	lock, err := c.lock(key)
 	if err != nil {
+		log.Printf("cache lock error: %v", err)
 		return nil, false
 	}
-	expiry, err := time.Parse(time.RFC3339, strings.TrimSpace(string(metaBytes)))
-	if err != nil || time.Now().After(expiry) {
-		// Expired — clean up.
-		os.Remove(metaPath)
-		os.Remove(bodyPath)
+	defer lock.Unlock()
+
+	entry, ok := c.read(key, ext)
+	if !ok {
 		return nil, false
 	}
+	entry.Hits++
+	entry.LastAccess = time.Now().UTC()
 
-	body, err := os.ReadFile(bodyPath)
+	// Rewriting the meta file also bumps its modification time, which
+	// orders entries for LRU eviction.
+	if err := c.writeMetaFile(key, &entry.Metadata, fsutil.ReplaceFile); err != nil {
+		log.Printf("cache meta update error: %v", err)
+	}
+	return entry, true
+}
+
+// peek reads the entry for key without recording an access.
+func (c *DiskCache) peek(key, ext string) (*Entry, bool) {
+	lock, err := c.lock(key)
 	if err != nil {
+		log.Printf("cache lock error: %v", err)
 		return nil, false
 	}
-	return body, true
+	defer lock.Unlock()
+
+	return c.read(key, ext)
+}
+
+// read reads the meta and body files for key without recording an access.
+// The caller must hold the lock for key.
+func (c *DiskCache) read(key, ext string) (*Entry, bool) {
+	metaBytes, err := os.ReadFile(filepath.Join(c.dir, key+".meta"))
+	if err != nil {
+		return nil, false
+	}
+	meta, _, err := parseMeta(metaBytes)
+	if err != nil {
+		return nil, false
+	}
+
+	body, err := os.ReadFile(filepath.Join(c.dir, key+ext))
+	if err != nil {
+		return nil, false
+	}
+	return &Entry{Body: body, Metadata: *meta}, true
 }
 
 // Put stores response body bytes with an expiration.
 func (c *DiskCache) Put(rawURL string, body []byte, ttl time.Duration) error {
+	return c.Store(rawURL, nil, body, ttl)
+}
+
+// Store writes body together with the status and headers of resp needed to
+// rebuild and revalidate the response later. A nil resp records a plain 200.
+// Responses that vary on request headers are stored under the key from
+// VariantKey rather than the bare URL.
+func (c *DiskCache) Store(rawURL string, resp *http.Response, body []byte, ttl time.Duration) error {
 	if c == nil {
 		return nil
 	}
-	key := keyFor(rawURL)
-	bodyPath := filepath.Join(c.dir, key+".html")
-	metaPath := filepath.Join(c.dir, key+".meta")
+	meta := newMetadata(resp, ttl)
+	meta.setKey(rawURL)
+	return c.store(keyFor(rawURL), ".html", meta, body)
+}
 
-	if err := os.WriteFile(bodyPath, body, 0o644); err != nil {
+// store writes the body file (with extension ext) and meta file for key.
+// The meta file is removed first and written last, so an interrupted write
+// leaves no meta file and the entry is simply missing, never mismatched.
+func (c *DiskCache) store(key, ext string, meta *Metadata, body []byte) error {
+	lock, err := c.lock(key)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	if err := os.Remove(filepath.Join(c.dir, key+".meta")); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("invalidating cache meta: %w", err)
+	}
+	bodyPath := filepath.Join(c.dir, key+ext)
+	if err := fsutil.WriteFileAtomic(bodyPath, body, 0o644); err != nil {
 		return fmt.Errorf("writing cache body: %w", err)
 	}
-	expiry := time.Now().Add(ttl).Format(time.RFC3339)
-	if err := os.WriteFile(metaPath, []byte(expiry), 0o644); err != nil {
+	return c.writeMeta(key, meta)
+}
+
+// lock takes the lock guarding the files of key against other goroutines
+// and processes sharing the cache directory. Keys share 256 lock files,
+// selected by their first two hex digits.
+func (c *DiskCache) lock(key string) (*fsutil.FileLock, error) {
+	return fsutil.Lock(filepath.Join(c.dir, lockDir, key[:2]+".lock"))
+}
+
+// MarkdownKey builds the key for a converted document from the request URL
+// (or its variant key) and every setting that changes the conversion output.
+func MarkdownKey(rawURL string, settings ...string) string {
+	return rawURL + "\n" + strings.Join(settings, "\n")
+}
+
+// GetMarkdown returns the converted document stored under key (see
+// MarkdownKey) if it exists and hasn't expired.
+func (c *DiskCache) GetMarkdown(key string) (*Markdown, bool) {
+	if c == nil {
+		return nil, false
+	}
+	return markdownEntry(c.lookup(keyFor(key), ".md"))
+}
+
+// PeekMarkdown is GetMarkdown without recording an access, for reading a
+// document alongside the one that answers a request.
+func (c *DiskCache) PeekMarkdown(key string) (*Markdown, bool) {
+	if c == nil {
+		return nil, false
+	}
+	return markdownEntry(c.peek(keyFor(key), ".md"))
+}
+
+// markdownEntry returns the converted document in entry, if ok and fresh.
+func markdownEntry(entry *Entry, ok bool) (*Markdown, bool) {
+	if !ok || !entry.Fresh() {
+		return nil, false
+	}
+	tokens := -1
+	if entry.TokenCount != nil {
+		tokens = *entry.TokenCount
+	}
+	return &Markdown{
+		Text:     string(entry.Body),
+		Tokens:   tokens,
+		Metadata: entry.Metadata,
+	}, true
+}
+
+// PutMarkdown stores a converted document, its token count and the JSON
+// structured data of its page under key. Pass a negative tokens value when
+// the document was not counted, and nil structured data when none was
+// extracted.
+func (c *DiskCache) PutMarkdown(key, markdown string, tokens int, structured []byte, ttl time.Duration) error {
+	if c == nil {
+		return nil
+	}
+	meta := newMetadata(nil, ttl)
+	meta.setKey(key)
+	meta.ContentType = "text/markdown; charset=utf-8"
+	if tokens >= 0 {
+		meta.TokenCount = &tokens
+	}
+	meta.StructuredData = structured
+	return c.store(keyFor(key), ".md", meta, []byte(markdown))
+}
+
+// Refresh extends the expiry of an existing entry after a successful
+// revalidation (a 304 Not Modified) and returns the refreshed entry.
+// Validators present in header replace the stored ones, as required for
+// 304 responses.
+func (c *DiskCache) Refresh(rawURL string, header http.Header, ttl time.Duration) (*Entry, error) {
+	if c == nil {
+		return nil, fmt.Errorf("refreshing cache entry: no cache")
+	}
+	key := keyFor(rawURL)
+	lock, err := c.lock(key)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+
+	entry, ok := c.read(key, ".html")
+	if !ok {
+		return nil, fmt.Errorf("refreshing cache entry: no entry for %s", rawURL)
+	}
+	if v := header.Get("ETag"); v != "" {
+		entry.ETag = v
+	}
+	if v := header.Get("Last-Modified"); v != "" {
+		entry.LastModified = v
+	}
+	entry.setKey(rawURL)
+	entry.Hits++
+	entry.FetchedAt = time.Now().UTC()
+	entry.LastAccess = entry.FetchedAt
+	entry.ExpiresAt = entry.FetchedAt.Add(ttl)
+	if err := c.writeMeta(key, &entry.Metadata); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// writeMeta atomically and durably writes the JSON .meta file for key. The
+// caller must hold the lock for key.
+func (c *DiskCache) writeMeta(key string, meta *Metadata) error {
+	return c.writeMetaFile(key, meta, fsutil.WriteFileAtomic)
+}
+
+// writeMetaFile writes the JSON .meta file for key with write. The caller
+// must hold the lock for key.
+func (c *DiskCache) writeMetaFile(key string, meta *Metadata, write func(string, []byte, os.FileMode) error) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding cache meta: %w", err)
+	}
+	metaPath := filepath.Join(c.dir, key+".meta")
+	if err := write(metaPath, data, 0o644); err != nil {
 		return fmt.Errorf("writing cache meta: %w", err)
 	}
 	return nil
@@ -1,9 +1,14 @@
 package cache
 
 import (
+	"bytes"
+	"encoding/json"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -114,6 +119,206 @@ func TestDiskCache_NilSafe(t *testing.T) {
 	}
 }
 
+// htmlResponse returns a 200 text/html response carrying header.
+func htmlResponse(header http.Header) *http.Response {
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", "text/html")
+	}
+	return &http.Response{StatusCode: http.StatusOK, Header: header}
+}
+
+func TestDiskCache_StoreLookup(t *testing.T) {
+	c, err := New(t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	url := "http://example.com/validators"
+	header := http.Header{}
+	header.Set("Content-Type", "text/html; charset=utf-8")
+	header.Set("ETag", `"v1"`)
+	header.Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+	header.Set("Vary", "Accept-Language")
+
+	if err := c.Store(url, htmlResponse(header), []byte("<p>hi</p>"), time.Hour); err != nil {
+		t.Fatalf("Store error: %v", err)
+	}
+
+	entry, ok := c.Lookup(url)
+	if !ok {
+		t.Fatal("expected cache entry")
+	}
+	if !entry.Fresh() {
+		t.Error("expected fresh entry")
+	}
+	if entry.StatusCode != http.StatusOK {
+		t.Errorf("StatusCode = %d, want 200", entry.StatusCode)
+	}
+	if entry.ETag != `"v1"` {
+		t.Errorf("ETag = %q, want %q", entry.ETag, `"v1"`)
+	}
+	if entry.ContentType != "text/html; charset=utf-8" {
+		t.Errorf("ContentType = %q", entry.ContentType)
+	}
+	if entry.LastModified != "Mon, 02 Jan 2006 15:04:05 GMT" {
+		t.Errorf("LastModified = %q", entry.LastModified)
+	}
+	if entry.Vary != "Accept-Language" {
+		t.Errorf("Vary = %q", entry.Vary)
+	}
+	if entry.FetchedAt.IsZero() {
+		t.Error("expected FetchedAt to be set")
+	}
+}
+
+func TestDiskCache_LookupStale(t *testing.T) {
+	dir := t.TempDir()
+	c, _ := New(dir)
+
+	url := "http://example.com/stale"
+	header := http.Header{}
+	header.Set("ETag", `"old"`)
+	if err := c.Store(url, htmlResponse(header), []byte("<p>old</p>"), -time.Minute); err != nil {
+		t.Fatalf("Store error: %v", err)
+	}
+
+	entry, ok := c.Lookup(url)
+	if !ok {
+		t.Fatal("expected stale entry to be returned by Lookup")
+	}
+	if entry.Fresh() {
+		t.Error("expected stale entry")
+	}
+	if string(entry.Body) != "<p>old</p>" {
+		t.Errorf("body = %q", entry.Body)
+	}
+}
+
+func TestDiskCache_Refresh(t *testing.T) {
+	c, _ := New(t.TempDir())
+
+	url := "http://example.com/refresh"
+	header := http.Header{}
+	header.Set("ETag", `"old"`)
+	c.Store(url, htmlResponse(header), []byte("<p>body</p>"), -time.Minute)
+
+	update := http.Header{}
+	update.Set("ETag", `"new"`)
+	if _, err := c.Refresh(url, update, time.Hour); err != nil {
+		t.Fatalf("Refresh error: %v", err)
+	}
+
+	entry, ok := c.Lookup(url)
+	if !ok {
+		t.Fatal("expected entry after refresh")
+	}
+	if !entry.Fresh() {
+		t.Error("expected entry to be fresh after refresh")
+	}
+	if entry.ETag != `"new"` {
+		t.Errorf("ETag = %q, want %q", entry.ETag, `"new"`)
+	}
+	if entry.ContentType != "text/html" {
+		t.Errorf("ContentType = %q, want text/html", entry.ContentType)
+	}
+
+	if _, err := c.Refresh("http://example.com/missing", update, time.Hour); err == nil {
+		t.Error("expected error refreshing a missing entry")
+	}
+}
+
+func TestDiskCache_Markdown(t *testing.T) {
+	c, _ := New(t.TempDir())
+
+	key := MarkdownKey("http://example.com/page", "html", "", "1")
+	if _, ok := c.GetMarkdown(key); ok {
+		t.Fatal("expected markdown miss before Put")
+	}
+	if err := c.PutMarkdown(key, "# Page", 3, []byte(`{"jsonld":[{"sku":"A1"}]}`), time.Hour); err != nil {
+		t.Fatalf("PutMarkdown error: %v", err)
+	}
+
+	md, ok := c.GetMarkdown(key)
+	if !ok {
+		t.Fatal("expected markdown hit")
+	}
+	if md.Text != "# Page" {
+		t.Errorf("Text = %q, want %q", md.Text, "# Page")
+	}
+	if md.Tokens != 3 {
+		t.Errorf("Tokens = %d, want 3", md.Tokens)
+	}
+	var data bytes.Buffer
+	if err := json.Compact(&data, md.StructuredData); err != nil || data.String() != `{"jsonld":[{"sku":"A1"}]}` {
+		t.Errorf("StructuredData = %s, want the stored JSON", md.StructuredData)
+	}
+
+	// Different settings must not share an entry, nor may the HTML entry.
+	if _, ok := c.GetMarkdown(MarkdownKey("http://example.com/page", "html", "", "2")); ok {
+		t.Error("expected miss for a different converter version")
+	}
+	if _, ok := c.Get("http://example.com/page"); ok {
+		t.Error("markdown entry must not be visible as an HTML entry")
+	}
+}
+
+func TestDiskCache_MarkdownUncounted(t *testing.T) {
+	c, _ := New(t.TempDir())
+
+	key := MarkdownKey("http://example.com/api", "json", "{{title}}", "1")
+	c.PutMarkdown(key, "title", -1, nil, time.Hour)
+
+	md, ok := c.GetMarkdown(key)
+	if !ok {
+		t.Fatal("expected markdown hit")
+	}
+	if md.Tokens != -1 {
+		t.Errorf("Tokens = %d, want -1", md.Tokens)
+	}
+}
+
+func TestDiskCache_MarkdownExpired(t *testing.T) {
+	c, _ := New(t.TempDir())
+
+	key := MarkdownKey("http://example.com/old", "html", "", "1")
+	c.PutMarkdown(key, "# Old", 2, nil, -time.Minute)
+
+	if _, ok := c.GetMarkdown(key); ok {
+		t.Error("expected miss for expired markdown")
+	}
+}
+
+func TestDiskCache_ConcurrentStoreLookup(t *testing.T) {
+	c, _ := New(t.TempDir())
+	url := "http://example.com/contended"
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			body := strings.Repeat(strconv.Itoa(i), 4096)
+			header := http.Header{}
+			header.Set("ETag", strconv.Itoa(i))
+			if err := c.Store(url, htmlResponse(header), []byte(body), time.Hour); err != nil {
+				t.Errorf("Store error: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			entry, ok := c.Lookup(url)
+			if !ok {
+				return
+			}
+			// The body must always belong to the meta it was read with.
+			if want := strings.Repeat(entry.ETag, 4096); string(entry.Body) != want {
+				t.Errorf("body does not match meta (ETag %s)", entry.ETag)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
 func TestIsCacheable(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -151,6 +356,12 @@ func TestIsCacheable(t *testing.T) {
 			header: func() http.Header { h := http.Header{}; h.Set("ETag", `"abc123"`); return h }(),
 			want:   true,
 		},
+		{
+			name:   "redirect",
+			status: 301,
+			header: http.Header{"Cache-Control": []string{"max-age=3600"}, "Location": []string{"/new"}},
+			want:   false,
+		},
 		{
 			name:   "error status",
 			status: 500,
@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Directives holds parsed Cache-Control directives (RFC 9111 §5.2), keyed by
+// lowercased name. Directives without an argument map to "".
+type Directives map[string]string
+
+// ParseCacheControl parses one or more Cache-Control header values.
+// Arguments may be tokens or quoted strings; commas inside quotes do not
+// split directives. When a directive repeats, the first occurrence wins.
+func ParseCacheControl(values ...string) Directives {
+	d := Directives{}
+	for _, v := range values {
+		for _, part := range splitDirectives(v) {
+			name, value, _ := strings.Cut(part, "=")
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			if _, dup := d[name]; dup {
+				continue
+			}
+			d[name] = unquote(strings.TrimSpace(value))
+		}
+	}
+	return d
+}
+
+// Has reports whether the directive is present.
+func (d Directives) Has(name string) bool {
+	_, ok := d[name]
+	return ok
+}
+
+// Duration returns the delta-seconds argument of a directive such as
+// max-age. ok is false if the directive is absent or its argument is not a
+// non-negative integer. Values too large to represent are capped at 2^31
+// seconds, as RFC 9111 §1.2.2 requires.
+func (d Directives) Duration(name string) (dur time.Duration, ok bool) {
+	v, present := d[name]
+	if !present || v == "" {
+		return 0, false
+	}
+	for _, r := range v {
+		if r < '0' || r > '9' {
+			return 0, false
+		}
+	}
+	secs, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || secs > math.MaxInt32 {
+		secs = math.MaxInt32 + 1
+	}
+	return time.Duration(secs) * time.Second, true
+}
+
+// splitDirectives splits a header value on commas that are not inside a
+// quoted string.
+func splitDirectives(s string) []string {
+	var parts []string
+	inQuote, escaped := false, false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case escaped:
+			escaped = false
+		case c == '\\' && inQuote:
+			escaped = true
+		case c == '"':
+			inQuote = !inQuote
+		case c == ',' && !inQuote:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unquote strips the quotes and backslash escapes from a quoted-string.
+// Tokens are returned unchanged.
+func unquote(s string) string {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+	var b strings.Builder
+	for i := 1; i < len(s)-1; i++ {
+		if s[i] == '\\' && i+1 < len(s)-1 {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
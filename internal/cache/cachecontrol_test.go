@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCacheControl(t *testing.T) {
+	d := ParseCacheControl(`Max-Age=600, no-cache, private="Set-Cookie, X-Foo"`, `stale-if-error=60, max-age=5`)
+
+	if !d.Has("no-cache") {
+		t.Error("expected no-cache")
+	}
+	if got := d["private"]; got != "Set-Cookie, X-Foo" {
+		t.Errorf("private = %q, want quoted field list", got)
+	}
+	if got, ok := d.Duration("max-age"); !ok || got != 600*time.Second {
+		t.Errorf("max-age = %v, %v; want first occurrence 600s", got, ok)
+	}
+	if got, ok := d.Duration("stale-if-error"); !ok || got != time.Minute {
+		t.Errorf("stale-if-error = %v, %v", got, ok)
+	}
+	if d.Has("x-foo") {
+		t.Error("quoted arguments must not be split into directives")
+	}
+}
+
+func TestParseCacheControl_NoSubstringMatches(t *testing.T) {
+	d := ParseCacheControl("x-max-age=600, no-store-ish")
+	if d.Has("max-age") {
+		t.Error("x-max-age must not be read as max-age")
+	}
+	if d.Has("no-store") {
+		t.Error("no-store-ish must not be read as no-store")
+	}
+}
+
+func TestDirectives_Duration(t *testing.T) {
+	tests := []struct {
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{"max-age=0", 0, true},
+		{"max-age=120", 2 * time.Minute, true},
+		{`max-age="30"`, 30 * time.Second, true},
+		{"max-age=-1", 0, false},
+		{"max-age=abc", 0, false},
+		{"max-age", 0, false},
+		{"max-age=99999999999999999999", (1 << 31) * time.Second, true},
+		{"", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			got, ok := ParseCacheControl(tt.header).Duration("max-age")
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("Duration = %v, %v; want %v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package cache
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Kinds of cached entries.
+const (
+	KindHTML     = "html"
+	KindMarkdown = "markdown"
+)
+
+// Info describes a cached entry for inspection.
+type Info struct {
+	// Key is the entry's file name without extension (a SHA-256 hash).
+	Key string
+	// Kind is KindHTML for raw responses and KindMarkdown for conversions.
+	Kind string
+	// Size is the combined size of the body and meta files.
+	Size int64
+	Metadata
+}
+
+// Host returns the host of the entry's URL, or "" if it is unknown.
+func (i *Info) Host() string {
+	u, err := url.Parse(i.URL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// Entries returns every entry in the cache, sorted by URL. Reading entries
+// does not count as an access.
+func (c *DiskCache) Entries() ([]Info, error) {
+	if c == nil {
+		return nil, nil
+	}
+	dirEntries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading cache dir: %w", err)
+	}
+
+	var infos []Info
+	for _, de := range dirEntries {
+		name := de.Name()
+		if de.IsDir() || !strings.HasSuffix(name, ".meta") {
+			continue
+		}
+		key := strings.TrimSuffix(name, ".meta")
+		metaPath := filepath.Join(c.dir, name)
+
+		info, err := os.Stat(metaPath)
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(metaPath)
+		if err != nil {
+			continue
+		}
+		meta, _, err := parseMeta(data)
+		if err != nil {
+			continue
+		}
+
+		kind := KindHTML
+		if _, err := os.Stat(filepath.Join(c.dir, key+".md")); err == nil {
+			kind = KindMarkdown
+		}
+		infos = append(infos, Info{
+			Key:      key,
+			Kind:     kind,
+			Size:     info.Size() + c.bodySize(key),
+			Metadata: *meta,
+		})
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].URL != infos[j].URL {
+			return infos[i].URL < infos[j].URL
+		}
+		return infos[i].Variant < infos[j].Variant
+	})
+	return infos, nil
+}
+
+// Find returns the entries stored for rawURL: its raw response, any Vary
+// variants and its Markdown conversions.
+func (c *DiskCache) Find(rawURL string) ([]Info, error) {
+	infos, err := c.Entries()
+	if err != nil {
+		return nil, err
+	}
+	var found []Info
+	for _, info := range infos {
+		if info.URL == rawURL {
+			found = append(found, info)
+		}
+	}
+	return found, nil
+}
+
+// Purge removes every entry for which match returns true and reports how
+// many entries and bytes were removed. Each entry is matched again under
+// its lock before it is removed, so an entry stored in the meantime is
+// judged by its new metadata.
+func (c *DiskCache) Purge(match func(*Info) bool) (removed int, freed int64, err error) {
+	start := time.Now()
+	infos, err := c.Entries()
+	if err != nil {
+		return 0, 0, err
+	}
+	purged := map[string]bool{}
+	remaining := map[string]bool{}
+	for i := range infos {
+		info := infos[i]
+		matches := match(&info) && c.removeIf(info.Key, func(meta *Metadata, _ os.FileInfo) bool {
+			if meta == nil {
+				return false
+			}
+			info.Metadata = *meta
+			return match(&info)
+		})
+		if !matches {
+			remaining[infos[i].URL] = true
+			continue
+		}
+		purged[infos[i].URL] = true
+		removed++
+		freed += infos[i].Size
+	}
+
+	// Drop the Vary index of URLs that no longer have any entries, unless
+	// it was rewritten during the purge.
+	for rawURL := range purged {
+		if rawURL != "" && !remaining[rawURL] {
+			c.removeVary(keyFor(rawURL), start)
+		}
+	}
+	return removed, freed, nil
+}
+
+// Stats summarizes the contents of the cache.
+type Stats struct {
+	Entries  int
+	HTML     int
+	Markdown int
+	// Expired counts entries past their expiry that are still on disk.
+	Expired int
+	Bytes   int64
+	Hits    int
+	// Oldest and Newest are the earliest and latest fetch times.
+	Oldest time.Time
+	Newest time.Time
+}
+
+// Stats reads every entry and summarizes the cache.
+func (c *DiskCache) Stats() (Stats, error) {
+	var stats Stats
+	infos, err := c.Entries()
+	if err != nil {
+		return stats, err
+	}
+	for _, info := range infos {
+		stats.Entries++
+		if info.Kind == KindMarkdown {
+			stats.Markdown++
+		} else {
+			stats.HTML++
+		}
+		if !info.Fresh() {
+			stats.Expired++
+		}
+		stats.Bytes += info.Size
+		stats.Hits += info.Hits
+		if stats.Oldest.IsZero() || info.FetchedAt.Before(stats.Oldest) {
+			stats.Oldest = info.FetchedAt
+		}
+		if info.FetchedAt.After(stats.Newest) {
+			stats.Newest = info.FetchedAt
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,174 @@
+package cache
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDiskCache_Entries(t *testing.T) {
+	c, _ := New(t.TempDir())
+
+	c.Store("http://example.com/a", htmlResponse(http.Header{}), []byte("<p>a</p>"), time.Hour)
+	c.Store("http://example.com/b", htmlResponse(http.Header{}), []byte("<p>b</p>"), -time.Minute)
+	c.PutMarkdown(MarkdownKey("http://example.com/a", "html", "", "1"), "a", 1, nil, time.Hour)
+
+	infos, err := c.Entries()
+	if err != nil {
+		t.Fatalf("Entries error: %v", err)
+	}
+	if len(infos) != 3 {
+		t.Fatalf("got %d entries, want 3", len(infos))
+	}
+
+	var kinds []string
+	for _, info := range infos {
+		kinds = append(kinds, info.URL+" "+info.Kind)
+		if info.Size <= 0 {
+			t.Errorf("%s: Size = %d, want > 0", info.URL, info.Size)
+		}
+	}
+	want := []string{
+		"http://example.com/a html",
+		"http://example.com/a markdown",
+		"http://example.com/b html",
+	}
+	for i := range want {
+		if kinds[i] != want[i] {
+			t.Errorf("entry %d = %q, want %q", i, kinds[i], want[i])
+		}
+	}
+	if infos[1].Variant != "html\n\n1" {
+		t.Errorf("Variant = %q, want conversion settings", infos[1].Variant)
+	}
+	if infos[0].Host() != "example.com" {
+		t.Errorf("Host() = %q, want example.com", infos[0].Host())
+	}
+}
+
+func TestDiskCache_Hits(t *testing.T) {
+	c, _ := New(t.TempDir())
+	url := "http://example.com/hits"
+	c.Store(url, htmlResponse(http.Header{}), []byte("<p>hits</p>"), time.Hour)
+
+	c.Lookup(url)
+	c.Lookup(url)
+
+	infos, _ := c.Find(url)
+	if len(infos) != 1 {
+		t.Fatalf("Find returned %d entries, want 1", len(infos))
+	}
+	if infos[0].Hits != 2 {
+		t.Errorf("Hits = %d, want 2", infos[0].Hits)
+	}
+	if infos[0].LastAccess.IsZero() {
+		t.Error("expected LastAccess to be set")
+	}
+}
+
+func TestDiskCache_PeekMarkdownIsNotAHit(t *testing.T) {
+	c, _ := New(t.TempDir())
+	key := MarkdownKey("http://example.com/peek", "html")
+	c.PutMarkdown(key, "# Peek", 2, nil, time.Hour)
+
+	md, ok := c.PeekMarkdown(key)
+	if !ok || md.Text != "# Peek" || md.Tokens != 2 {
+		t.Fatalf("PeekMarkdown = %+v, %v", md, ok)
+	}
+	if md, _ = c.GetMarkdown(key); md.Hits != 1 {
+		t.Errorf("Hits = %d, want only the GetMarkdown counted", md.Hits)
+	}
+}
+
+func TestDiskCache_Purge(t *testing.T) {
+	c, _ := New(t.TempDir())
+
+	c.Store("http://example.com/fresh", htmlResponse(http.Header{}), []byte("fresh"), time.Hour)
+	c.Store("http://example.com/old", htmlResponse(http.Header{}), []byte("old"), -time.Minute)
+	c.Store("http://other.org/page", htmlResponse(http.Header{}), []byte("other"), time.Hour)
+
+	removed, freed, err := c.Purge(func(info *Info) bool { return !info.Fresh() })
+	if err != nil {
+		t.Fatalf("Purge error: %v", err)
+	}
+	if removed != 1 || freed <= 0 {
+		t.Errorf("removed %d (%d bytes), want 1 entry", removed, freed)
+	}
+
+	removed, _, _ = c.Purge(func(info *Info) bool { return info.Host() == "other.org" })
+	if removed != 1 {
+		t.Errorf("removed %d by host, want 1", removed)
+	}
+
+	infos, _ := c.Entries()
+	if len(infos) != 1 || infos[0].URL != "http://example.com/fresh" {
+		t.Errorf("remaining entries = %+v, want only /fresh", infos)
+	}
+}
+
+func TestDiskCache_PurgeVaryIndex(t *testing.T) {
+	c, _ := New(t.TempDir())
+	url := "http://example.com/docs"
+
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("Accept-Language", "de")
+	resp := htmlResponse(http.Header{"Vary": []string{"Accept-Language"}})
+	c.Store(c.VariantKey(req, resp), resp, []byte("<p>Hallo</p>"), time.Hour)
+
+	removed, _, _ := c.Purge(func(info *Info) bool { return info.URL == url })
+	if removed != 1 {
+		t.Fatalf("removed %d, want 1", removed)
+	}
+	if _, err := os.Stat(filepath.Join(c.dir, keyFor(url)+varyExt)); !os.IsNotExist(err) {
+		t.Error("expected the Vary index to be removed with the last variant")
+	}
+}
+
+func TestDiskCache_PurgeRechecks(t *testing.T) {
+	c, _ := New(t.TempDir())
+	url := "http://example.com/restored"
+	c.Store(url, htmlResponse(http.Header{}), []byte("<p>old</p>"), time.Hour)
+
+	calls := 0
+	removed, _, _ := c.Purge(func(info *Info) bool {
+		if calls++; calls == 1 {
+			// The proxy stores a new response after the entry was listed.
+			c.Store(url, htmlResponse(http.Header{"Content-Type": []string{"application/json"}}), []byte("{}"), time.Hour)
+		}
+		return info.ContentType == "text/html"
+	})
+	if removed != 0 {
+		t.Errorf("removed %d, want the entry stored during the purge kept", removed)
+	}
+	if body, ok := c.Get(url); !ok || string(body) != "{}" {
+		t.Errorf("Get = %q, %v; want the new entry", body, ok)
+	}
+}
+
+func TestDiskCache_Stats(t *testing.T) {
+	c, _ := New(t.TempDir())
+
+	c.Store("http://example.com/a", htmlResponse(http.Header{}), []byte("a"), time.Hour)
+	c.Store("http://example.com/b", htmlResponse(http.Header{}), []byte("b"), -time.Minute)
+	c.PutMarkdown(MarkdownKey("http://example.com/a", "html"), "a", 1, nil, time.Hour)
+	c.Lookup("http://example.com/a")
+
+	stats, err := c.Stats()
+	if err != nil {
+		t.Fatalf("Stats error: %v", err)
+	}
+	if stats.Entries != 3 || stats.HTML != 2 || stats.Markdown != 1 {
+		t.Errorf("Entries = %d (%d html, %d markdown), want 3 (2, 1)", stats.Entries, stats.HTML, stats.Markdown)
+	}
+	if stats.Expired != 1 {
+		t.Errorf("Expired = %d, want 1", stats.Expired)
+	}
+	if stats.Hits != 1 {
+		t.Errorf("Hits = %d, want 1", stats.Hits)
+	}
+	if stats.Bytes <= 0 || stats.Oldest.IsZero() || stats.Newest.IsZero() {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
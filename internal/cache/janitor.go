@@ -0,0 +1,324 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rickcrawford/markdowninthemiddle/internal/fsutil"
+)
+
+// bodyExts lists the extensions of the body files that can accompany a
+// .meta file: raw HTML and converted Markdown.
+var bodyExts = []string{".html", ".md"}
+
+// SweepStats summarizes one pass of Sweep.
+type SweepStats struct {
+	// Expired is the number of entries removed because they expired.
+	Expired int
+	// Evicted is the number of entries removed to satisfy the size limits.
+	Evicted int
+	// FreedBytes is the size of all removed entries.
+	FreedBytes int64
+	// Entries and Bytes describe what remains in the cache.
+	Entries int
+	Bytes   int64
+}
+
+func (s SweepStats) String() string {
+	return fmt.Sprintf("removed %d expired, evicted %d (%d bytes freed); %d entries, %d bytes remaining",
+		s.Expired, s.Evicted, s.FreedBytes, s.Entries, s.Bytes)
+}
+
+// diskEntry describes one cached entry found on disk.
+type diskEntry struct {
+	key string
+	// url is the request URL the entry was stored for, or "" for entries
+	// written before it was recorded.
+	url        string
+	size       int64
+	lastAccess time.Time
+}
+
+// orphanAge is how old a temporary file, or a body file without a meta
+// file, must be before Sweep treats it as left over from an interrupted
+// write rather than one in progress.
+const orphanAge = time.Hour
+
+// Sweep deletes entries that expired more than StaleRetention ago, then
+// evicts the least recently used ones until the cache fits within its
+// MaxBytes and MaxEntries limits. Files left behind by interrupted writes,
+// and Vary indexes of URLs without entries, are removed as well.
+func (c *DiskCache) Sweep() (SweepStats, error) {
+	var stats SweepStats
+	if c == nil {
+		return stats, nil
+	}
+
+	dirEntries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return stats, fmt.Errorf("reading cache dir: %w", err)
+	}
+
+	now := time.Now()
+	c.removeOrphans(dirEntries, now)
+
+	var live []diskEntry
+	for _, de := range dirEntries {
+		name := de.Name()
+		if de.IsDir() || !strings.HasSuffix(name, ".meta") {
+			continue
+		}
+		key := strings.TrimSuffix(name, ".meta")
+		metaPath := filepath.Join(c.dir, name)
+
+		info, err := os.Stat(metaPath)
+		if err != nil {
+			continue
+		}
+		size := info.Size() + c.bodySize(key)
+
+		data, err := os.ReadFile(metaPath)
+		if err != nil {
+			continue
+		}
+		meta, legacy, err := parseMeta(data)
+		if err != nil || c.expired(meta, now) {
+			// The entry may have been refreshed since it was read.
+			if c.removeIf(key, func(meta *Metadata, _ os.FileInfo) bool { return meta == nil || c.expired(meta, now) }) {
+				stats.Expired++
+				stats.FreedBytes += size
+			} else {
+				e := diskEntry{key: key, size: size, lastAccess: now}
+				if meta != nil {
+					e.url = meta.URL
+				}
+				live = append(live, e)
+				stats.Bytes += size
+			}
+			continue
+		}
+		if legacy {
+			c.migrate(key, meta, info.ModTime())
+		}
+
+		live = append(live, diskEntry{key: key, url: meta.URL, size: size, lastAccess: info.ModTime()})
+		stats.Bytes += size
+	}
+
+	// Evict least recently used entries first.
+	sort.Slice(live, func(i, j int) bool {
+		return live[i].lastAccess.Before(live[j].lastAccess)
+	})
+	for len(live) > 0 && c.overLimit(len(live), stats.Bytes) {
+		victim := live[0]
+		live = live[1:]
+		// Skip entries stored, refreshed or read since they were listed.
+		if !c.removeIf(victim.key, func(_ *Metadata, info os.FileInfo) bool { return info.ModTime().Equal(victim.lastAccess) }) {
+			continue
+		}
+		stats.Evicted++
+		stats.FreedBytes += victim.size
+		stats.Bytes -= victim.size
+	}
+
+	stats.Entries = len(live)
+	c.removeUnusedVary(dirEntries, live, now)
+	return stats, nil
+}
+
+// RunJanitor sweeps the cache right away, so an oversized cache is
+// trimmed at startup, and then every interval until ctx is cancelled,
+// logging what each sweep removed.
+func (c *DiskCache) RunJanitor(ctx context.Context, interval time.Duration) {
+	if c == nil || interval <= 0 {
+		return
+	}
+	c.sweepAndLog()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.sweepAndLog()
+		}
+	}
+}
+
+// sweepAndLog runs Sweep and logs what it removed.
+func (c *DiskCache) sweepAndLog() {
+	stats, err := c.Sweep()
+	if err != nil {
+		log.Printf("cache sweep error: %v", err)
+		return
+	}
+	if stats.Expired > 0 || stats.Evicted > 0 {
+		log.Printf("cache sweep: %s", stats)
+	}
+}
+
+// expired reports whether the entry with metadata meta expired more than
+// StaleRetention before now.
+func (c *DiskCache) expired(meta *Metadata, now time.Time) bool {
+	return now.After(meta.ExpiresAt.Add(c.opts.StaleRetention))
+}
+
+// overLimit reports whether entries and bytes exceed the configured limits.
+func (c *DiskCache) overLimit(entries int, bytes int64) bool {
+	if c.opts.MaxEntries > 0 && entries > c.opts.MaxEntries {
+		return true
+	}
+	return c.opts.MaxBytes > 0 && bytes > c.opts.MaxBytes
+}
+
+// bodySize returns the combined size of the body files stored for key.
+func (c *DiskCache) bodySize(key string) int64 {
+	var size int64
+	for _, ext := range bodyExts {
+		if info, err := os.Stat(filepath.Join(c.dir, key+ext)); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+// migrate rewrites a legacy meta file as JSON without disturbing its
+// last-access time.
+func (c *DiskCache) migrate(key string, meta *Metadata, lastAccess time.Time) {
+	lock, err := c.lock(key)
+	if err != nil {
+		return
+	}
+	defer lock.Unlock()
+
+	if err := c.writeMeta(key, meta); err == nil {
+		os.Chtimes(filepath.Join(c.dir, key+".meta"), lastAccess, lastAccess)
+	}
+}
+
+// removeOrphans deletes temporary files and body files without a meta
+// file that are older than orphanAge.
+func (c *DiskCache) removeOrphans(dirEntries []os.DirEntry, now time.Time) {
+	metas := make(map[string]bool)
+	for _, de := range dirEntries {
+		if name := de.Name(); strings.HasSuffix(name, ".meta") {
+			metas[strings.TrimSuffix(name, ".meta")] = true
+		}
+	}
+
+	for _, de := range dirEntries {
+		name := de.Name()
+		if de.IsDir() {
+			continue
+		}
+		ext := filepath.Ext(name)
+		orphan := fsutil.IsTemp(name) ||
+			(slices.Contains(bodyExts, ext) && !metas[strings.TrimSuffix(name, ext)])
+		if !orphan {
+			continue
+		}
+		if info, err := de.Info(); err == nil && now.Sub(info.ModTime()) > orphanAge {
+			os.Remove(filepath.Join(c.dir, name))
+		}
+	}
+}
+
+// removeUnusedVary deletes the Vary indexes older than orphanAge whose URL
+// has no live entry left. The age guard spares indexes written just before
+// their first variant is stored. Entries without a recorded URL could
+// belong to any index, so while one exists all indexes are kept.
+func (c *DiskCache) removeUnusedVary(dirEntries []os.DirEntry, live []diskEntry, now time.Time) {
+	used := make(map[string]bool, len(live))
+	for _, e := range live {
+		if e.url == "" {
+			return
+		}
+		used[keyFor(e.url)] = true
+	}
+
+	for _, de := range dirEntries {
+		name := de.Name()
+		if de.IsDir() || !strings.HasSuffix(name, varyExt) || used[strings.TrimSuffix(name, varyExt)] {
+			continue
+		}
+		c.removeVary(strings.TrimSuffix(name, varyExt), now.Add(-orphanAge))
+	}
+}
+
+// removeVary deletes the Vary index stored under key, the key of its URL,
+// unless it was written at or after before. The index is checked and
+// removed under the lock writeVary takes, so a rewrite racing with the
+// removal survives it.
+func (c *DiskCache) removeVary(key string, before time.Time) {
+	lock, err := c.lock(key)
+	if err != nil {
+		log.Printf("cache lock error: %v", err)
+		return
+	}
+	defer lock.Unlock()
+
+	path := filepath.Join(c.dir, key+varyExt)
+	if info, err := os.Stat(path); err == nil && info.ModTime().Before(before) {
+		os.Remove(path)
+	}
+}
+
+// remove deletes the meta file and any body files stored for key.
+func (c *DiskCache) remove(key string) {
+	lock, err := c.lock(key)
+	if err != nil {
+		log.Printf("cache lock error: %v", err)
+		return
+	}
+	defer lock.Unlock()
+
+	c.removeFiles(key)
+}
+
+// removeIf deletes the entry for key if ok, called with its metadata (nil
+// when unreadable) and meta file info under the lock for key, approves.
+// Sweep decides on entries without holding their locks, so it re-checks
+// the decision here. It reports whether the entry was removed.
+func (c *DiskCache) removeIf(key string, ok func(meta *Metadata, info os.FileInfo) bool) bool {
+	lock, err := c.lock(key)
+	if err != nil {
+		log.Printf("cache lock error: %v", err)
+		return false
+	}
+	defer lock.Unlock()
+
+	metaPath := filepath.Join(c.dir, key+".meta")
+	info, err := os.Stat(metaPath)
+	if err != nil {
+		return false
+	}
+	var meta *Metadata
+	if data, err := os.ReadFile(metaPath); err == nil {
+		meta, _, _ = parseMeta(data)
+	}
+	if !ok(meta, info) {
+		return false
+	}
+	c.removeFiles(key)
+	return true
+}
+
+// removeFiles deletes the meta file and any body files stored for key. The
+// meta file goes first so that readers never find a meta file without its
+// body. The caller must hold the lock for key.
+func (c *DiskCache) removeFiles(key string) {
+	os.Remove(filepath.Join(c.dir, key+".meta"))
+	for _, ext := range bodyExts {
+		os.Remove(filepath.Join(c.dir, key+ext))
+	}
+}
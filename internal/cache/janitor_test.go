@@ -0,0 +1,277 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// setAccess backdates the last-access time of the entry for rawURL.
+func setAccess(t *testing.T, c *DiskCache, rawURL string, at time.Time) {
+	t.Helper()
+	metaPath := filepath.Join(c.dir, keyFor(rawURL)+".meta")
+	if err := os.Chtimes(metaPath, at, at); err != nil {
+		t.Fatalf("Chtimes: %v", err)
+	}
+}
+
+// cacheFiles returns the names of the entry files in dir, leaving out the
+// lock directory.
+func cacheFiles(dir string) []string {
+	dirEntries, _ := os.ReadDir(dir)
+	var names []string
+	for _, de := range dirEntries {
+		if !de.IsDir() {
+			names = append(names, de.Name())
+		}
+	}
+	return names
+}
+
+func TestDiskCache_SweepExpired(t *testing.T) {
+	c, _ := New(t.TempDir())
+
+	c.Put("http://example.com/fresh", []byte("fresh"), time.Hour)
+	c.Put("http://example.com/expired", []byte("expired"), -time.Minute)
+	c.PutMarkdown(MarkdownKey("http://example.com/expired", "html"), "# expired", 1, nil, -time.Minute)
+
+	stats, err := c.Sweep()
+	if err != nil {
+		t.Fatalf("Sweep error: %v", err)
+	}
+	if stats.Expired != 2 {
+		t.Errorf("Expired = %d, want 2", stats.Expired)
+	}
+	if stats.Entries != 1 {
+		t.Errorf("Entries = %d, want 1", stats.Entries)
+	}
+	if stats.FreedBytes <= 0 {
+		t.Errorf("FreedBytes = %d, want > 0", stats.FreedBytes)
+	}
+
+	files := cacheFiles(c.dir)
+	if len(files) != 2 {
+		t.Errorf("expected only the fresh .html/.meta pair to remain, got %d files", len(files))
+	}
+	if _, ok := c.Get("http://example.com/fresh"); !ok {
+		t.Error("fresh entry should survive the sweep")
+	}
+}
+
+func TestDiskCache_SweepStaleRetention(t *testing.T) {
+	c, _ := NewWithOptions(t.TempDir(), Options{StaleRetention: time.Hour})
+
+	c.Put("http://example.com/recent", []byte("recent"), -time.Minute)
+	c.Put("http://example.com/ancient", []byte("ancient"), -2*time.Hour)
+
+	stats, err := c.Sweep()
+	if err != nil {
+		t.Fatalf("Sweep error: %v", err)
+	}
+	if stats.Expired != 1 || stats.Entries != 1 {
+		t.Errorf("Expired = %d, Entries = %d; want 1, 1", stats.Expired, stats.Entries)
+	}
+	if _, ok := c.Lookup("http://example.com/recent"); !ok {
+		t.Error("entry within the retention window should survive the sweep")
+	}
+}
+
+func TestDiskCache_SweepOrphans(t *testing.T) {
+	c, _ := New(t.TempDir())
+	c.Put("http://example.com/kept", []byte("kept"), time.Hour)
+
+	old := time.Now().Add(-2 * orphanAge)
+	orphans := []string{
+		filepath.Join(c.dir, keyFor("http://example.com/orphan")+".html"),
+		filepath.Join(c.dir, ".abc.meta.tmp-123"),
+	}
+	for _, path := range orphans {
+		os.WriteFile(path, []byte("x"), 0o644)
+		os.Chtimes(path, old, old)
+	}
+	// A recent temporary file may belong to a write in progress.
+	recent := filepath.Join(c.dir, ".def.html.tmp-456")
+	os.WriteFile(recent, []byte("x"), 0o644)
+
+	if _, err := c.Sweep(); err != nil {
+		t.Fatalf("Sweep error: %v", err)
+	}
+	for _, path := range orphans {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("expected orphan %s to be removed", filepath.Base(path))
+		}
+	}
+	if _, err := os.Stat(recent); err != nil {
+		t.Error("recent temporary file should survive the sweep")
+	}
+	if _, ok := c.Get("http://example.com/kept"); !ok {
+		t.Error("complete entry should survive the sweep")
+	}
+}
+
+func TestDiskCache_SweepMaxEntriesLRU(t *testing.T) {
+	c, _ := NewWithOptions(t.TempDir(), Options{MaxEntries: 2})
+
+	now := time.Now()
+	urls := []string{"http://example.com/a", "http://example.com/b", "http://example.com/c"}
+	for i, u := range urls {
+		c.Put(u, []byte("body"), time.Hour)
+		setAccess(t, c, u, now.Add(time.Duration(i-10)*time.Minute))
+	}
+	// Reading /a makes it the most recently used entry.
+	if _, ok := c.Get("http://example.com/a"); !ok {
+		t.Fatal("expected hit for /a")
+	}
+
+	stats, err := c.Sweep()
+	if err != nil {
+		t.Fatalf("Sweep error: %v", err)
+	}
+	if stats.Evicted != 1 || stats.Entries != 2 {
+		t.Errorf("stats = %+v, want 1 evicted and 2 entries", stats)
+	}
+	if _, ok := c.Get("http://example.com/b"); ok {
+		t.Error("least recently used entry /b should be evicted")
+	}
+	for _, u := range []string{"http://example.com/a", "http://example.com/c"} {
+		if _, ok := c.Get(u); !ok {
+			t.Errorf("expected %s to survive", u)
+		}
+	}
+}
+
+func TestDiskCache_SweepMaxBytes(t *testing.T) {
+	dir := t.TempDir()
+	c, _ := NewWithOptions(dir, Options{MaxBytes: 1500})
+
+	now := time.Now()
+	body := make([]byte, 1000)
+	c.Put("http://example.com/old", body, time.Hour)
+	setAccess(t, c, "http://example.com/old", now.Add(-time.Hour))
+	c.Put("http://example.com/new", body, time.Hour)
+
+	stats, err := c.Sweep()
+	if err != nil {
+		t.Fatalf("Sweep error: %v", err)
+	}
+	if stats.Evicted != 1 {
+		t.Errorf("Evicted = %d, want 1", stats.Evicted)
+	}
+	if stats.Bytes > 1500 {
+		t.Errorf("Bytes = %d, want <= 1500", stats.Bytes)
+	}
+	if _, ok := c.Get("http://example.com/new"); !ok {
+		t.Error("most recent entry should survive")
+	}
+}
+
+func TestDiskCache_SweepNilSafe(t *testing.T) {
+	var c *DiskCache
+	if _, err := c.Sweep(); err != nil {
+		t.Errorf("expected nil error from nil cache, got %v", err)
+	}
+	// Must return immediately rather than block.
+	c.RunJanitor(context.Background(), time.Millisecond)
+}
+
+func TestDiskCache_RunJanitor(t *testing.T) {
+	c, _ := New(t.TempDir())
+	c.Put("http://example.com/expired", []byte("x"), -time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.RunJanitor(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if len(cacheFiles(c.dir)) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("janitor did not remove expired entry")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+}
+
+func TestDiskCache_RemoveIfRechecks(t *testing.T) {
+	c, _ := New(t.TempDir())
+	const u = "http://example.com/refreshed"
+	key := keyFor(u)
+
+	c.Put(u, []byte("old"), -time.Minute)
+	expired := func(meta *Metadata, _ os.FileInfo) bool { return meta == nil || c.expired(meta, time.Now()) }
+	// A store between Sweep reading the meta and removing the entry wins.
+	c.Put(u, []byte("new"), time.Hour)
+	if c.removeIf(key, expired) {
+		t.Error("removeIf removed an entry refreshed after the decision")
+	}
+	if body, ok := c.Get(u); !ok || string(body) != "new" {
+		t.Errorf("refreshed entry = %q, %v; want it kept", body, ok)
+	}
+
+	info, _ := os.Stat(filepath.Join(c.dir, key+".meta"))
+	c.Put(u, []byte("newer"), time.Hour)
+	os.Chtimes(filepath.Join(c.dir, key+".meta"), info.ModTime().Add(time.Second), info.ModTime().Add(time.Second))
+	unchanged := func(_ *Metadata, current os.FileInfo) bool { return current.ModTime().Equal(info.ModTime()) }
+	if c.removeIf(key, unchanged) {
+		t.Error("removeIf evicted an entry stored after it was listed")
+	}
+}
+
+func TestDiskCache_RunJanitorSweepsAtStartup(t *testing.T) {
+	c, _ := New(t.TempDir())
+	c.Put("http://example.com/expired", []byte("x"), -time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.RunJanitor(ctx, time.Hour)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(cacheFiles(c.dir)) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("janitor did not sweep at startup")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+}
+
+func TestDiskCache_SweepVaryIndex(t *testing.T) {
+	c, _ := New(t.TempDir())
+	old := time.Now().Add(-2 * orphanAge)
+
+	store := func(url string, ttl time.Duration) string {
+		req, _ := http.NewRequest("GET", url, nil)
+		req.Header.Set("Accept-Language", "de")
+		resp := htmlResponse(http.Header{"Vary": []string{"Accept-Language"}})
+		c.Store(c.VariantKey(req, resp), resp, []byte("<p>Hallo</p>"), ttl)
+		index := filepath.Join(c.dir, keyFor(url)+varyExt)
+		os.Chtimes(index, old, old)
+		return index
+	}
+	expired := store("http://example.com/expired", -time.Minute)
+	kept := store("http://example.com/kept", time.Hour)
+
+	if _, err := c.Sweep(); err != nil {
+		t.Fatalf("Sweep error: %v", err)
+	}
+	if _, err := os.Stat(expired); !os.IsNotExist(err) {
+		t.Error("expected the Vary index of the expired variant to be removed")
+	}
+	if _, err := os.Stat(kept); err != nil {
+		t.Error("Vary index of a live variant should survive the sweep")
+	}
+}
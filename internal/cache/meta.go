@@ -0,0 +1,177 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Metadata is the JSON document stored in each .meta file. It holds
+// everything needed to rebuild the cached response and to revalidate it.
+type Metadata struct {
+	// URL is the request URL the entry was stored for.
+	URL string `json:"url,omitempty"`
+	// Variant is the rest of the entry's cache key: the request header
+	// values of a Vary variant, or the settings of a Markdown conversion.
+	Variant string `json:"variant,omitempty"`
+
+	StatusCode   int    `json:"status_code"`
+	ContentType  string `json:"content_type,omitempty"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Vary         string `json:"vary,omitempty"`
+	CacheControl string `json:"cache_control,omitempty"`
+	// FetchedAt is when the response was fetched or last revalidated.
+	FetchedAt time.Time `json:"fetched_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// TokenCount is the token count of a cached Markdown document.
+	TokenCount *int `json:"tokens,omitempty"`
+	// StructuredData is the JSON structured data of the page a cached
+	// Markdown document was converted from, if it was extracted.
+	StructuredData json.RawMessage `json:"structured_data,omitempty"`
+
+	// Hits counts lookups of the entry since it was stored; LastAccess is
+	// the time of the latest one.
+	Hits       int       `json:"hits"`
+	LastAccess time.Time `json:"last_access,omitzero"`
+}
+
+// newMetadata records the status and headers of resp with an expiry ttl from
+// now. A nil resp records a plain 200.
+func newMetadata(resp *http.Response, ttl time.Duration) *Metadata {
+	now := time.Now().UTC()
+	meta := &Metadata{
+		StatusCode: http.StatusOK,
+		FetchedAt:  now,
+		ExpiresAt:  now.Add(ttl),
+	}
+	if resp != nil {
+		meta.StatusCode = resp.StatusCode
+		meta.ContentType = resp.Header.Get("Content-Type")
+		meta.ETag = resp.Header.Get("ETag")
+		meta.LastModified = resp.Header.Get("Last-Modified")
+		meta.Vary = strings.Join(resp.Header.Values("Vary"), ", ")
+		meta.CacheControl = strings.Join(resp.Header.Values("Cache-Control"), ", ")
+	}
+	return meta
+}
+
+// setKey records the unhashed cache key: its first line is the request
+// URL, the rest identifies the variant.
+func (m *Metadata) setKey(key string) {
+	m.URL, m.Variant, _ = strings.Cut(key, "\n")
+}
+
+// Fresh reports whether the entry can be served without revalidation.
+func (m *Metadata) Fresh() bool {
+	return time.Now().Before(m.ExpiresAt)
+}
+
+// Staleness returns how long ago the entry expired, or zero while fresh.
+func (m *Metadata) Staleness() time.Duration {
+	return max(time.Since(m.ExpiresAt), 0)
+}
+
+// Age returns how long ago the response was fetched or last revalidated.
+func (m *Metadata) Age() time.Duration {
+	if m.FetchedAt.IsZero() {
+		return 0
+	}
+	return time.Since(m.FetchedAt)
+}
+
+// Response rebuilds the cached response for req, with Age and Expires
+// headers describing the entry's lifetime.
+func (e *Entry) Response(req *http.Request) *http.Response {
+	status := e.StatusCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	header := http.Header{}
+	contentType := e.ContentType
+	if contentType == "" {
+		// Entries written before the type was recorded only held HTML.
+		contentType = "text/html"
+	}
+	header.Set("Content-Type", contentType)
+	if e.ETag != "" {
+		header.Set("ETag", e.ETag)
+	}
+	if e.LastModified != "" {
+		header.Set("Last-Modified", e.LastModified)
+	}
+	if e.Vary != "" {
+		header.Set("Vary", e.Vary)
+	}
+	if e.CacheControl != "" {
+		header.Set("Cache-Control", e.CacheControl)
+	}
+	header.Set("Content-Length", strconv.Itoa(len(e.Body)))
+	header.Set("Age", strconv.Itoa(int(e.Age().Seconds())))
+	header.Set("Expires", e.ExpiresAt.UTC().Format(http.TimeFormat))
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// parseMeta decodes a .meta file. Besides JSON it accepts the legacy format:
+// an RFC3339 expiry line, optionally followed by a MIME-style header block.
+// legacy reports whether the file should be rewritten as JSON.
+func parseMeta(data []byte) (meta *Metadata, legacy bool, err error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		meta = &Metadata{}
+		if err := json.Unmarshal(trimmed, meta); err != nil {
+			return nil, false, fmt.Errorf("decoding cache meta: %w", err)
+		}
+		return meta, false, nil
+	}
+	meta, err = parseLegacyMeta(string(data))
+	return meta, true, err
+}
+
+// parseLegacyMeta decodes the pre-JSON .meta format.
+func parseLegacyMeta(data string) (*Metadata, error) {
+	first, rest, _ := strings.Cut(data, "\n")
+	expiry, err := time.Parse(time.RFC3339, strings.TrimSpace(first))
+	if err != nil {
+		return nil, err
+	}
+	meta := &Metadata{StatusCode: http.StatusOK, ExpiresAt: expiry}
+
+	if strings.TrimSpace(rest) == "" {
+		return meta, nil
+	}
+	tr := textproto.NewReader(bufio.NewReader(strings.NewReader(rest + "\r\n")))
+	mime, err := tr.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header(mime)
+	meta.ContentType = header.Get("Content-Type")
+	meta.ETag = header.Get("ETag")
+	meta.LastModified = header.Get("Last-Modified")
+	if t, err := time.Parse(time.RFC3339, header.Get("X-Stored-At")); err == nil {
+		meta.FetchedAt = t
+	}
+	if n, err := strconv.Atoi(header.Get("X-Token-Count")); err == nil {
+		meta.TokenCount = &n
+	}
+	return meta, nil
+}
@@ -0,0 +1,134 @@
+package cache
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseMeta_JSON(t *testing.T) {
+	data := []byte(`{"status_code":203,"content_type":"text/html","etag":"\"x\"","fetched_at":"2026-01-02T03:04:05Z","expires_at":"2026-01-02T04:04:05Z"}`)
+	meta, legacy, err := parseMeta(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if legacy {
+		t.Error("JSON meta must not be reported as legacy")
+	}
+	if meta.StatusCode != 203 || meta.ETag != `"x"` {
+		t.Errorf("unexpected meta: %+v", meta)
+	}
+}
+
+func TestParseMeta_Legacy(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		etag string
+	}{
+		{name: "expiry only", data: "2030-01-02T03:04:05Z"},
+		{
+			name: "expiry and headers",
+			data: "2030-01-02T03:04:05Z\r\nEtag: \"v1\"\r\nX-Stored-At: 2026-01-02T03:04:05Z\r\n",
+			etag: `"v1"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meta, legacy, err := parseMeta([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !legacy {
+				t.Error("expected legacy format")
+			}
+			if meta.StatusCode != http.StatusOK {
+				t.Errorf("StatusCode = %d, want 200", meta.StatusCode)
+			}
+			if meta.ETag != tt.etag {
+				t.Errorf("ETag = %q, want %q", meta.ETag, tt.etag)
+			}
+			if meta.ExpiresAt.Year() != 2030 {
+				t.Errorf("ExpiresAt = %v", meta.ExpiresAt)
+			}
+		})
+	}
+}
+
+func TestParseMeta_Invalid(t *testing.T) {
+	for _, data := range []string{"not a date", "{broken json"} {
+		if _, _, err := parseMeta([]byte(data)); err == nil {
+			t.Errorf("expected error for %q", data)
+		}
+	}
+}
+
+func TestDiskCache_MigratesLegacyMeta(t *testing.T) {
+	dir := t.TempDir()
+	c, _ := New(dir)
+
+	url := "http://example.com/legacy"
+	key := keyFor(url)
+	metaPath := filepath.Join(dir, key+".meta")
+	os.WriteFile(filepath.Join(dir, key+".html"), []byte("<p>legacy</p>"), 0o644)
+	expiry := time.Now().Add(time.Hour).Format(time.RFC3339)
+	os.WriteFile(metaPath, []byte(expiry), 0o644)
+
+	entry, ok := c.Lookup(url)
+	if !ok {
+		t.Fatal("expected legacy entry to be readable")
+	}
+	if !entry.Fresh() {
+		t.Error("expected fresh legacy entry")
+	}
+
+	data, _ := os.ReadFile(metaPath)
+	if _, legacy, err := parseMeta(data); err != nil || legacy {
+		t.Errorf("expected meta rewritten as JSON, got %q", data)
+	}
+}
+
+func TestEntry_Response(t *testing.T) {
+	entry := &Entry{
+		Body: []byte("<p>cached</p>"),
+		Metadata: Metadata{
+			StatusCode:   http.StatusOK,
+			ContentType:  "text/html; charset=utf-8",
+			ETag:         `"v1"`,
+			LastModified: "Mon, 02 Jan 2006 15:04:05 GMT",
+			Vary:         "Accept-Language",
+			FetchedAt:    time.Now().Add(-30 * time.Second),
+			ExpiresAt:    time.Now().Add(time.Hour),
+		},
+	}
+
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	resp := entry.Response(req)
+
+	if resp.StatusCode != http.StatusOK || resp.Status != "200 OK" {
+		t.Errorf("status = %d %q", resp.StatusCode, resp.Status)
+	}
+	for name, want := range map[string]string{
+		"Content-Type":   "text/html; charset=utf-8",
+		"ETag":           `"v1"`,
+		"Last-Modified":  "Mon, 02 Jan 2006 15:04:05 GMT",
+		"Vary":           "Accept-Language",
+		"Content-Length": "13",
+	} {
+		if got := resp.Header.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if age := resp.Header.Get("Age"); age != "29" && age != "30" {
+		t.Errorf("Age = %q, want about 30", age)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if !bytes.Equal(body, entry.Body) {
+		t.Errorf("body = %q", body)
+	}
+}
@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"net/http"
+	"time"
+)
+
+// Freshness describes how a cached entry may be used for a request.
+type Freshness int
+
+const (
+	// Stale entries must be revalidated (or refetched) before use.
+	Stale Freshness = iota
+	// Fresh entries may be served without contacting the origin.
+	Fresh
+	// StaleWhileRevalidate entries may be served while a background
+	// revalidation refreshes them (RFC 5861).
+	StaleWhileRevalidate
+)
+
+// requestDirectives returns the Cache-Control directives sent by the client.
+// A bare "Pragma: no-cache" is honored when Cache-Control is absent.
+func requestDirectives(req *http.Request) Directives {
+	values := req.Header.Values("Cache-Control")
+	if len(values) == 0 && req.Header.Get("Pragma") == "no-cache" {
+		return Directives{"no-cache": ""}
+	}
+	return ParseCacheControl(values...)
+}
+
+// Bypass reports whether req must neither be answered from nor stored in the
+// cache, because the client sent no-store.
+func (c *DiskCache) Bypass(req *http.Request) bool {
+	if c.opts.IgnoreHeaders {
+		return false
+	}
+	return requestDirectives(req).Has("no-store")
+}
+
+// OnlyIfCached reports whether the client asked to be answered from the
+// cache alone (only-if-cached), with a 504 if no usable entry exists.
+func (c *DiskCache) OnlyIfCached(req *http.Request) bool {
+	if c.opts.IgnoreHeaders {
+		return false
+	}
+	return requestDirectives(req).Has("only-if-cached")
+}
+
+// Cacheable reports whether resp, received for req, may be stored.
+func (c *DiskCache) Cacheable(req *http.Request, resp *http.Response) bool {
+	if c.opts.IgnoreHeaders {
+		return resp.StatusCode >= 200 && resp.StatusCode < 300 && !VaryAll(resp.Header)
+	}
+	if c.Bypass(req) {
+		return false
+	}
+	return IsCacheable(resp)
+}
+
+// TTL returns how long resp stays fresh once stored.
+func (c *DiskCache) TTL(resp *http.Response) time.Duration {
+	if c.opts.IgnoreHeaders {
+		return defaultTTL
+	}
+	return TTL(resp)
+}
+
+// Freshness decides how the entry with metadata m may be used for req,
+// combining its stored lifetime and response directives with the
+// client's no-cache, max-age, min-fresh and max-stale directives.
+func (c *DiskCache) Freshness(req *http.Request, m *Metadata) Freshness {
+	if c.opts.IgnoreHeaders {
+		if m.Fresh() {
+			return Fresh
+		}
+		return Stale
+	}
+
+	reqCC := requestDirectives(req)
+	if reqCC.Has("no-cache") {
+		return Stale
+	}
+	if maxAge, ok := reqCC.Duration("max-age"); ok && m.Age() > maxAge {
+		return Stale
+	}
+	if minFresh, ok := reqCC.Duration("min-fresh"); ok && time.Until(m.ExpiresAt) < minFresh {
+		return Stale
+	}
+	if m.Fresh() {
+		return Fresh
+	}
+
+	respCC := ParseCacheControl(m.CacheControl)
+	if respCC.Has("must-revalidate") || respCC.Has("proxy-revalidate") || respCC.Has("no-cache") {
+		return Stale
+	}
+	staleness := m.Staleness()
+	if reqCC.Has("max-stale") {
+		// max-stale without an argument accepts any staleness.
+		if limit, ok := reqCC.Duration("max-stale"); !ok || staleness <= limit {
+			return Fresh
+		}
+	}
+	if window, ok := respCC.Duration("stale-while-revalidate"); ok && staleness <= window {
+		return StaleWhileRevalidate
+	}
+	return Stale
+}
+
+// StaleIfError reports whether the stale entry with metadata m may be served
+// for req because revalidation failed, per the stale-if-error directive
+// (RFC 5861) from either the response or the client, or because the cache
+// is configured to serve stale on error.
+func (c *DiskCache) StaleIfError(req *http.Request, m *Metadata) bool {
+	if c.opts.IgnoreHeaders {
+		return c.opts.ServeStaleOnError
+	}
+	respCC := ParseCacheControl(m.CacheControl)
+	if respCC.Has("must-revalidate") || respCC.Has("proxy-revalidate") {
+		return false
+	}
+	if c.opts.ServeStaleOnError {
+		return true
+	}
+	staleness := m.Staleness()
+	for _, cc := range []Directives{requestDirectives(req), respCC} {
+		if window, ok := cc.Duration("stale-if-error"); ok && staleness <= window {
+			return true
+		}
+	}
+	return false
+}
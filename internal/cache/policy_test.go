@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// meta returns metadata fetched age ago that expires after ttl.
+func meta(age, ttl time.Duration, cacheControl string) *Metadata {
+	fetched := time.Now().Add(-age)
+	return &Metadata{
+		StatusCode:   http.StatusOK,
+		CacheControl: cacheControl,
+		FetchedAt:    fetched,
+		ExpiresAt:    fetched.Add(ttl),
+	}
+}
+
+func TestDiskCache_Freshness(t *testing.T) {
+	c, _ := New(t.TempDir())
+
+	tests := []struct {
+		name  string
+		reqCC string
+		meta  *Metadata
+		want  Freshness
+	}{
+		{"fresh", "", meta(time.Minute, time.Hour, "max-age=3600"), Fresh},
+		{"expired", "", meta(2*time.Hour, time.Hour, "max-age=3600"), Stale},
+		{"client no-cache", "no-cache", meta(time.Minute, time.Hour, ""), Stale},
+		{"client max-age exceeded", "max-age=30", meta(time.Minute, time.Hour, ""), Stale},
+		{"client max-age satisfied", "max-age=300", meta(time.Minute, time.Hour, ""), Fresh},
+		{"client min-fresh", "min-fresh=7200", meta(time.Minute, time.Hour, ""), Stale},
+		{"client max-stale", "max-stale=600", meta(65*time.Minute, time.Hour, ""), Fresh},
+		{"client max-stale exceeded", "max-stale=60", meta(65*time.Minute, time.Hour, ""), Stale},
+		{"client max-stale unbounded", "max-stale", meta(48*time.Hour, time.Hour, ""), Fresh},
+		{"must-revalidate beats max-stale", "max-stale", meta(65*time.Minute, time.Hour, "must-revalidate"), Stale},
+		{"stale-while-revalidate", "", meta(65*time.Minute, time.Hour, "max-age=3600, stale-while-revalidate=600"), StaleWhileRevalidate},
+		{"stale-while-revalidate exceeded", "", meta(2*time.Hour, time.Hour, "max-age=3600, stale-while-revalidate=600"), Stale},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "http://example.com", nil)
+			if tt.reqCC != "" {
+				req.Header.Set("Cache-Control", tt.reqCC)
+			}
+			if got := c.Freshness(req, tt.meta); got != tt.want {
+				t.Errorf("Freshness() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiskCache_StaleIfError(t *testing.T) {
+	c, _ := New(t.TempDir())
+
+	tests := []struct {
+		name  string
+		reqCC string
+		meta  *Metadata
+		want  bool
+	}{
+		{"no directive", "", meta(2*time.Hour, time.Hour, "max-age=3600"), false},
+		{"response directive", "", meta(2*time.Hour, time.Hour, "max-age=3600, stale-if-error=7200"), true},
+		{"response window exceeded", "", meta(2*time.Hour, time.Hour, "max-age=3600, stale-if-error=60"), false},
+		{"request directive", "stale-if-error=7200", meta(2*time.Hour, time.Hour, ""), true},
+		{"must-revalidate", "stale-if-error=7200", meta(2*time.Hour, time.Hour, "must-revalidate"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "http://example.com", nil)
+			if tt.reqCC != "" {
+				req.Header.Set("Cache-Control", tt.reqCC)
+			}
+			if got := c.StaleIfError(req, tt.meta); got != tt.want {
+				t.Errorf("StaleIfError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiskCache_ServeStaleOnError(t *testing.T) {
+	c, _ := NewWithOptions(t.TempDir(), Options{ServeStaleOnError: true})
+	req, _ := http.NewRequest("GET", "http://example.com", nil)
+
+	if !c.StaleIfError(req, meta(2*time.Hour, time.Hour, "max-age=3600")) {
+		t.Error("expected stale entry to be served on error")
+	}
+	if c.StaleIfError(req, meta(2*time.Hour, time.Hour, "max-age=3600, must-revalidate")) {
+		t.Error("must-revalidate entries must not be served stale")
+	}
+}
+
+func TestDiskCache_RequestDirectives(t *testing.T) {
+	c, _ := New(t.TempDir())
+
+	req, _ := http.NewRequest("GET", "http://example.com", nil)
+	req.Header.Set("Cache-Control", "no-store")
+	if !c.Bypass(req) {
+		t.Error("expected no-store request to bypass the cache")
+	}
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Cache-Control": []string{"max-age=60"}}}
+	if c.Cacheable(req, resp) {
+		t.Error("expected response to a no-store request to be uncacheable")
+	}
+
+	req, _ = http.NewRequest("GET", "http://example.com", nil)
+	req.Header.Set("Pragma", "no-cache")
+	if got := c.Freshness(req, meta(0, time.Hour, "")); got != Stale {
+		t.Errorf("Pragma: no-cache Freshness() = %v, want Stale", got)
+	}
+
+	req, _ = http.NewRequest("GET", "http://example.com", nil)
+	req.Header.Set("Cache-Control", "only-if-cached")
+	if !c.OnlyIfCached(req) {
+		t.Error("expected only-if-cached to be detected")
+	}
+}
+
+func TestDiskCache_IgnoreHeaders(t *testing.T) {
+	c, _ := NewWithOptions(t.TempDir(), Options{IgnoreHeaders: true})
+
+	req, _ := http.NewRequest("GET", "http://example.com", nil)
+	req.Header.Set("Cache-Control", "no-store, no-cache")
+	if c.Bypass(req) {
+		t.Error("request directives must be ignored")
+	}
+
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Cache-Control": []string{"no-store"}}}
+	if !c.Cacheable(req, resp) {
+		t.Error("expected 200 response to be cacheable when headers are ignored")
+	}
+	if got := c.TTL(resp); got != defaultTTL {
+		t.Errorf("TTL() = %v, want %v", got, defaultTTL)
+	}
+	if got := c.Freshness(req, meta(time.Minute, time.Hour, "no-cache")); got != Fresh {
+		t.Errorf("Freshness() = %v, want Fresh", got)
+	}
+}
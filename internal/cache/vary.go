@@ -0,0 +1,136 @@
+package cache
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/rickcrawford/markdowninthemiddle/internal/fsutil"
+)
+
+// varyExt is the extension of the per-URL index that lists the request
+// headers named in the Vary header of the URL's most recent response.
+const varyExt = ".vary"
+
+// VaryAll reports whether header carries "Vary: *", meaning the response
+// depends on more than request headers and must never be served from a
+// cache.
+func VaryAll(header http.Header) bool {
+	return slices.Contains(varyHeaders(header), "*")
+}
+
+// varyHeaders returns the canonical, sorted and deduplicated header names
+// listed in header's Vary fields. Accept-Encoding is dropped: bodies are
+// stored decoded, so it never selects a different cached representation.
+func varyHeaders(header http.Header) []string {
+	var names []string
+	for _, v := range header.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if name != "*" {
+				name = http.CanonicalHeaderKey(name)
+			}
+			if name == "Accept-Encoding" {
+				continue
+			}
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// variantKey extends req's URL with the normalized values of the named
+// request headers. Without headers it is the URL itself, so responses that
+// do not vary keep the plain URL key.
+func variantKey(req *http.Request, headers []string) string {
+	rawURL := req.URL.String()
+	if len(headers) == 0 {
+		return rawURL
+	}
+	var b strings.Builder
+	b.WriteString(rawURL)
+	for _, name := range headers {
+		b.WriteString("\n")
+		b.WriteString(strings.ToLower(name))
+		b.WriteString(": ")
+		b.WriteString(normalizeHeaderValue(req.Header.Values(name)))
+	}
+	return b.String()
+}
+
+// normalizeHeaderValue joins the values of a header field into one list
+// with insignificant whitespace removed, so equivalent requests select the
+// same variant.
+func normalizeHeaderValue(values []string) string {
+	var parts []string
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.Join(strings.Fields(part), " "); part != "" {
+				parts = append(parts, part)
+			}
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// RequestKey returns the key under which a response to req is looked up:
+// the request URL, extended with the values of the request headers that
+// stored responses for the URL vary on.
+func (c *DiskCache) RequestKey(req *http.Request) string {
+	if c == nil {
+		return req.URL.String()
+	}
+	return variantKey(req, c.readVary(req.URL.String()))
+}
+
+// VariantKey returns the key under which resp, received for req, is stored,
+// based on resp's Vary header. The header names are recorded for the URL so
+// that RequestKey selects the same variant for later requests.
+func (c *DiskCache) VariantKey(req *http.Request, resp *http.Response) string {
+	headers := varyHeaders(resp.Header)
+	if c != nil {
+		if err := c.writeVary(req.URL.String(), headers); err != nil {
+			log.Printf("cache vary index error: %v", err)
+		}
+	}
+	return variantKey(req, headers)
+}
+
+// readVary returns the header names recorded for rawURL, if any.
+func (c *DiskCache) readVary(rawURL string) []string {
+	data, err := os.ReadFile(filepath.Join(c.dir, keyFor(rawURL)+varyExt))
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(string(data))
+}
+
+// writeVary records headers as the Vary index for rawURL. The file is only
+// rewritten when the list changes, and removed once the URL stops varying.
+func (c *DiskCache) writeVary(rawURL string, headers []string) error {
+	key := keyFor(rawURL)
+	lock, err := c.lock(key)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	path := filepath.Join(c.dir, key+varyExt)
+	if len(headers) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if slices.Equal(c.readVary(rawURL), headers) {
+		return nil
+	}
+	return fsutil.WriteFileAtomic(path, []byte(strings.Join(headers, "\n")+"\n"), 0o644)
+}
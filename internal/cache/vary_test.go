@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestVaryHeaders(t *testing.T) {
+	header := http.Header{}
+	header.Add("Vary", "accept-language, Cookie")
+	header.Add("Vary", "Accept-Encoding,  Accept-Language")
+
+	got := varyHeaders(header)
+	want := []string{"Accept-Language", "Cookie"}
+	if !slices.Equal(got, want) {
+		t.Errorf("varyHeaders() = %v, want %v", got, want)
+	}
+}
+
+func TestVaryAll(t *testing.T) {
+	if !VaryAll(http.Header{"Vary": []string{"Accept, *"}}) {
+		t.Error("expected Vary: * to be detected")
+	}
+	if VaryAll(http.Header{"Vary": []string{"Accept"}}) {
+		t.Error("unexpected Vary: * for a header list")
+	}
+
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{
+		"Cache-Control": []string{"max-age=600"},
+		"Vary":          []string{"*"},
+	}}
+	if IsCacheable(resp) {
+		t.Error("expected Vary: * response to be uncacheable")
+	}
+}
+
+func TestDiskCache_VariantKeys(t *testing.T) {
+	c, _ := New(t.TempDir())
+	url := "http://example.com/docs"
+
+	request := func(lang string) *http.Request {
+		req, _ := http.NewRequest("GET", url, nil)
+		if lang != "" {
+			req.Header.Set("Accept-Language", lang)
+		}
+		return req
+	}
+
+	// Nothing recorded yet: the key is the bare URL.
+	if got := c.RequestKey(request("en")); got != url {
+		t.Errorf("RequestKey() = %q, want %q", got, url)
+	}
+
+	resp := htmlResponse(http.Header{"Vary": []string{"Accept-Language"}})
+	enKey := c.VariantKey(request("en"), resp)
+	deKey := c.VariantKey(request("de"), resp)
+	if enKey == deKey {
+		t.Fatal("expected different keys for different Accept-Language values")
+	}
+	c.Store(enKey, resp, []byte("<p>Hello</p>"), time.Hour)
+	c.Store(deKey, resp, []byte("<p>Hallo</p>"), time.Hour)
+
+	for lang, want := range map[string]string{"en": "<p>Hello</p>", "de": "<p>Hallo</p>"} {
+		entry, ok := c.Lookup(c.RequestKey(request(lang)))
+		if !ok {
+			t.Fatalf("%s: expected cache hit", lang)
+		}
+		if string(entry.Body) != want {
+			t.Errorf("%s: body = %q, want %q", lang, entry.Body, want)
+		}
+	}
+	if _, ok := c.Lookup(c.RequestKey(request("fr"))); ok {
+		t.Error("expected miss for an unseen variant")
+	}
+
+	// Insignificant whitespace selects the same variant.
+	if got := c.RequestKey(request(" en ")); got != enKey {
+		t.Errorf("RequestKey() = %q, want %q", got, enKey)
+	}
+
+	// Once the URL stops varying, the bare URL key is used again.
+	c.VariantKey(request("en"), htmlResponse(http.Header{}))
+	if got := c.RequestKey(request("en")); got != url {
+		t.Errorf("RequestKey() = %q, want %q", got, url)
+	}
+}
@@ -21,9 +21,10 @@ type Config struct {
 }
 
 type ProxyConfig struct {
-	Addr         string        `mapstructure:"addr"`
-	ReadTimeout  time.Duration `mapstructure:"read_timeout"`
-	WriteTimeout time.Duration `mapstructure:"write_timeout"`
+	Addr             string        `mapstructure:"addr"`
+	ReadTimeout      time.Duration `mapstructure:"read_timeout"`
+	WriteTimeout     time.Duration `mapstructure:"write_timeout"`
+	CoalesceRequests bool          `mapstructure:"coalesce_requests"`
 }
 
 type TLSConfig struct {
@@ -37,22 +38,44 @@ type TLSConfig struct {
 }
 
 type ConversionConfig struct {
-	Enabled          bool   `mapstructure:"enabled"`
-	TiktokenEncoding string `mapstructure:"tiktoken_encoding"`
-	NegotiateOnly    bool   `mapstructure:"negotiate_only"`
-	ConvertJSON      bool   `mapstructure:"convert_json"`
-	TemplateDir      string `mapstructure:"template_dir"`
+	Enabled          bool           `mapstructure:"enabled"`
+	TiktokenEncoding string         `mapstructure:"tiktoken_encoding"`
+	NegotiateOnly    bool           `mapstructure:"negotiate_only"`
+	ConvertJSON      bool           `mapstructure:"convert_json"`
+	TemplateDir      string         `mapstructure:"template_dir"`
+	Extract          string         `mapstructure:"extract"`
+	FrontMatter      bool           `mapstructure:"front_matter"`
+	RulesDir         string         `mapstructure:"rules_dir"`
+	Markdown         MarkdownConfig `mapstructure:"markdown"`
+	MaxFeedEntries   int            `mapstructure:"max_feed_entries"`
+	StructuredData   bool           `mapstructure:"structured_data"`
+	Compact          bool           `mapstructure:"compact"`
+}
+
+type MarkdownConfig struct {
+	HeadingStyle string `mapstructure:"heading_style"`
+	LinkStyle    string `mapstructure:"link_style"`
+	Bullet       string `mapstructure:"bullet"`
+	DropImages   bool   `mapstructure:"drop_images"`
+	RawTables    bool   `mapstructure:"raw_tables"`
 }
 
 type CacheConfig struct {
-	Enabled        bool   `mapstructure:"enabled"`
-	Dir            string `mapstructure:"dir"`
-	RespectHeaders bool   `mapstructure:"respect_headers"`
+	Enabled           bool          `mapstructure:"enabled"`
+	Dir               string        `mapstructure:"dir"`
+	RespectHeaders    bool          `mapstructure:"respect_headers"`
+	MaxBytes          int64         `mapstructure:"max_bytes"`
+	MaxEntries        int           `mapstructure:"max_entries"`
+	SweepInterval     time.Duration `mapstructure:"sweep_interval"`
+	ServeStaleOnError bool          `mapstructure:"serve_stale_on_error"`
+	StaleRetention    time.Duration `mapstructure:"stale_retention"`
+	Offline           bool          `mapstructure:"offline"`
 }
 
 type OutputConfig struct {
-	Enabled bool   `mapstructure:"enabled"`
-	Dir     string `mapstructure:"dir"`
+	Enabled     bool   `mapstructure:"enabled"`
+	Dir         string `mapstructure:"dir"`
+	FrontMatter bool   `mapstructure:"front_matter"`
 }
 
 type TransportConfig struct {
@@ -96,6 +119,7 @@ func Load(cfgFile string) (*Config, error) {
 	viper.SetDefault("proxy.addr", ":8080")
 	viper.SetDefault("proxy.read_timeout", "30s")
 	viper.SetDefault("proxy.write_timeout", "30s")
+	viper.SetDefault("proxy.coalesce_requests", true)
 	viper.SetDefault("tls.enabled", false)
 	viper.SetDefault("tls.auto_cert", true)
 	viper.SetDefault("tls.auto_cert_host", "localhost")
@@ -106,11 +130,29 @@ func Load(cfgFile string) (*Config, error) {
 	viper.SetDefault("conversion.negotiate_only", false)
 	viper.SetDefault("conversion.convert_json", false)
 	viper.SetDefault("conversion.template_dir", "")
+	viper.SetDefault("conversion.extract", "full")
+	viper.SetDefault("conversion.front_matter", false)
+	viper.SetDefault("conversion.rules_dir", "")
+	viper.SetDefault("conversion.markdown.heading_style", "atx")
+	viper.SetDefault("conversion.markdown.link_style", "inline")
+	viper.SetDefault("conversion.markdown.bullet", "-")
+	viper.SetDefault("conversion.markdown.drop_images", false)
+	viper.SetDefault("conversion.markdown.raw_tables", false)
+	viper.SetDefault("conversion.max_feed_entries", 0)
+	viper.SetDefault("conversion.structured_data", false)
+	viper.SetDefault("conversion.compact", false)
 	viper.SetDefault("max_body_size", 10485760)
 	viper.SetDefault("cache.enabled", false)
 	viper.SetDefault("cache.respect_headers", true)
+	viper.SetDefault("cache.max_bytes", 0)
+	viper.SetDefault("cache.max_entries", 0)
+	viper.SetDefault("cache.sweep_interval", "10m")
+	viper.SetDefault("cache.serve_stale_on_error", false)
+	viper.SetDefault("cache.stale_retention", "24h")
+	viper.SetDefault("cache.offline", false)
 	viper.SetDefault("output.enabled", false)
 	viper.SetDefault("output.dir", "")
+	viper.SetDefault("output.front_matter", true)
 	viper.SetDefault("log_level", "info")
 	viper.SetDefault("transport.type", "http")
 	viper.SetDefault("transport.chromedp.url", "http://localhost:9222")
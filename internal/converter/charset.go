@@ -0,0 +1,35 @@
+package converter
+
+import (
+	"bytes"
+	"regexp"
+
+	"golang.org/x/net/html/charset"
+)
+
+// byteOrderMark is U+FEFF in UTF-8.
+var byteOrderMark = []byte("\uFEFF")
+
+// xmlDeclEncoding matches the encoding of an XML declaration.
+var xmlDeclEncoding = regexp.MustCompile(`^\s*<\?xml[^>]*\sencoding\s*=\s*["']([A-Za-z0-9._:-]+)["']`)
+
+// ToUTF8 decodes body to UTF-8. The charset is taken from a byte order
+// mark, the charset parameter of contentType, an XML declaration or a
+// <meta> declaration, in that order, and otherwise sniffed: valid UTF-8 is
+// kept as is and anything else is read as windows-1252, as browsers do. The
+// byte order mark itself is dropped.
+func ToUTF8(body []byte, contentType string) ([]byte, error) {
+	enc, _, certain := charset.DetermineEncoding(body, contentType)
+	if !certain {
+		if m := xmlDeclEncoding.FindSubmatch(body); m != nil {
+			if e, _ := charset.Lookup(string(m[1])); e != nil {
+				enc = e
+			}
+		}
+	}
+	decoded, err := enc.NewDecoder().Bytes(body)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimPrefix(decoded, byteOrderMark), nil
+}
@@ -0,0 +1,75 @@
+package converter
+
+import (
+	"testing"
+)
+
+func TestToUTF8(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        []byte
+		contentType string
+		want        string
+	}{
+		{
+			name:        "content type charset",
+			body:        []byte("<p>caf\xe9</p>"),
+			contentType: "text/html; charset=ISO-8859-1",
+			want:        "<p>café</p>",
+		},
+		{
+			name:        "meta charset",
+			body:        []byte(`<meta charset="shift_jis"><p>` + "\x93\xfa\x96\x7b" + `</p>`),
+			contentType: "text/html",
+			want:        `<meta charset="shift_jis"><p>日本</p>`,
+		},
+		{
+			name:        "http-equiv content type",
+			body:        []byte(`<meta http-equiv="Content-Type" content="text/html; charset=gbk"><p>` + "\xd6\xd0\xce\xc4" + `</p>`),
+			contentType: "text/html",
+			want:        `<meta http-equiv="Content-Type" content="text/html; charset=gbk"><p>中文</p>`,
+		},
+		{
+			name:        "byte order mark wins",
+			body:        []byte("\xef\xbb\xbf<p>café</p>"),
+			contentType: "text/html; charset=iso-8859-1",
+			want:        "<p>café</p>",
+		},
+		{
+			name:        "utf-8 json",
+			body:        []byte(`{"name":"café"}`),
+			contentType: "application/json",
+			want:        `{"name":"café"}`,
+		},
+		{
+			name:        "json charset",
+			body:        []byte("{\"name\":\"caf\xe9\"}"),
+			contentType: "application/json; charset=latin1",
+			want:        `{"name":"café"}`,
+		},
+		{
+			name:        "xml declaration",
+			body:        []byte(`<?xml version="1.0" encoding="Shift_JIS"?><title>` + "\x93\xfa\x96\x7b" + `</title>`),
+			contentType: "application/rss+xml",
+			want:        `<?xml version="1.0" encoding="Shift_JIS"?><title>日本</title>`,
+		},
+		{
+			name:        "undeclared legacy bytes",
+			body:        []byte("<p>caf\xe9</p>"),
+			contentType: "text/html",
+			want:        "<p>café</p>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ToUTF8(tt.body, tt.contentType)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("ToUTF8 = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,326 @@
+package converter
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// codeWrapperDepth is how many ancestors of a <pre> are searched for its
+// language, covering wrappers like Rouge's
+// <div class="language-ruby"><div class="highlight"><pre>.
+const codeWrapperDepth = 2
+
+// gutterClasses are the class names syntax highlighters give line-number
+// gutters: Pygments, Rouge, Chroma (Hugo), Prism and highlightjs-line-numbers.
+var gutterClasses = map[string]bool{
+	"linenos":           true,
+	"linenodiv":         true,
+	"lineno":            true,
+	"line-numbers-rows": true,
+	"rouge-gutter":      true,
+	"gutter":            true,
+	"ln":                true,
+	"lnt":               true,
+	"hljs-ln-numbers":   true,
+}
+
+// codeTableClasses are the class names highlighters give tables that lay
+// out a code block next to its line-number gutter: Pygments, Rouge, Chroma
+// (Hugo) and highlightjs-line-numbers.
+var codeTableClasses = map[string]bool{
+	"highlighttable": true,
+	"rouge-table":    true,
+	"lntable":        true,
+	"hljs-ln":        true,
+}
+
+// lineClasses are the class names of elements holding one line of
+// highlighted code, which not every highlighter separates with newlines.
+var lineClasses = map[string]bool{
+	"line":         true,
+	"token-line":   true,
+	"code-line":    true,
+	"hljs-ln-line": true,
+}
+
+// cleanCodeBlocks rewrites the code blocks of doc as plain
+// <pre><code class="language-x"> elements so they convert to clean fenced
+// blocks: the language is taken from the class conventions of common
+// highlighters, highlight markup is flattened to text, and line-number
+// gutters and copy buttons are removed.
+func cleanCodeBlocks(doc *html.Node) {
+	var tables, pres []*html.Node
+	walkElements(doc, func(n *html.Node) {
+		switch n.DataAtom {
+		case atom.Table:
+			tables = append(tables, n)
+		case atom.Pre:
+			pres = append(pres, n)
+		}
+	})
+	for _, t := range tables {
+		unwrapCodeTable(t)
+	}
+	for _, pre := range pres {
+		if pre.Parent == nil {
+			continue // a gutter removed with its table cell
+		}
+		cleanCodeBlock(pre)
+	}
+}
+
+// unwrapCodeTable replaces a table that lays out a code block next to its
+// line-number gutter with the code block. Only tables a highlighter marks
+// as such are unwrapped, and only when they hold nothing but the gutter
+// and the code, so no content is lost.
+func unwrapCodeTable(table *html.Node) {
+	if !hasClass(table, codeTableClasses) || table.Parent == nil {
+		return
+	}
+	var code, gutters, others []*html.Node
+	walkElements(table, func(n *html.Node) {
+		if n.DataAtom != atom.Td && n.DataAtom != atom.Th {
+			return
+		}
+		pre := findElement(n, atom.Pre)
+		switch {
+		case isGutter(n) || (pre != nil && isLineNumbers(innerText(n))):
+			gutters = append(gutters, n)
+		case pre != nil:
+			code = append(code, n)
+		default:
+			others = append(others, n)
+		}
+	})
+	if len(code) != 1 || len(gutters) == 0 || len(others) > 0 {
+		return
+	}
+	for c := code[0].FirstChild; c != nil; {
+		next := c.NextSibling
+		code[0].RemoveChild(c)
+		table.Parent.InsertBefore(c, table)
+		c = next
+	}
+	table.Parent.RemoveChild(table)
+}
+
+// cleanCodeBlock rewrites one <pre> element.
+func cleanCodeBlock(pre *html.Node) {
+	lang := codeLanguage(pre)
+	walkElements(pre, func(n *html.Node) {
+		if lang == "" && n.DataAtom == atom.Code {
+			lang = codeLanguage(n)
+		}
+	})
+	for depth, n := 0, pre.Parent; lang == "" && depth < codeWrapperDepth && n != nil && n.Type == html.ElementNode && n.DataAtom != atom.Body; depth, n = depth+1, n.Parent {
+		lang = codeLanguage(n)
+	}
+
+	removeCopyControls(pre)
+	text := codeText(pre)
+
+	for c := pre.FirstChild; c != nil; c = pre.FirstChild {
+		pre.RemoveChild(c)
+	}
+	pre.Attr = nil
+	code := &html.Node{Type: html.ElementNode, Data: "code", DataAtom: atom.Code}
+	if lang != "" {
+		code.Attr = []html.Attribute{{Key: "class", Val: "language-" + lang}}
+	}
+	code.AppendChild(&html.Node{Type: html.TextNode, Data: text})
+	pre.AppendChild(code)
+}
+
+// codeLanguage returns the language an element's attributes name, or "".
+// It recognizes language-x and lang-x classes (Prism, highlight.js,
+// CommonMark renderers), highlight-source-x (GitHub), highlight-x
+// (Sphinx), Pandoc's "sourceCode x", and data-lang and data-language
+// attributes (Chroma, Shiki).
+func codeLanguage(n *html.Node) string {
+	for _, key := range []string{"data-lang", "data-language"} {
+		if lang := normalizeLanguage(attr(n, key)); lang != "" {
+			return lang
+		}
+	}
+	classes := strings.Fields(attr(n, "class"))
+	for i, class := range classes {
+		var lang string
+		switch {
+		case strings.HasPrefix(class, "language-"):
+			lang = strings.TrimPrefix(class, "language-")
+		case strings.HasPrefix(class, "lang-"):
+			lang = strings.TrimPrefix(class, "lang-")
+		case strings.HasPrefix(class, "highlight-source-"), strings.HasPrefix(class, "highlight-text-"):
+			// GitHub names TextMate scopes: highlight-text-html-basic.
+			_, scope, _ := strings.Cut(strings.TrimPrefix(class, "highlight-"), "-")
+			lang, _, _ = strings.Cut(scope, "-")
+		case strings.HasPrefix(class, "highlight-"):
+			lang = strings.TrimPrefix(class, "highlight-")
+		case class == "sourceCode" && i+1 < len(classes):
+			lang = classes[i+1]
+		}
+		if lang = normalizeLanguage(lang); lang != "" {
+			return lang
+		}
+	}
+	return ""
+}
+
+// normalizeLanguage lowercases a language name, returning "" for names
+// that mean no highlighting.
+func normalizeLanguage(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	switch lang {
+	case "none", "nohighlight", "default", "plain", "plaintext":
+		return ""
+	}
+	if strings.ContainsAny(lang, " `") {
+		return ""
+	}
+	return lang
+}
+
+// removeCopyControls removes the copy buttons highlighters put inside a
+// code block or next to it in a wrapper that holds nothing else.
+func removeCopyControls(pre *html.Node) {
+	var controls []*html.Node
+	walkElements(pre, func(n *html.Node) {
+		if isCopyControl(n) {
+			controls = append(controls, n)
+		}
+	})
+	controls = append(controls, wrapperControls(pre)...)
+	for _, n := range controls {
+		if n.Parent != nil {
+			n.Parent.RemoveChild(n)
+		}
+	}
+}
+
+// wrapperControls returns the copy controls next to pre when its parent
+// wraps the code block alone, and nil otherwise.
+func wrapperControls(pre *html.Node) []*html.Node {
+	parent := pre.Parent
+	if parent == nil || parent.DataAtom == atom.Body {
+		return nil
+	}
+	var controls []*html.Node
+	for c := parent.FirstChild; c != nil; c = c.NextSibling {
+		switch {
+		case c == pre || c.Type == html.CommentNode:
+		case c.Type == html.ElementNode && controlsOnly(c):
+			controls = append(controls, c)
+		case innerText(c) != "":
+			return nil
+		}
+	}
+	return controls
+}
+
+// isCopyControl reports whether n is a button, or is named like a copy or
+// clipboard control.
+func isCopyControl(n *html.Node) bool {
+	if n.DataAtom == atom.Button || n.Data == "clipboard-copy" {
+		return true
+	}
+	for _, class := range strings.Fields(strings.ToLower(attr(n, "class"))) {
+		if (strings.Contains(class, "copy") && !strings.Contains(class, "copyright")) || strings.Contains(class, "clipboard") {
+			return true
+		}
+	}
+	return false
+}
+
+// controlsOnly reports whether n is a copy control or holds some and no
+// other text, like a wrapper around a copy button.
+func controlsOnly(n *html.Node) bool {
+	if isCopyControl(n) {
+		return true
+	}
+	found := false
+	var text strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			switch {
+			case c.Type == html.TextNode:
+				text.WriteString(c.Data)
+			case c.Type == html.ElementNode && isCopyControl(c):
+				found = true
+			default:
+				walk(c)
+			}
+		}
+	}
+	walk(n)
+	return found && strings.TrimSpace(text.String()) == ""
+}
+
+// isGutter reports whether n is a line-number gutter.
+func isGutter(n *html.Node) bool {
+	return hasClass(n, gutterClasses)
+}
+
+// hasClass reports whether n has one of classes.
+func hasClass(n *html.Node, classes map[string]bool) bool {
+	for _, class := range strings.Fields(attr(n, "class")) {
+		if classes[class] {
+			return true
+		}
+	}
+	return false
+}
+
+// isLineNumbers reports whether text is a run of line numbers.
+func isLineNumbers(text string) bool {
+	fields := strings.Fields(text)
+	for _, f := range fields {
+		if strings.Trim(f, "0123456789") != "" {
+			return false
+		}
+	}
+	return len(fields) > 0
+}
+
+// codeText returns the text of a code block without its gutters, starting
+// each line element and <div> on a new line.
+func codeText(pre *html.Node) string {
+	var b strings.Builder
+	newline := func() {
+		if b.Len() > 0 && !strings.HasSuffix(b.String(), "\n") {
+			b.WriteByte('\n')
+		}
+	}
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			switch c.Type {
+			case html.TextNode:
+				b.WriteString(c.Data)
+				continue
+			case html.ElementNode:
+			default:
+				continue
+			}
+			if isGutter(c) || c.DataAtom == atom.Script || c.DataAtom == atom.Style {
+				continue
+			}
+			if c.DataAtom == atom.Br {
+				b.WriteByte('\n')
+				continue
+			}
+			line := c.DataAtom == atom.Div || c.DataAtom == atom.Tr
+			for _, class := range strings.Fields(attr(c, "class")) {
+				line = line || lineClasses[class]
+			}
+			if line {
+				newline()
+			}
+			walk(c)
+		}
+	}
+	walk(pre)
+	return b.String()
+}
@@ -0,0 +1,137 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHTMLToMarkdown_CodeBlocks(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{
+			name: "language class",
+			html: `<pre><code class="language-go">fmt.Println("hi")</code></pre>`,
+			want: "```go\nfmt.Println(\"hi\")\n```",
+		},
+		{
+			name: "prism tokens and line numbers",
+			html: `<pre class="line-numbers language-js"><code class="language-js"><span class="token keyword">const</span> a <span class="token operator">=</span> <span class="token number">1</span><span aria-hidden="true" class="line-numbers-rows"><span></span></span></code></pre>`,
+			want: "```js\nconst a = 1\n```",
+		},
+		{
+			name: "github wrapper and clipboard",
+			html: `<div class="highlight highlight-source-python notranslate position-relative"><pre><span class="pl-k">def</span> <span class="pl-en">f</span>():
+    <span class="pl-k">pass</span></pre><div class="zeroclipboard-container"><clipboard-copy aria-label="Copy" value="def f()"></clipboard-copy></div></div>`,
+			want: "```python\ndef f():\n    pass\n```",
+		},
+		{
+			name: "github text scope",
+			html: `<div class="highlight highlight-text-html-basic"><pre>&lt;p&gt;hi&lt;/p&gt;</pre></div>`,
+			want: "```html\n<p>hi</p>\n```",
+		},
+		{
+			name: "shiki lines",
+			html: `<pre class="shiki github-dark" tabindex="0"><code><span class="line"><span style="color:#F97583">let</span><span style="color:#E1E4E8"> x</span></span>
+<span class="line"><span style="color:#E1E4E8">x</span></span></code></pre>`,
+			want: "```\nlet x\nx\n```",
+		},
+		{
+			name: "shiki data-language",
+			html: `<pre data-language="rust"><code><span class="line">fn main() {}</span></code></pre>`,
+			want: "```rust\nfn main() {}\n```",
+		},
+		{
+			name: "docusaurus line divs and copy button",
+			html: `<div class="codeBlockContent"><pre class="prism-code language-bash"><code class="codeBlockLines"><div class="token-line"><span class="token plain">npm install</span></div><div class="token-line"><span class="token plain">npm start</span></div></code></pre><div class="buttonGroup"><button type="button" aria-label="Copy code to clipboard" class="clean-btn"><svg></svg></button></div></div>`,
+			want: "```bash\nnpm install\nnpm start\n```",
+		},
+		{
+			name: "sphinx wrapper and copy button",
+			html: `<div class="highlight-python notranslate"><div class="highlight"><pre><span></span><span class="n">x</span> <span class="o">=</span> <span class="mi">1</span>
+</pre><button class="copybtn">Copy</button></div></div>`,
+			want: "```python\nx = 1\n```",
+		},
+		{
+			name: "pygments gutter table",
+			html: `<div class="highlight"><table class="highlighttable"><tr><td class="linenos"><div class="linenodiv"><pre>1
+2</pre></div></td><td class="code"><div class="highlight"><pre><code class="language-ruby">a = 1
+b = 2</code></pre></div></td></tr></table></div>`,
+			want: "```ruby\na = 1\nb = 2\n```",
+		},
+		{
+			name: "hugo table gutter",
+			html: `<div class="highlight"><div class="chroma"><table class="lntable"><tr><td class="lntd"><pre tabindex="0" class="chroma"><code><span class="lnt">1
+</span><span class="lnt">2
+</span></code></pre></td><td class="lntd"><pre tabindex="0" class="chroma"><code class="language-go" data-lang="go"><span class="line"><span class="cl"><span class="kn">package</span> <span class="nx">main</span>
+</span></span><span class="line"><span class="cl"><span class="kd">func</span> <span class="nf">main</span><span class="p">()</span> <span class="p">{}</span>
+</span></span></code></pre></td></tr></table></div></div>`,
+			want: "```go\npackage main\nfunc main() {}\n```",
+		},
+		{
+			name: "rouge gutter table",
+			html: `<div class="language-python highlighter-rouge"><div class="highlight"><pre class="highlight"><code><table class="rouge-table"><tbody><tr><td class="rouge-gutter gl"><pre class="lineno">1
+2</pre></td><td class="rouge-code"><pre>x = 1
+y = 2</pre></td></tr></tbody></table></code></pre></div></div>`,
+			want: "```python\nx = 1\ny = 2\n```",
+		},
+		{
+			name: "hugo inline line numbers",
+			html: `<pre class="chroma"><code class="language-sh" data-lang="sh"><span class="line"><span class="ln">1</span><span class="cl">ls
+</span></span><span class="line"><span class="ln">2</span><span class="cl">pwd
+</span></span></code></pre>`,
+			want: "```sh\nls\npwd\n```",
+		},
+		{
+			name: "rouge wrapper",
+			html: `<div class="language-ruby highlighter-rouge"><div class="highlight"><pre class="highlight"><code><span class="nb">puts</span> <span class="s2">"hi"</span>
+</code></pre></div></div>`,
+			want: "```ruby\nputs \"hi\"\n```",
+		},
+		{
+			name: "pandoc source code",
+			html: `<div class="sourceCode" id="cb1"><pre class="sourceCode haskell"><code class="sourceCode haskell"><span id="cb1-1"><a href="#cb1-1"></a>main <span class="ot">=</span> <span class="fu">print</span> <span class="dv">1</span></span></code></pre></div>`,
+			want: "```haskell\nmain = print 1\n```",
+		},
+		{
+			name: "no highlighting",
+			html: `<pre><code class="nohighlight">plain text</code></pre>`,
+			want: "```\nplain text\n```",
+		},
+		{
+			name: "buttons outside code wrappers kept",
+			html: `<div><p>Intro</p><pre><code>x</code></pre><button>Subscribe</button></div>`,
+			want: "Intro\n\n```\nx\n```\n\nSubscribe",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := HTMLToMarkdown(tt.html)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTMLToMarkdown_TableWithCodeKept(t *testing.T) {
+	// A layout table with a "gutter" cell and a numeric output is not a
+	// highlighter's gutter table, so none of it may be dropped.
+	html := `<table><tr><td class="gutter">Step 1</td><td><pre>print(6 * 7)</pre></td></tr>
+<tr><td>Output</td><td><pre>42</pre></td></tr><tr><td>Notes</td><td>Prints the answer.</td></tr></table>`
+	got, err := HTMLToMarkdown(html)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{"Step 1", "print(6 * 7)", "Output", "42", "Notes", "Prints the answer."} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package converter
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// compactURLLength is the destination length above which Compact moves a
+// link or image URL to a reference definition at the end of the document.
+const compactURLLength = 80
+
+var (
+	// markdownLink matches an inline link or image: [text](url "title").
+	// Link text may hold escaped characters and images, as in linked
+	// images.
+	markdownLink = regexp.MustCompile(`(!?)\[((?:\\.|[^\[\]\\]|!\[(?:\\.|[^\[\]\\])*\]\([^)]*\))*)\]\((<[^>]*>|[^()\s]+)((?:\s+"(?:\\.|[^"\\])*")?)\)`)
+	// referenceLink matches a numbered reference link or image: [text][1].
+	referenceLink = regexp.MustCompile(`(!?)\[((?:\\.|[^\[\]\\])*)\]\[(\d+)\]`)
+	// referenceDefinition matches a numbered link reference definition.
+	referenceDefinition = regexp.MustCompile(`^\[(\d+)\]: (<[^>]*>|\S+)(.*)$`)
+	// listMarker matches the marker of a list item.
+	listMarker = regexp.MustCompile(`^\s*(?:[-*+]|\d+[.)])\s+`)
+	// linkSeparators are the characters navigation lists put between links.
+	linkSeparators = regexp.MustCompile(`[\s|·•/,>»]+`)
+	// blankLines matches a run of blank lines.
+	blankLines = regexp.MustCompile(`\n{3,}`)
+)
+
+// Compact shrinks Markdown to save tokens without losing its content: data
+// URIs are dropped, keeping image alt text; utm_* tracking parameters are
+// removed from URLs; lines of links repeated from earlier in the document,
+// like a navigation menu in both header and footer, are dropped, and
+// repeated links are reduced to their text; URLs longer than
+// compactURLLength become numbered references listed at the end; and
+// trailing whitespace and runs of blank lines are trimmed. Code blocks and
+// code spans are left as they are.
+func Compact(md string) string {
+	c := &compactor{refs: map[string]int{}, seen: map[string]bool{}}
+	md = c.mask(md)
+
+	var lines []string
+	seenLines := map[string]bool{}
+	for _, line := range strings.Split(md, "\n") {
+		if m := referenceDefinition.FindStringSubmatch(line); m != nil {
+			if line = c.definition(m); line == "" {
+				continue
+			}
+		} else if linksOnly(line) {
+			key := strings.TrimSpace(line)
+			if seenLines[key] {
+				continue
+			}
+			seenLines[key] = true
+		}
+		lines = append(lines, line)
+	}
+	md = strings.Join(lines, "\n")
+
+	md = markdownLink.ReplaceAllStringFunc(md, c.link)
+	md = referenceLink.ReplaceAllStringFunc(md, func(s string) string {
+		m := referenceLink.FindStringSubmatch(s)
+		if c.dropped[m[3]] {
+			return m[2]
+		}
+		return s
+	})
+
+	lines = lines[:0]
+	for _, line := range strings.Split(md, "\n") {
+		// Trailing whitespace goes, except two-space hard line breaks.
+		if trimmed := strings.TrimRight(line, " \t"); trimmed == "" || line != trimmed+"  " {
+			line = trimmed
+		}
+		if listMarker.MatchString(line) && strings.TrimSpace(listMarker.ReplaceAllString(line, "")) == "" {
+			continue // emptied list item
+		}
+		lines = append(lines, line)
+	}
+	md = strings.TrimSpace(blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+
+	if len(c.defs) > 0 {
+		md += "\n\n" + strings.Join(c.defs, "\n")
+	}
+	return c.unmask(md)
+}
+
+// compactor holds the state of one Compact call.
+type compactor struct {
+	// code holds the code blocks and spans replaced with placeholders.
+	code []string
+	// maxRef is the highest reference number in the document.
+	maxRef int
+	// refs numbers the references Compact adds, by destination; defs
+	// holds their definitions.
+	refs map[string]int
+	defs []string
+	// dropped holds the numbers of reference definitions removed for
+	// pointing at data URIs.
+	dropped map[string]bool
+	// seen holds the links already written, by text and destination.
+	seen map[string]bool
+}
+
+// mask replaces fenced code blocks and code spans with placeholders, so
+// compaction leaves them alone, and notes the highest reference number in
+// use.
+func (c *compactor) mask(md string) string {
+	placeholder := func(code string) string {
+		c.code = append(c.code, code)
+		return "\x00" + strconv.Itoa(len(c.code)-1) + "\x00"
+	}
+
+	var out []string
+	var block []string
+	fence := ""
+	for _, line := range strings.Split(md, "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if fence != "" {
+			block = append(block, line)
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]+" \t") == "" {
+				out = append(out, placeholder(strings.Join(block, "\n")))
+				block, fence = nil, ""
+			}
+			continue
+		}
+		if f := codeFence(trimmed); f != "" && len(line)-len(trimmed) < 4 {
+			fence = f
+			block = []string{line}
+			continue
+		}
+		if m := referenceDefinition.FindStringSubmatch(line); m != nil {
+			if n, _ := strconv.Atoi(m[1]); n > c.maxRef {
+				c.maxRef = n
+			}
+		}
+		out = append(out, maskCodeSpans(line, placeholder))
+	}
+	if fence != "" {
+		// An unclosed fence runs to the end of the document.
+		out = append(out, placeholder(strings.Join(block, "\n")))
+	}
+	return strings.Join(out, "\n")
+}
+
+// unmask restores the code masked by mask.
+func (c *compactor) unmask(md string) string {
+	for i, code := range c.code {
+		md = strings.Replace(md, "\x00"+strconv.Itoa(i)+"\x00", code, 1)
+	}
+	return md
+}
+
+// codeFence returns the fence opening a fenced code block on line, or "".
+func codeFence(line string) string {
+	for _, ch := range []string{"`", "~"} {
+		n := len(line) - len(strings.TrimLeft(line, ch))
+		if n >= 3 && (ch == "~" || !strings.Contains(line[n:], "`")) {
+			return line[:n]
+		}
+	}
+	return ""
+}
+
+// maskCodeSpans replaces the code spans in line using placeholder.
+func maskCodeSpans(line string, placeholder func(string) string) string {
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(line, '`')
+		if start < 0 {
+			b.WriteString(line)
+			return b.String()
+		}
+		n := len(line[start:]) - len(strings.TrimLeft(line[start:], "`"))
+		// The span ends at the next run of as many backticks.
+		end := -1
+		for i := start + n; i < len(line); {
+			if line[i] != '`' {
+				i++
+				continue
+			}
+			j := i
+			for j < len(line) && line[j] == '`' {
+				j++
+			}
+			if j-i == n {
+				end = j
+				break
+			}
+			i = j
+		}
+		if end < 0 {
+			// An unmatched run of backticks is literal text.
+			b.WriteString(line[:start+n])
+			line = line[start+n:]
+			continue
+		}
+		b.WriteString(line[:start])
+		b.WriteString(placeholder(line[start:end]))
+		line = line[end:]
+	}
+}
+
+// definition compacts a reference definition line. Definitions of data
+// URIs are dropped, returning "".
+func (c *compactor) definition(m []string) string {
+	dest := strings.TrimSuffix(strings.TrimPrefix(m[2], "<"), ">")
+	if isDataURI(dest) {
+		if c.dropped == nil {
+			c.dropped = map[string]bool{}
+		}
+		c.dropped[m[1]] = true
+		return ""
+	}
+	return "[" + m[1] + "]: " + wrapDestination(stripTracking(dest)) + m[3]
+}
+
+// link compacts an inline link or image.
+func (c *compactor) link(s string) string {
+	m := markdownLink.FindStringSubmatch(s)
+	image, text, title := m[1] == "!", m[2], m[4]
+	dest := strings.TrimSuffix(strings.TrimPrefix(m[3], "<"), ">")
+	if !image {
+		// Compact the images inside linked images too.
+		text = markdownLink.ReplaceAllStringFunc(text, c.link)
+	}
+	if isDataURI(dest) {
+		return text
+	}
+	dest = stripTracking(dest)
+
+	key := m[1] + text + "\x00" + dest
+	if c.seen[key] {
+		return text
+	}
+	c.seen[key] = true
+
+	if len(dest) <= compactURLLength {
+		return m[1] + "[" + text + "](" + wrapDestination(dest) + title + ")"
+	}
+	def := wrapDestination(dest) + title
+	n, ok := c.refs[def]
+	if !ok {
+		n = c.maxRef + len(c.defs) + 1
+		c.refs[def] = n
+		c.defs = append(c.defs, "["+strconv.Itoa(n)+"]: "+def)
+	}
+	return m[1] + "[" + text + "][" + strconv.Itoa(n) + "]"
+}
+
+// linksOnly reports whether line, apart from a list marker and separators,
+// holds nothing but links and images.
+func linksOnly(line string) bool {
+	rest := listMarker.ReplaceAllString(line, "")
+	if !markdownLink.MatchString(rest) && !referenceLink.MatchString(rest) {
+		return false
+	}
+	rest = markdownLink.ReplaceAllString(rest, "")
+	rest = referenceLink.ReplaceAllString(rest, "")
+	return linkSeparators.ReplaceAllString(rest, "") == ""
+}
+
+// isDataURI reports whether dest is a data: URI.
+func isDataURI(dest string) bool {
+	return len(dest) >= 5 && strings.EqualFold(dest[:5], "data:")
+}
+
+// stripTracking removes the utm_* query parameters from a URL.
+func stripTracking(dest string) string {
+	rest, fragment, hasFragment := strings.Cut(dest, "#")
+	base, query, ok := strings.Cut(rest, "?")
+	if !ok {
+		return dest
+	}
+	var params []string
+	for _, p := range strings.Split(query, "&") {
+		if !strings.HasPrefix(strings.ToLower(p), "utm_") {
+			params = append(params, p)
+		}
+	}
+	if len(params) > 0 {
+		base += "?" + strings.Join(params, "&")
+	}
+	if hasFragment {
+		base += "#" + fragment
+	}
+	return base
+}
+
+// wrapDestination wraps a link destination in angle brackets when it
+// holds characters that would end it.
+func wrapDestination(dest string) string {
+	if strings.ContainsAny(dest, " ()") {
+		return "<" + dest + ">"
+	}
+	return dest
+}
@@ -0,0 +1,77 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompact(t *testing.T) {
+	long := "https://example.com/articles/2024/05/a-very-long-article-slug-that-goes-on-and-on?id=12345"
+	tests := []struct {
+		name string
+		md   string
+		want string
+	}{
+		{
+			name: "data URIs",
+			md:   "Logo ![Company logo](data:image/png;base64,iVBORw0KGgo=) and ![](data:image/gif;base64,R0lGOD==) end [file](data:text/plain,hi)",
+			want: "Logo Company logo and  end file",
+		},
+		{
+			name: "tracking parameters",
+			md:   "[a](https://example.com/p?utm_source=x&id=1&UTM_Medium=y#top) [b](https://example.com/?utm_campaign=z)",
+			want: "[a](https://example.com/p?id=1#top) [b](https://example.com/)",
+		},
+		{
+			name: "repeated link lines",
+			md:   "- [Home](/)\n- [Docs](/docs)\n\n# Guide\n\nSee [Docs](/docs) and [Docs](/docs).\n\n- [Home](/)\n- [Docs](/docs)\n- [Blog](/blog)",
+			want: "- [Home](/)\n- [Docs](/docs)\n\n# Guide\n\nSee Docs and Docs.\n\n- [Blog](/blog)",
+		},
+		{
+			name: "long URLs",
+			md:   "Read [this](" + long + ") and [that](" + long + " \"Title\").\n\n[1]: https://example.com/kept?utm_source=feed",
+			want: "Read [this][2] and [that][3].\n\n[1]: https://example.com/kept\n\n[2]: " + long + "\n[3]: " + long + " \"Title\"",
+		},
+		{
+			name: "linked image",
+			md:   "[![Badge](data:image/svg+xml;base64,PHN2Zz4=)](https://ci.example.com/?utm_source=badge)",
+			want: "[Badge](https://ci.example.com/)",
+		},
+		{
+			name: "reference to data URI",
+			md:   "A [pixel][1] here.\n\n[1]: data:image/gif;base64,R0lGOD==\n[2]: /kept",
+			want: "A pixel here.\n\n[2]: /kept",
+		},
+		{
+			name: "whitespace",
+			md:   "\n\nTitle   \n\n\n\n\nline one  \nline two\t\n\n-  \n\n\nend\n\n",
+			want: "Title\n\nline one  \nline two\n\nend",
+		},
+		{
+			name: "code left alone",
+			md:   "Use `[x](https://e.com/?utm_source=a)`:\n\n```md\n[x](https://e.com/?utm_source=a)\n\n\n\n![p](data:image/png;base64,AA==)\n```\n\n[x](https://e.com/?utm_source=a)",
+			want: "Use `[x](https://e.com/?utm_source=a)`:\n\n```md\n[x](https://e.com/?utm_source=a)\n\n\n\n![p](data:image/png;base64,AA==)\n```\n\n[x](https://e.com/)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Compact(tt.md); got != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompact_ConvertedPage(t *testing.T) {
+	nav := `<ul><li><a href="/">Home</a></li><li><a href="/pricing?utm_source=nav">Pricing</a></li></ul>`
+	md, err := HTMLToMarkdown(`<header>` + nav + `</header><main><h1>Post</h1><p>Body <img src="data:image/png;base64,` + strings.Repeat("A", 4000) + `" alt="chart"></p></main><footer>` + nav + `</footer>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := Compact(md)
+	want := "- [Home](/)\n- [Pricing](/pricing)\n\n# Post\n\nBody chart"
+	if got != want {
+		t.Errorf("got:\n%q\nwant:\n%q", got, want)
+	}
+}
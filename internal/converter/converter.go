@@ -3,20 +3,90 @@ package converter
 import (
 	"strings"
 
-	htmltomarkdown "github.com/JohannesKaufmann/html-to-markdown/v2"
+	"golang.org/x/net/html"
 )
 
-// HTMLToMarkdown converts an HTML string to Markdown.
+// Version identifies the conversion output format. Bump it whenever a change
+// alters the Markdown produced for the same input, so cached conversions
+// from older builds are not served.
+const Version = "8"
+
+// Extraction modes for Options.Extract.
+const (
+	// ExtractFull converts the whole document.
+	ExtractFull = "full"
+	// ExtractArticle converts only the main content of the document, found
+	// by Readability-style scoring.
+	ExtractArticle = "article"
+)
+
+// Options controls how HTML is converted to Markdown.
+type Options struct {
+	// Extract selects the part of the document to convert: ExtractFull
+	// (the default when empty) or ExtractArticle.
+	Extract string
+	// BaseURL is the URL the document was fetched from. When set, relative
+	// link and image URLs are made absolute against it, honoring
+	// <base href>.
+	BaseURL string
+	// Selectors, when set, remove unwanted elements before conversion and
+	// pick the elements to convert. Matching include selectors take
+	// precedence over ExtractArticle.
+	Selectors *Selectors
+	// Markdown sets the style of the Markdown written.
+	Markdown MarkdownOptions
+}
+
+// ValidExtract reports whether mode is a known extraction mode.
+func ValidExtract(mode string) bool {
+	return mode == "" || mode == ExtractFull || mode == ExtractArticle
+}
+
+// HTMLToMarkdown converts an HTML string to Markdown with the default
+// options.
 func HTMLToMarkdown(html string) (string, error) {
-	md, err := htmltomarkdown.ConvertString(html)
+	return ConvertHTML(html, Options{})
+}
+
+// ConvertHTML converts an HTML string to Markdown according to opts. In
+// ExtractArticle mode, documents without a recognizable main content block
+// are converted whole.
+func ConvertHTML(htmlStr string, opts Options) (string, error) {
+	doc, err := parse(htmlStr, opts)
 	if err != nil {
 		return "", err
 	}
-	return strings.TrimSpace(md), nil
+	node := doc
+	if included := opts.Selectors.included(doc); included != nil {
+		node = included
+	} else if opts.Extract == ExtractArticle {
+		if node = extractArticle(doc); node == nil {
+			// Extraction prunes the document as it goes.
+			if node, err = parse(htmlStr, opts); err != nil {
+				return "", err
+			}
+		}
+	}
+	return opts.Markdown.convert(node)
+}
+
+// parse parses an HTML document and applies the DOM rewrites opts ask for.
+func parse(htmlStr string, opts Options) (*html.Node, error) {
+	doc, err := html.Parse(strings.NewReader(htmlStr))
+	if err != nil {
+		return nil, err
+	}
+	if opts.BaseURL != "" {
+		resolveURLs(doc, opts.BaseURL)
+	}
+	opts.Selectors.removeExcluded(doc)
+	normalizeMath(doc)
+	cleanCodeBlocks(doc)
+	return doc, nil
 }
 
-// IsHTMLContentType returns true if the content type header indicates HTML.
+// IsHTMLContentType returns true if the content type header indicates HTML,
+// as the Default registry sees it.
 func IsHTMLContentType(ct string) bool {
-	ct = strings.ToLower(ct)
-	return strings.Contains(ct, "text/html")
+	return Default.Lookup(ct) == HTMLConverter
 }
@@ -114,3 +114,63 @@ func BenchmarkHTMLToMarkdown_Complex(b *testing.B) {
 		HTMLToMarkdown(html)
 	}
 }
+
+func TestConvertHTML_BaseURL(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want []string
+	}{
+		{
+			name: "relative to page",
+			html: `<a href="../guide/setup">Setup</a> <img src="/img/a.png" alt="A"> <a href="#usage">Usage</a>`,
+			want: []string{
+				"[Setup](https://example.com/docs/guide/setup)",
+				"![A](https://example.com/img/a.png)",
+				"[Usage](https://example.com/docs/v2/intro#usage)",
+			},
+		},
+		{
+			name: "base href",
+			html: `<html><head><base href="https://cdn.example.org/assets/"></head><body><a href="page.html">Page</a> <img src="logo.png" alt="Logo"></body></html>`,
+			want: []string{
+				"[Page](https://cdn.example.org/assets/page.html)",
+				"![Logo](https://cdn.example.org/assets/logo.png)",
+			},
+		},
+		{
+			name: "relative base href",
+			html: `<html><head><base href="/static/"></head><body><a href="x/y">Y</a></body></html>`,
+			want: []string{"[Y](https://example.com/static/x/y)"},
+		},
+		{
+			name: "absolute and other schemes untouched",
+			html: `<a href="https://other.org/p">P</a> <a href="mailto:a@example.com">Mail</a>`,
+			want: []string{"[P](https://other.org/p)", "[Mail](mailto:a@example.com)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md, err := ConvertHTML(tt.html, Options{BaseURL: "https://example.com/docs/v2/intro"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(md, want) {
+					t.Errorf("expected markdown to contain %q, got %q", want, md)
+				}
+			}
+		})
+	}
+}
+
+func TestConvertHTML_BaseURLArticle(t *testing.T) {
+	md, err := ConvertHTML(`<p><a href="next">Next</a></p>`, Options{Extract: ExtractArticle, BaseURL: "https://example.com/a/b"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(md, "[Next](https://example.com/a/next)") {
+		t.Errorf("expected resolved links when falling back to the whole page, got %q", md)
+	}
+}
@@ -0,0 +1,325 @@
+package converter
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// docxMain is the part holding the body of a Word document.
+const docxMain = "word/document.xml"
+
+// docxDoc holds the parts of a Word document that paragraphs refer to.
+type docxDoc struct {
+	// styles maps paragraph style IDs to style names.
+	styles map[string]string
+	// numbering maps list IDs to the number format of each list level,
+	// e.g. "bullet" or "decimal".
+	numbering map[string]map[int]string
+	// links maps relationship IDs to hyperlink targets.
+	links map[string]string
+}
+
+// docxParagraph is a paragraph of a Word document.
+type docxParagraph struct {
+	style string
+	numID string // list, if any
+	level int    // list level
+	runs  []docxRun
+}
+
+// docxRun is a run of text with uniform formatting.
+type docxRun struct {
+	text         string
+	bold, italic bool
+	link         string
+}
+
+// DOCXToMarkdown converts a Word document to Markdown. Paragraphs styled
+// as titles or headings become headings, numbered and bulleted paragraphs
+// become lists, tables become tables, and bold, italic and hyperlinked
+// text keeps its formatting.
+func DOCXToMarkdown(body []byte) (string, error) {
+	pkg, err := openOffice(body)
+	if err != nil {
+		return "", err
+	}
+	d := &docxDoc{styles: map[string]string{}, numbering: map[string]map[int]string{}}
+	if err := d.load(pkg); err != nil {
+		return "", err
+	}
+	dec, err := pkg.decoder(docxMain)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	prevItem := false
+	write := func(block string, item bool) {
+		if block == "" {
+			return
+		}
+		if b.Len() > 0 {
+			if item && prevItem {
+				b.WriteString("\n")
+			} else {
+				b.WriteString("\n\n")
+			}
+		}
+		b.WriteString(block)
+		prevItem = item
+	}
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("parsing %s: %w", docxMain, err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "p":
+			p, err := d.paragraph(dec)
+			if err != nil {
+				return "", fmt.Errorf("parsing %s: %w", docxMain, err)
+			}
+			write(d.render(p))
+		case "tbl":
+			rows, err := officeTable(dec, d.cellText)
+			if err != nil {
+				return "", fmt.Errorf("parsing %s: %w", docxMain, err)
+			}
+			if len(rows) > 0 {
+				write(markdownTable(rows), false)
+			}
+		}
+	}
+	return b.String(), nil
+}
+
+// load reads the styles, list numbering and hyperlinks of a document.
+// Documents may leave out any of them.
+func (d *docxDoc) load(pkg *officePackage) error {
+	var err error
+	if d.links, err = pkg.rels(docxMain); err != nil {
+		return err
+	}
+	if pkg.has("word/styles.xml") {
+		var styles struct {
+			Styles []struct {
+				ID   string `xml:"styleId,attr"`
+				Name struct {
+					Val string `xml:"val,attr"`
+				} `xml:"name"`
+			} `xml:"style"`
+		}
+		if err := pkg.decode("word/styles.xml", &styles); err != nil {
+			return err
+		}
+		for _, s := range styles.Styles {
+			d.styles[s.ID] = s.Name.Val
+		}
+	}
+	if pkg.has("word/numbering.xml") {
+		var numbering struct {
+			Abstract []struct {
+				ID     string `xml:"abstractNumId,attr"`
+				Levels []struct {
+					Level  int `xml:"ilvl,attr"`
+					Format struct {
+						Val string `xml:"val,attr"`
+					} `xml:"numFmt"`
+				} `xml:"lvl"`
+			} `xml:"abstractNum"`
+			Nums []struct {
+				ID       string `xml:"numId,attr"`
+				Abstract struct {
+					Val string `xml:"val,attr"`
+				} `xml:"abstractNumId"`
+			} `xml:"num"`
+		}
+		if err := pkg.decode("word/numbering.xml", &numbering); err != nil {
+			return err
+		}
+		formats := map[string]map[int]string{}
+		for _, a := range numbering.Abstract {
+			formats[a.ID] = map[int]string{}
+			for _, l := range a.Levels {
+				formats[a.ID][l.Level] = l.Format.Val
+			}
+		}
+		for _, n := range numbering.Nums {
+			d.numbering[n.ID] = formats[n.Abstract.Val]
+		}
+	}
+	return nil
+}
+
+// paragraph reads a paragraph up to the end of its element.
+func (d *docxDoc) paragraph(dec *xml.Decoder) (docxParagraph, error) {
+	var p docxParagraph
+	run := -1 // index of the run being read
+	inRunProps := false
+	link := ""
+	for depth := 1; depth > 0; {
+		tok, err := dec.Token()
+		if err != nil {
+			return p, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "pStyle":
+				p.style = xmlAttr(t, "val")
+			case "numId":
+				p.numID = xmlAttr(t, "val")
+			case "ilvl":
+				p.level = listLevel(xmlAttr(t, "val"))
+			case "hyperlink":
+				link = d.links[relID(t)]
+			case "r":
+				p.runs = append(p.runs, docxRun{link: link})
+				run = len(p.runs) - 1
+			case "rPr":
+				inRunProps = run >= 0
+			case "b", "i":
+				if inRunProps {
+					val := xmlAttr(t, "val")
+					on := val == "" || val == "1" || val == "true" || val == "on"
+					if t.Name.Local == "b" {
+						p.runs[run].bold = on
+					} else {
+						p.runs[run].italic = on
+					}
+				}
+			case "t":
+				var text string
+				if err := dec.DecodeElement(&text, &t); err != nil {
+					return p, err
+				}
+				if run >= 0 {
+					p.runs[run].text += text
+				}
+				continue
+			case "tab", "br", "cr":
+				if run >= 0 {
+					p.runs[run].text += " "
+				}
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+			switch t.Name.Local {
+			case "hyperlink":
+				link = ""
+			case "r":
+				run = -1
+			case "rPr":
+				inRunProps = false
+			}
+		}
+	}
+	return p, nil
+}
+
+// cellText reads a paragraph in a table cell as inline Markdown.
+func (d *docxDoc) cellText(dec *xml.Decoder) (string, error) {
+	p, err := d.paragraph(dec)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(docxInline(p.runs)), nil
+}
+
+// render returns the Markdown block for a paragraph, and whether it is a
+// list item. Empty paragraphs render as "".
+func (d *docxDoc) render(p docxParagraph) (string, bool) {
+	if level := d.headingLevel(p.style); level > 0 {
+		var text strings.Builder
+		for _, r := range p.runs {
+			text.WriteString(r.text)
+		}
+		if s := strings.Join(strings.Fields(text.String()), " "); s != "" {
+			return strings.Repeat("#", level) + " " + s, false
+		}
+		return "", false
+	}
+	text := strings.TrimSpace(docxInline(p.runs))
+	if text == "" {
+		return "", false
+	}
+	if p.numID == "" || p.numID == "0" {
+		return text, false
+	}
+	marker := "-"
+	if format := d.numbering[p.numID][p.level]; format != "" && format != "bullet" && format != "none" {
+		marker = "1."
+	}
+	return strings.Repeat("    ", p.level) + marker + " " + text, true
+}
+
+// headingLevel returns the heading level of a paragraph style, or 0 when
+// it is not a heading style. Built-in styles are recognized by name
+// ("Title", "heading 1"), falling back to the style ID when the document
+// has no style definitions.
+func (d *docxDoc) headingLevel(style string) int {
+	name := style
+	if n, ok := d.styles[style]; ok {
+		name = n
+	}
+	name = strings.ToLower(strings.ReplaceAll(name, " ", ""))
+	if name == "title" {
+		return 1
+	}
+	if n, ok := strings.CutPrefix(name, "heading"); ok {
+		if level, err := strconv.Atoi(n); err == nil && level >= 1 && level <= 6 {
+			return level
+		}
+	}
+	return 0
+}
+
+// docxInline renders runs as inline Markdown, merging neighbouring runs
+// with the same formatting.
+func docxInline(runs []docxRun) string {
+	var b strings.Builder
+	for i := 0; i < len(runs); {
+		r := runs[i]
+		text := r.text
+		for i++; i < len(runs) && runs[i].bold == r.bold && runs[i].italic == r.italic && runs[i].link == r.link; i++ {
+			text += runs[i].text
+		}
+		switch {
+		case r.bold && r.italic:
+			text = wrapText(text, "***", "***")
+		case r.bold:
+			text = wrapText(text, "**", "**")
+		case r.italic:
+			text = wrapText(text, "*", "*")
+		}
+		if r.link != "" {
+			text = wrapText(text, "[", "]("+r.link+")")
+		}
+		b.WriteString(text)
+	}
+	return b.String()
+}
+
+// wrapText surrounds text with open and close, keeping its leading and
+// trailing whitespace outside them. Blank text is returned unchanged.
+func wrapText(text, open, close string) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+	lead := text[:strings.Index(text, trimmed)]
+	trail := text[len(lead)+len(trimmed):]
+	return lead + open + trimmed + close + trail
+}
@@ -0,0 +1,80 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDOCXToMarkdown(t *testing.T) {
+	doc := officeZip(t, map[string]string{
+		"word/document.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document ` + wordNS + `><w:body>
+<w:p><w:pPr><w:pStyle w:val="Title"/></w:pPr><w:r><w:t>Release Plan</w:t></w:r></w:p>
+<w:p><w:pPr><w:pStyle w:val="Heading2"/></w:pPr><w:r><w:rPr><w:b/></w:rPr><w:t>Goals</w:t></w:r></w:p>
+<w:p><w:r><w:t xml:space="preserve">Ship </w:t></w:r><w:r><w:rPr><w:b/></w:rPr><w:t xml:space="preserve">faster </w:t></w:r><w:r><w:rPr><w:i/><w:b w:val="0"/></w:rPr><w:t>builds</w:t></w:r><w:r><w:t xml:space="preserve">, see </w:t></w:r><w:hyperlink r:id="rId1"><w:r><w:t>the roadmap</w:t></w:r></w:hyperlink><w:r><w:t>.</w:t></w:r></w:p>
+<w:p/>
+<w:p><w:pPr><w:numPr><w:ilvl w:val="0"/><w:numId w:val="1"/></w:numPr></w:pPr><w:r><w:t>Cache</w:t></w:r></w:p>
+<w:p><w:pPr><w:numPr><w:ilvl w:val="1"/><w:numId w:val="1"/></w:numPr></w:pPr><w:r><w:t>Remote</w:t></w:r></w:p>
+<w:p><w:pPr><w:numPr><w:ilvl w:val="0"/><w:numId w:val="2"/></w:numPr></w:pPr><w:r><w:t>First step</w:t></w:r></w:p>
+<w:tbl><w:tr><w:tc><w:p><w:r><w:t>Team</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>Owner</w:t></w:r></w:p></w:tc></w:tr>
+<w:tr><w:tc><w:p><w:r><w:t>Build</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>Ana</w:t></w:r></w:p><w:p><w:r><w:t>Bo</w:t></w:r></w:p></w:tc></w:tr></w:tbl>
+</w:body></w:document>`,
+		"word/_rels/document.xml.rels": relsPart("https://example.com/roadmap"),
+		"word/styles.xml": `<w:styles ` + wordNS + `>
+<w:style w:type="paragraph" w:styleId="Title"><w:name w:val="Title"/></w:style>
+<w:style w:type="paragraph" w:styleId="Heading2"><w:name w:val="heading 2"/></w:style>
+</w:styles>`,
+		"word/numbering.xml": `<w:numbering ` + wordNS + `>
+<w:abstractNum w:abstractNumId="0"><w:lvl w:ilvl="0"><w:numFmt w:val="bullet"/></w:lvl><w:lvl w:ilvl="1"><w:numFmt w:val="bullet"/></w:lvl></w:abstractNum>
+<w:abstractNum w:abstractNumId="1"><w:lvl w:ilvl="0"><w:numFmt w:val="decimal"/></w:lvl></w:abstractNum>
+<w:num w:numId="1"><w:abstractNumId w:val="0"/></w:num>
+<w:num w:numId="2"><w:abstractNumId w:val="1"/></w:num>
+</w:numbering>`,
+	})
+
+	md, err := DOCXToMarkdown(doc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "# Release Plan\n\n" +
+		"## Goals\n\n" +
+		"Ship **faster** *builds*, see [the roadmap](https://example.com/roadmap).\n\n" +
+		"- Cache\n    - Remote\n1. First step\n\n" +
+		"| Team | Owner |\n| --- | --- |\n| Build | Ana Bo |"
+	if md != want {
+		t.Errorf("got:\n%s\nwant:\n%s", md, want)
+	}
+}
+
+func TestDOCXToMarkdown_NoStyles(t *testing.T) {
+	doc := officeZip(t, map[string]string{
+		"word/document.xml": `<w:document ` + wordNS + `><w:body>
+<w:p><w:pPr><w:pStyle w:val="Heading1"/></w:pPr><w:r><w:t>Intro</w:t></w:r></w:p>
+<w:p><w:r><w:t>Text</w:t></w:r></w:p>
+</w:body></w:document>`,
+	})
+	md, err := DOCXToMarkdown(doc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "# Intro\n\nText"; md != want {
+		t.Errorf("got %q, want %q", md, want)
+	}
+}
+
+func TestDOCXToMarkdown_ListLevelClamped(t *testing.T) {
+	doc := officeZip(t, map[string]string{
+		"word/document.xml": `<w:document ` + wordNS + `><w:body>
+<w:p><w:pPr><w:numPr><w:ilvl w:val="-1"/><w:numId w:val="1"/></w:numPr></w:pPr><w:r><w:t>Negative</w:t></w:r></w:p>
+<w:p><w:pPr><w:numPr><w:ilvl w:val="2000000000"/><w:numId w:val="1"/></w:numPr></w:pPr><w:r><w:t>Huge</w:t></w:r></w:p>
+</w:body></w:document>`,
+	})
+	md, err := DOCXToMarkdown(doc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "- Negative\n" + strings.Repeat("    ", maxListLevel) + "- Huge"
+	if md != want {
+		t.Errorf("got %q, want %q", md, want)
+	}
+}
@@ -0,0 +1,290 @@
+package converter
+
+import (
+	"math"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Class and id patterns used to judge content, after Mozilla's Readability.
+var (
+	unlikelyCandidate = regexp.MustCompile(`(?i)-ad-|ai2html|banner|breadcrumbs|combx|comment|community|cookie|cover-wrap|disqus|extra|footer|gdpr|header|legends|menu|related|remark|replies|rss|shoutbox|sidebar|skyscraper|social|sponsor|supplemental|ad-break|agegate|pagination|pager|popup|yom-remote`)
+	maybeCandidate    = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow`)
+	positiveName      = regexp.MustCompile(`(?i)article|body|content|entry|hentry|h-entry|main|page|pagination|post|text|blog|story`)
+	negativeName      = regexp.MustCompile(`(?i)-ad-|hidden|^hid$| hid$| hid |^hid |banner|combx|comment|com-|contact|foot|footer|footnote|gdpr|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget`)
+	sentenceEnd       = regexp.MustCompile(`\.( |$)`)
+)
+
+// boilerplateTags never hold the main content of a page.
+var boilerplateTags = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Noscript: true,
+	atom.Template: true,
+	atom.Iframe:   true,
+	atom.Nav:      true,
+	atom.Aside:    true,
+	atom.Footer:   true,
+	atom.Form:     true,
+	atom.Button:   true,
+	atom.Dialog:   true,
+}
+
+// blockTags are the elements that stop a <div> from being scored as a
+// paragraph of its own.
+var blockTags = map[atom.Atom]bool{
+	atom.Address: true, atom.Article: true, atom.Blockquote: true, atom.Div: true,
+	atom.Dl: true, atom.Figure: true, atom.H1: true, atom.H2: true, atom.H3: true,
+	atom.H4: true, atom.H5: true, atom.H6: true, atom.Ol: true, atom.P: true,
+	atom.Pre: true, atom.Section: true, atom.Table: true, atom.Ul: true,
+}
+
+// minParagraphLen is the shortest text, in bytes, that scores as content.
+const minParagraphLen = 25
+
+// extractArticle finds the main content of doc the way Readability does:
+// paragraphs award points to their parent and grandparents by length and
+// comma count, candidates are weighted by tag and class names and penalized
+// by link density, and the best candidate is returned together with the
+// siblings that score close to it. doc is modified. It returns nil when no
+// candidate is found.
+func extractArticle(doc *html.Node) *html.Node {
+	body := findElement(doc, atom.Body)
+	if body == nil {
+		return nil
+	}
+	prune(body, false)
+
+	scores := map[*html.Node]float64{}
+	var candidates []*html.Node
+	walkElements(body, func(n *html.Node) {
+		if !scorable(n) {
+			return
+		}
+		text := innerText(n)
+		if len(text) < minParagraphLen {
+			return
+		}
+		score := 1 + float64(strings.Count(text, ",")) + math.Min(float64(len(text)/100), 3)
+
+		level := 0
+		for anc := n.Parent; anc != nil && anc.Type == html.ElementNode && level < 3; anc = anc.Parent {
+			if _, ok := scores[anc]; !ok {
+				scores[anc] = initialScore(anc)
+				candidates = append(candidates, anc)
+			}
+			divider := 1.0
+			switch {
+			case level == 1:
+				divider = 2
+			case level > 1:
+				divider = float64(level * 3)
+			}
+			scores[anc] += score / divider
+			level++
+		}
+	})
+
+	var top *html.Node
+	for _, c := range candidates {
+		scores[c] *= 1 - linkDensity(c)
+		if top == nil || scores[c] > scores[top] {
+			top = c
+		}
+	}
+	if top == nil || top.Parent == nil {
+		return nil
+	}
+
+	// Siblings of the top candidate that score well, or read like prose,
+	// belong to the article too: content is often split across several
+	// containers.
+	threshold := math.Max(10, scores[top]*0.2)
+	var keep []*html.Node
+	for sib := top.Parent.FirstChild; sib != nil; sib = sib.NextSibling {
+		if sib == top || sib.Type == html.ElementNode && relatedContent(sib, scores, threshold) {
+			keep = append(keep, sib)
+		}
+	}
+
+	article := &html.Node{Type: html.ElementNode, DataAtom: atom.Div, Data: "div"}
+	for _, n := range keep {
+		n.Parent.RemoveChild(n)
+		article.AppendChild(n)
+	}
+	return article
+}
+
+// prune removes the elements of n that cannot be main content: scripts,
+// navigation and other boilerplate tags, and elements whose class or id
+// mark them as unlikely. Headers are kept inside articles, where they hold
+// the title.
+func prune(n *html.Node, inArticle bool) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch {
+		case c.Type == html.CommentNode:
+			n.RemoveChild(c)
+		case c.Type != html.ElementNode:
+		case boilerplateTags[c.DataAtom],
+			c.DataAtom == atom.Header && !inArticle,
+			unlikely(c):
+			n.RemoveChild(c)
+		default:
+			prune(c, inArticle || c.DataAtom == atom.Article || c.DataAtom == atom.Main)
+		}
+		c = next
+	}
+}
+
+// unlikely reports whether n's class and id mark it as boilerplate.
+func unlikely(n *html.Node) bool {
+	if n.DataAtom == atom.Body || n.DataAtom == atom.Article || n.DataAtom == atom.Main || n.DataAtom == atom.A {
+		return false
+	}
+	if role := attr(n, "role"); role == "navigation" || role == "complementary" || role == "banner" || role == "contentinfo" {
+		return true
+	}
+	names := attr(n, "class") + " " + attr(n, "id")
+	return unlikelyCandidate.MatchString(names) && !maybeCandidate.MatchString(names)
+}
+
+// scorable reports whether n is a paragraph-like element whose text is
+// scored: <p>, <pre>, <td>, and <div> or <section> elements without
+// block-level children.
+func scorable(n *html.Node) bool {
+	switch n.DataAtom {
+	case atom.P, atom.Pre, atom.Td:
+		return true
+	case atom.Div, atom.Section:
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && blockTags[c.DataAtom] {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// initialScore is the score a candidate starts with, from its tag and its
+// class and id names.
+func initialScore(n *html.Node) float64 {
+	var score float64
+	switch n.DataAtom {
+	case atom.Article, atom.Main:
+		score = 10
+	case atom.Div:
+		score = 5
+	case atom.Pre, atom.Td, atom.Blockquote:
+		score = 3
+	case atom.Address, atom.Ol, atom.Ul, atom.Dl, atom.Dd, atom.Dt, atom.Li, atom.Form:
+		score = -3
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Th:
+		score = -5
+	}
+	return score + classWeight(n)
+}
+
+// classWeight scores n's class and id names: +25 for each that suggests
+// content and -25 for each that suggests boilerplate.
+func classWeight(n *html.Node) float64 {
+	var weight float64
+	for _, name := range []string{attr(n, "class"), attr(n, "id")} {
+		if name == "" {
+			continue
+		}
+		if negativeName.MatchString(name) {
+			weight -= 25
+		}
+		if positiveName.MatchString(name) {
+			weight += 25
+		}
+	}
+	return weight
+}
+
+// relatedContent reports whether a sibling of the top candidate belongs to
+// the article.
+func relatedContent(n *html.Node, scores map[*html.Node]float64, threshold float64) bool {
+	if score, ok := scores[n]; ok && score >= threshold {
+		return true
+	}
+	if n.DataAtom != atom.P {
+		return false
+	}
+	text := innerText(n)
+	density := linkDensity(n)
+	if len(text) > 80 {
+		return density < 0.25
+	}
+	return len(text) > 0 && density == 0 && sentenceEnd.MatchString(text)
+}
+
+// linkDensity is the share of n's text that sits inside links.
+func linkDensity(n *html.Node) float64 {
+	total := len(innerText(n))
+	if total == 0 {
+		return 0
+	}
+	var linked int
+	walkElements(n, func(c *html.Node) {
+		if c.DataAtom == atom.A {
+			linked += len(innerText(c))
+		}
+	})
+	return float64(linked) / float64(total)
+}
+
+// innerText returns the text of n with whitespace collapsed.
+func innerText(n *html.Node) string {
+	var b strings.Builder
+	var collect func(*html.Node)
+	collect = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+			b.WriteByte(' ')
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			collect(c)
+		}
+	}
+	collect(n)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// walkElements calls fn for every element below n, in document order.
+func walkElements(n *html.Node, fn func(*html.Node)) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode {
+			fn(c)
+		}
+		walkElements(c, fn)
+	}
+}
+
+// findElement returns the first element below n with the given tag.
+func findElement(n *html.Node, tag atom.Atom) *html.Node {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.DataAtom == tag {
+			return c
+		}
+		if found := findElement(c, tag); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// attr returns the value of n's attribute key, or "".
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
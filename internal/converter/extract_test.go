@@ -0,0 +1,78 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+)
+
+const articlePage = `<html><head><title>Gardening</title></head><body>
+<header class="site-header"><a href="/">Home</a> <a href="/blog">Blog</a></header>
+<nav><ul><li><a href="/a">Products</a></li><li><a href="/b">Pricing</a></li></ul></nav>
+<div id="cookie-banner">We use cookies to improve your experience on this website.</div>
+<div class="layout">
+  <aside class="sidebar"><h3>Popular posts</h3><ul><li><a href="/x">Ten ways to water your plants</a></li></ul></aside>
+  <article class="post">
+    <header><h1>Growing tomatoes</h1></header>
+    <p>Tomatoes need plenty of sun, regular watering, and well-drained soil to thrive in a home garden.</p>
+    <p>Plant seedlings after the last frost, spacing them about sixty centimetres apart, and stake them early.</p>
+    <p>Feed them every two weeks once the first fruit sets, and pinch out side shoots as they appear.</p>
+  </article>
+</div>
+<footer><p>Copyright 2024, Example Gardening Ltd. All rights reserved worldwide.</p></footer>
+</body></html>`
+
+func TestConvertHTML_Article(t *testing.T) {
+	md, err := ConvertHTML(articlePage, Options{Extract: ExtractArticle})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{"# Growing tomatoes", "plenty of sun", "pinch out side shoots"} {
+		if !strings.Contains(md, want) {
+			t.Errorf("expected article to contain %q, got:\n%s", want, md)
+		}
+	}
+	for _, unwanted := range []string{"Pricing", "cookies", "Popular posts", "Copyright"} {
+		if strings.Contains(md, unwanted) {
+			t.Errorf("expected article to drop %q, got:\n%s", unwanted, md)
+		}
+	}
+
+	full, _ := ConvertHTML(articlePage, Options{})
+	if !strings.Contains(full, "Pricing") || len(full) <= len(md) {
+		t.Errorf("expected full conversion to keep the whole page, got:\n%s", full)
+	}
+}
+
+func TestConvertHTML_ArticleSiblings(t *testing.T) {
+	page := `<html><body><div id="main">
+<div class="content"><p>The first part of the story, with enough words, commas, and detail to score well.</p>
+<p>More of the first part, continuing the narrative at some length so it counts as content.</p></div>
+<p>A short interlude between the two halves of the story.</p>
+<div class="content"><p>The second part of the story, again long enough, with commas, to be scored as content.</p>
+<p>The ending, which wraps up the story and should be kept with the rest of the article.</p></div>
+<div class="share"><a href="/tw">Share on social networks</a></div>
+</div></body></html>`
+
+	md, err := ConvertHTML(page, Options{Extract: ExtractArticle})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{"first part", "short interlude", "The ending"} {
+		if !strings.Contains(md, want) {
+			t.Errorf("expected article to contain %q, got:\n%s", want, md)
+		}
+	}
+	if strings.Contains(md, "Share on") {
+		t.Errorf("expected share links to be dropped, got:\n%s", md)
+	}
+}
+
+func TestConvertHTML_ArticleFallback(t *testing.T) {
+	md, err := ConvertHTML("<ul><li>one</li><li>two</li></ul>", Options{Extract: ExtractArticle})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(md, "- one") || !strings.Contains(md, "- two") {
+		t.Errorf("expected the whole document without a main content block, got %q", md)
+	}
+}
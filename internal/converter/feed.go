@@ -0,0 +1,296 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// FormatFeed is the format name of the RSS and Atom converter.
+const FormatFeed = "feed"
+
+// FeedConverter renders RSS 2.0, RSS 1.0 and Atom feeds as Markdown digests
+// with FeedToMarkdown. Generic XML types are included because many feeds
+// are served as such; documents that are not feeds fail with
+// ErrNotApplicable, so they pass through unconverted.
+var FeedConverter = &Converter{
+	Format:     FormatFeed,
+	MediaTypes: []string{"application/rss+xml", "application/atom+xml", "application/rdf+xml", "text/xml", "application/xml"},
+	Convert: func(in Input) (string, error) {
+		return FeedToMarkdown(in.Body, in.HTML.BaseURL, in.FeedEntries, in.HTML.Markdown)
+	},
+}
+
+// feed is the common shape of RSS and Atom documents.
+type feed struct {
+	Title       string
+	Description string // HTML
+	Entries     []feedEntry
+}
+
+type feedEntry struct {
+	Title   string
+	Link    string
+	Date    string
+	Summary string // HTML
+}
+
+// xmlLink is an RSS <link>, which holds its URL as text, or an Atom
+// <link>, which holds it in href.
+type xmlLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Text string `xml:",chardata"`
+}
+
+// xmlText is an element holding text or markup. Atom marks the kind with
+// its type attribute.
+type xmlText struct {
+	Type  string `xml:"type,attr"`
+	Text  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
+}
+
+type rssChannel struct {
+	Title       xmlText   `xml:"title"`
+	Description xmlText   `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       xmlText   `xml:"title"`
+	Links       []xmlLink `xml:"link"`
+	GUID        string    `xml:"guid"`
+	Description xmlText   `xml:"description"`
+	Content     xmlText   `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	PubDate     string    `xml:"pubDate"`
+	Date        string    `xml:"http://purl.org/dc/elements/1.1/ date"`
+}
+
+// rssFeed is an RSS 2.0 <rss> or RSS 1.0 <rdf:RDF> document. RSS 1.0 lists
+// its items beside the channel rather than inside it.
+type rssFeed struct {
+	Channel rssChannel `xml:"channel"`
+	Items   []rssItem  `xml:"item"`
+}
+
+type atomFeed struct {
+	Title    xmlText     `xml:"title"`
+	Subtitle xmlText     `xml:"subtitle"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	Title     xmlText   `xml:"title"`
+	Links     []xmlLink `xml:"link"`
+	Published string    `xml:"published"`
+	Updated   string    `xml:"updated"`
+	Summary   xmlText   `xml:"summary"`
+	Content   xmlText   `xml:"content"`
+}
+
+// feedDateLayouts are the date formats found in feeds, tried in order.
+var feedDateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC3339,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// FeedToMarkdown renders an RSS or Atom feed as Markdown: the feed title and
+// description, then a section per entry with its title linking to the entry,
+// its date and its summary converted from HTML, all in the style md
+// describes. Relative links resolve against feedURL. When maxEntries is
+// positive, only the first maxEntries entries are rendered.
+func FeedToMarkdown(body []byte, feedURL string, maxEntries int, md MarkdownOptions) (string, error) {
+	f, err := parseFeed(body)
+	if err != nil {
+		return "", err
+	}
+	base, _ := url.Parse(feedURL)
+
+	var b strings.Builder
+	if f.Title != "" {
+		fmt.Fprintf(&b, "%s\n\n", md.heading(1, f.Title))
+	}
+	if desc, _ := ConvertHTML(f.Description, Options{BaseURL: feedURL, Markdown: md}); desc != "" {
+		fmt.Fprintf(&b, "%s\n\n", desc)
+	}
+
+	entries := f.Entries
+	if maxEntries > 0 && len(entries) > maxEntries {
+		entries = entries[:maxEntries]
+	}
+	for _, e := range entries {
+		link := e.Link
+		if base != nil {
+			link = resolveURL(base, link)
+		}
+		title := e.Title
+		if title == "" {
+			title = "Untitled"
+		}
+		if link != "" {
+			title = fmt.Sprintf("[%s](%s)", escapeLinkText(title), link)
+		}
+		fmt.Fprintf(&b, "%s\n\n", md.heading(2, title))
+		if e.Date != "" {
+			fmt.Fprintf(&b, "Published: %s\n\n", feedDate(e.Date))
+		}
+		pageURL := link
+		if pageURL == "" {
+			pageURL = feedURL
+		}
+		summary, err := ConvertHTML(e.Summary, Options{BaseURL: pageURL, Markdown: md})
+		if err != nil {
+			return "", err
+		}
+		if summary != "" {
+			fmt.Fprintf(&b, "%s\n\n", summary)
+		}
+	}
+	if omitted := len(f.Entries) - len(entries); omitted > 0 {
+		fmt.Fprintf(&b, "_%d more entries not shown._\n", omitted)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// parseFeed decodes an RSS 2.0, RSS 1.0 or Atom document. The body must
+// already be UTF-8, whatever its XML declaration says.
+func parseFeed(body []byte) (*feed, error) {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	dec.Strict = false
+	dec.Entity = xml.HTMLEntity
+	dec.CharsetReader = func(_ string, r io.Reader) (io.Reader, error) { return r, nil }
+
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("parsing feed: %w", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(start.Name.Local) {
+		case "rss", "rdf":
+			var doc rssFeed
+			if err := dec.DecodeElement(&doc, &start); err != nil {
+				return nil, fmt.Errorf("parsing RSS feed: %w", err)
+			}
+			return doc.feed(), nil
+		case "feed":
+			var doc atomFeed
+			if err := dec.DecodeElement(&doc, &start); err != nil {
+				return nil, fmt.Errorf("parsing Atom feed: %w", err)
+			}
+			return doc.feed(), nil
+		default:
+			return nil, fmt.Errorf("%w: not an RSS or Atom feed (root element <%s>)", ErrNotApplicable, start.Name.Local)
+		}
+	}
+}
+
+func (doc *rssFeed) feed() *feed {
+	f := &feed{
+		Title:       plainText(doc.Channel.Title.html()),
+		Description: doc.Channel.Description.html(),
+	}
+	for _, item := range append(doc.Channel.Items, doc.Items...) {
+		e := feedEntry{
+			Title:   plainText(item.Title.html()),
+			Date:    first(strings.TrimSpace(item.PubDate), strings.TrimSpace(item.Date)),
+			Summary: first(item.Description.html(), item.Content.html()),
+		}
+		for _, l := range item.Links {
+			if e.Link = strings.TrimSpace(l.Text); e.Link != "" {
+				break
+			}
+		}
+		if guid := strings.TrimSpace(item.GUID); e.Link == "" && (strings.HasPrefix(guid, "http://") || strings.HasPrefix(guid, "https://")) {
+			e.Link = guid
+		}
+		f.Entries = append(f.Entries, e)
+	}
+	return f
+}
+
+func (doc *atomFeed) feed() *feed {
+	f := &feed{
+		Title:       plainText(doc.Title.html()),
+		Description: doc.Subtitle.html(),
+	}
+	for _, entry := range doc.Entries {
+		f.Entries = append(f.Entries, feedEntry{
+			Title:   plainText(entry.Title.html()),
+			Link:    atomLink(entry.Links),
+			Date:    first(strings.TrimSpace(entry.Published), strings.TrimSpace(entry.Updated)),
+			Summary: first(entry.Summary.html(), entry.Content.html()),
+		})
+	}
+	return f
+}
+
+// html returns the content of t as HTML: Atom xhtml content is markup
+// already, text content is escaped, and anything else (RSS, Atom html) is
+// HTML held as text.
+func (t xmlText) html() string {
+	switch strings.ToLower(t.Type) {
+	case "xhtml":
+		return strings.TrimSpace(t.Inner)
+	case "text":
+		return html.EscapeString(strings.TrimSpace(t.Text))
+	}
+	return strings.TrimSpace(t.Text)
+}
+
+// atomLink returns the URL of an entry's alternate link, or its first link.
+func atomLink(links []xmlLink) string {
+	for _, l := range links {
+		if l.Rel == "" || l.Rel == "alternate" {
+			return strings.TrimSpace(l.Href)
+		}
+	}
+	if len(links) > 0 {
+		return strings.TrimSpace(links[0].Href)
+	}
+	return ""
+}
+
+// plainText returns the text of an HTML fragment with whitespace collapsed.
+func plainText(fragment string) string {
+	if !strings.ContainsAny(fragment, "<&") {
+		return strings.Join(strings.Fields(fragment), " ")
+	}
+	doc, err := html.Parse(strings.NewReader(fragment))
+	if err != nil {
+		return fragment
+	}
+	return innerText(doc)
+}
+
+// feedDate formats a feed date as RFC 3339 in UTC, or returns it unchanged
+// when it cannot be parsed.
+func feedDate(s string) string {
+	for _, layout := range feedDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC().Format(time.RFC3339)
+		}
+	}
+	return s
+}
+
+// escapeLinkText escapes the brackets that would end Markdown link text.
+func escapeLinkText(s string) string {
+	return strings.NewReplacer("[", `\[`, "]", `\]`).Replace(s)
+}
@@ -0,0 +1,125 @@
+package converter
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const rssFeedDoc = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:content="http://purl.org/rss/1.0/modules/content/" xmlns:atom="http://www.w3.org/2005/Atom">
+<channel>
+  <title>Project Releases</title>
+  <link>https://example.com/</link>
+  <atom:link href="https://example.com/feed.xml" rel="self"/>
+  <description>Release notes &amp; changelogs.</description>
+  <item>
+    <title>v2.0 [beta]</title>
+    <link>https://example.com/releases/v2.0</link>
+    <pubDate>Wed, 01 May 2024 08:00:00 +0200</pubDate>
+    <description><![CDATA[<p>Adds <strong>streaming</strong>. See <a href="/docs/streaming">the docs</a>.</p>]]></description>
+  </item>
+  <item>
+    <title>v1.9</title>
+    <guid>https://example.com/releases/v1.9</guid>
+    <content:encoded>&lt;p&gt;Bug fixes.&lt;/p&gt;</content:encoded>
+  </item>
+  <item>
+    <title>v1.8</title>
+    <link>https://example.com/releases/v1.8</link>
+  </item>
+</channel>
+</rss>`
+
+const atomFeedDoc = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title type="text">Changelog</title>
+  <subtitle type="html">&lt;em&gt;Every&lt;/em&gt; change.</subtitle>
+  <entry>
+    <title>Faster builds</title>
+    <link rel="self" href="https://example.com/api/1"/>
+    <link rel="alternate" href="/posts/faster-builds"/>
+    <updated>2024-05-02T10:30:00Z</updated>
+    <content type="xhtml"><div xmlns="http://www.w3.org/1999/xhtml"><p>Builds are <em>twice</em> as fast.</p></div></content>
+  </entry>
+  <entry>
+    <title type="html">Less &lt;code&gt;config&lt;/code&gt;</title>
+    <link href="https://example.com/posts/less-config"/>
+    <published>2024-04-20T09:00:00-07:00</published>
+    <summary type="text">Defaults &lt;just work&gt;.</summary>
+  </entry>
+</feed>`
+
+func TestFeedToMarkdown_RSS(t *testing.T) {
+	md, err := FeedToMarkdown([]byte(rssFeedDoc), "https://example.com/feed.xml", 0, MarkdownOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{
+		"# Project Releases\n\nRelease notes & changelogs.",
+		`## [v2.0 \[beta\]](https://example.com/releases/v2.0)`,
+		"Published: 2024-05-01T06:00:00Z",
+		"Adds **streaming**. See [the docs](https://example.com/docs/streaming).",
+		"## [v1.9](https://example.com/releases/v1.9)\n\nBug fixes.",
+		"## [v1.8](https://example.com/releases/v1.8)",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("expected markdown to contain %q, got %q", want, md)
+		}
+	}
+}
+
+func TestFeedToMarkdown_Atom(t *testing.T) {
+	md, err := FeedToMarkdown([]byte(atomFeedDoc), "https://example.com/atom.xml", 0, MarkdownOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{
+		"# Changelog\n\n*Every* change.",
+		"## [Faster builds](https://example.com/posts/faster-builds)\n\nPublished: 2024-05-02T10:30:00Z\n\nBuilds are *twice* as fast.",
+		"## [Less config](https://example.com/posts/less-config)",
+		"Published: 2024-04-20T16:00:00Z",
+		"Defaults &lt;just work&gt;.",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("expected markdown to contain %q, got %q", want, md)
+		}
+	}
+}
+
+func TestFeedToMarkdown_SetextHeadings(t *testing.T) {
+	md, err := FeedToMarkdown([]byte(atomFeedDoc), "https://example.com/atom.xml", 0, MarkdownOptions{HeadingStyle: HeadingSetext})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{
+		"Changelog\n=========\n\n*Every* change.",
+		"[Faster builds](https://example.com/posts/faster-builds)\n" + strings.Repeat("-", 56),
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("expected markdown to contain %q, got %q", want, md)
+		}
+	}
+	if strings.Contains(md, "#") {
+		t.Errorf("expected no ATX headings, got %q", md)
+	}
+}
+
+func TestFeedToMarkdown_MaxEntries(t *testing.T) {
+	md, err := FeedToMarkdown([]byte(rssFeedDoc), "", 1, MarkdownOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(md, "v2.0") || strings.Contains(md, "v1.9") {
+		t.Errorf("expected only the first entry, got %q", md)
+	}
+	if !strings.HasSuffix(md, "_2 more entries not shown._") {
+		t.Errorf("expected a note on omitted entries, got %q", md)
+	}
+}
+
+func TestFeedToMarkdown_NotAFeed(t *testing.T) {
+	if _, err := FeedToMarkdown([]byte(`<?xml version="1.0"?><svg></svg>`), "", 0, MarkdownOptions{}); !errors.Is(err, ErrNotApplicable) {
+		t.Errorf("expected ErrNotApplicable for a document that is not a feed, got %v", err)
+	}
+}
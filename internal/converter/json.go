@@ -9,10 +9,10 @@ import (
 	"github.com/cbroglie/mustache"
 )
 
-// IsJSONContentType returns true if the content type header indicates JSON.
+// IsJSONContentType returns true if the content type header indicates JSON,
+// as the Default registry sees it.
 func IsJSONContentType(ct string) bool {
-	ct = strings.ToLower(ct)
-	return strings.Contains(ct, "application/json")
+	return Default.Lookup(ct) == JSONConverter
 }
 
 // JSONToMarkdown converts a JSON byte slice to Markdown.
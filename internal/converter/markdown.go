@@ -0,0 +1,207 @@
+package converter
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/JohannesKaufmann/html-to-markdown/v2/converter"
+	"github.com/JohannesKaufmann/html-to-markdown/v2/plugin/base"
+	"github.com/JohannesKaufmann/html-to-markdown/v2/plugin/commonmark"
+	"golang.org/x/net/html"
+)
+
+// Heading and link styles for MarkdownOptions.
+const (
+	// HeadingATX prefixes headings with "#" signs.
+	HeadingATX = "atx"
+	// HeadingSetext underlines level 1 and 2 headings with "=" or "-".
+	HeadingSetext = "setext"
+	// LinkInline writes link destinations inline: [text](url).
+	LinkInline = "inline"
+	// LinkReference writes numbered references, [text][1], and lists the
+	// destinations at the end of the document.
+	LinkReference = "reference"
+)
+
+// MarkdownOptions controls the style of the Markdown written for HTML. The
+// zero value gives the converter's defaults: ATX headings, inline links,
+// "-" bullets, images kept and tables flattened to text.
+type MarkdownOptions struct {
+	// HeadingStyle is HeadingATX or HeadingSetext.
+	HeadingStyle string
+	// LinkStyle is LinkInline or LinkReference.
+	LinkStyle string
+	// Bullet is the unordered list marker: "-", "*" or "+".
+	Bullet string
+	// DropImages leaves images out of the Markdown.
+	DropImages bool
+	// RawTables keeps tables as HTML instead of converting them.
+	RawTables bool
+}
+
+// Validate reports the first option with an unknown value.
+func (m MarkdownOptions) Validate() error {
+	switch m.HeadingStyle {
+	case "", HeadingATX, HeadingSetext:
+	default:
+		return fmt.Errorf("invalid heading style %q (want atx or setext)", m.HeadingStyle)
+	}
+	switch m.LinkStyle {
+	case "", LinkInline, LinkReference:
+	default:
+		return fmt.Errorf("invalid link style %q (want inline or reference)", m.LinkStyle)
+	}
+	switch m.Bullet {
+	case "", "-", "*", "+":
+	default:
+		return fmt.Errorf("invalid bullet %q (want -, * or +)", m.Bullet)
+	}
+	return nil
+}
+
+// String describes the options that differ from the defaults, for use in
+// cache keys. It is empty for the defaults.
+func (m MarkdownOptions) String() string {
+	var parts []string
+	if m.HeadingStyle != "" && m.HeadingStyle != HeadingATX {
+		parts = append(parts, "headings="+m.HeadingStyle)
+	}
+	if m.LinkStyle != "" && m.LinkStyle != LinkInline {
+		parts = append(parts, "links="+m.LinkStyle)
+	}
+	if m.Bullet != "" && m.Bullet != "-" {
+		parts = append(parts, "bullet="+m.Bullet)
+	}
+	if m.DropImages {
+		parts = append(parts, "drop-images")
+	}
+	if m.RawTables {
+		parts = append(parts, "raw-tables")
+	}
+	return strings.Join(parts, "; ")
+}
+
+// convert renders node as Markdown in the style m describes.
+func (m MarkdownOptions) convert(node *html.Node) (string, error) {
+	var opts []commonmark.OptionFunc
+	if m.HeadingStyle == HeadingSetext {
+		opts = append(opts, commonmark.WithHeadingStyle(commonmark.HeadingStyleSetext))
+	}
+	if m.Bullet != "" {
+		opts = append(opts, commonmark.WithBulletListMarker(m.Bullet))
+	}
+	conv := converter.NewConverter(converter.WithPlugins(
+		base.NewBasePlugin(),
+		commonmark.NewCommonmarkPlugin(opts...),
+	))
+	conv.Register.RendererFor("math", converter.TagTypeInline, renderMath, converter.PriorityEarly)
+	if m.DropImages {
+		conv.Register.TagType("img", converter.TagTypeRemove, converter.PriorityEarly)
+	}
+	if m.RawTables {
+		conv.Register.RendererFor("table", converter.TagTypeBlock, renderRawTable, converter.PriorityEarly)
+	}
+	if m.LinkStyle == LinkReference {
+		// The references belong to this conversion, so the converter is
+		// built per call.
+		refs := &linkReferences{index: map[string]int{}}
+		conv.Register.RendererFor("a", converter.TagTypeInline, refs.render, converter.PriorityEarly)
+		conv.Register.PostRenderer(refs.appendDefinitions, converter.PriorityLate)
+	}
+
+	md, err := conv.ConvertNode(node)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(md)), nil
+}
+
+// heading writes a level heading holding text in the heading style m
+// describes. Like the HTML converter, setext underlines only levels 1 and 2.
+func (m MarkdownOptions) heading(level int, text string) string {
+	if m.HeadingStyle == HeadingSetext && level < 3 {
+		underline := "="
+		if level == 2 {
+			underline = "-"
+		}
+		return text + "\n" + strings.Repeat(underline, max(3, utf8.RuneCountInString(text)))
+	}
+	return strings.Repeat("#", level) + " " + text
+}
+
+// renderRawTable writes a table element as HTML.
+func renderRawTable(ctx converter.Context, w converter.Writer, n *html.Node) converter.RenderStatus {
+	var buf bytes.Buffer
+	if err := html.Render(&buf, n); err != nil {
+		return converter.RenderTryNext
+	}
+	w.WriteString("\n\n")
+	w.Write(buf.Bytes())
+	w.WriteString("\n\n")
+	return converter.RenderSuccess
+}
+
+// linkReferences renders links in reference style and collects their
+// definitions. Links with the same destination and title share a number.
+type linkReferences struct {
+	defs  []string
+	index map[string]int
+}
+
+// render writes a link as [text][n]. Links without a destination or text
+// are left to the default renderer.
+func (r *linkReferences) render(ctx converter.Context, w converter.Writer, n *html.Node) converter.RenderStatus {
+	href := ctx.AssembleAbsoluteURL(ctx, "a", strings.TrimSpace(attr(n, "href")))
+	if href == "" {
+		return converter.RenderTryNext
+	}
+
+	var buf bytes.Buffer
+	ctx.RenderChildNodes(ctx.WithValue("is_inside_link", true), &buf, n)
+	text := strings.Join(strings.Fields(buf.String()), " ")
+	if text == "" {
+		return converter.RenderTryNext
+	}
+
+	def := href
+	if strings.ContainsAny(href, " ()") {
+		def = "<" + href + ">"
+	}
+	if title := strings.Join(strings.Fields(attr(n, "title")), " "); title != "" {
+		def += " " + strconv.Quote(title)
+	}
+	num, ok := r.index[def]
+	if !ok {
+		r.defs = append(r.defs, def)
+		num = len(r.defs)
+		r.index[def] = num
+	}
+
+	// Keep the whitespace around the link text outside the brackets.
+	content := buf.String()
+	if strings.TrimLeft(content, " \t\n") != content {
+		w.WriteRune(' ')
+	}
+	w.WriteString("[" + text + "][" + strconv.Itoa(num) + "]")
+	if strings.TrimRight(content, " \t\n") != content {
+		w.WriteRune(' ')
+	}
+	return converter.RenderSuccess
+}
+
+// appendDefinitions lists the collected link definitions after the content.
+func (r *linkReferences) appendDefinitions(ctx converter.Context, content []byte) []byte {
+	if len(r.defs) == 0 {
+		return content
+	}
+	var b bytes.Buffer
+	b.Write(bytes.TrimRight(content, " \t\n"))
+	b.WriteString("\n\n")
+	for i, def := range r.defs {
+		fmt.Fprintf(&b, "[%d]: %s\n", i+1, def)
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,110 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+)
+
+const stylePage = `<h1>Title</h1>
+<h2>Section</h2>
+<ul><li>one</li><li>two</li></ul>
+<p>See <a href="https://example.com/a" title="A page">the docs</a> and <a href="https://example.com/a" title="A page">again</a>, or <a href="https://example.com/b">b</a>.</p>
+<p><img src="https://example.com/i.png" alt="Pic"></p>
+<table><tr><th>k</th><th>v</th></tr><tr><td>1</td><td>2</td></tr></table>`
+
+func TestConvertHTML_Markdown(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    MarkdownOptions
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "defaults",
+			want:    []string{"# Title", "## Section", "- one", "[the docs](https://example.com/a \"A page\")", "![Pic](https://example.com/i.png)"},
+			notWant: []string{"<table>"},
+		},
+		{
+			name:    "setext headings",
+			opts:    MarkdownOptions{HeadingStyle: HeadingSetext},
+			want:    []string{"Title\n=====", "Section\n-------"},
+			notWant: []string{"# Title"},
+		},
+		{
+			name: "bullet",
+			opts: MarkdownOptions{Bullet: "*"},
+			want: []string{"* one", "* two"},
+		},
+		{
+			name: "reference links",
+			opts: MarkdownOptions{LinkStyle: LinkReference},
+			want: []string{
+				"See [the docs][1] and [again][1], or [b][2].",
+				"[1]: https://example.com/a \"A page\"\n[2]: https://example.com/b",
+			},
+			notWant: []string{"](https://example.com/a"},
+		},
+		{
+			name:    "drop images",
+			opts:    MarkdownOptions{DropImages: true},
+			notWant: []string{"![Pic]", "i.png"},
+		},
+		{
+			name: "raw tables",
+			opts: MarkdownOptions{RawTables: true},
+			want: []string{"<table><tbody><tr><th>k</th><th>v</th></tr><tr><td>1</td><td>2</td></tr></tbody></table>"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md, err := ConvertHTML(stylePage, Options{Markdown: tt.opts})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(md, want) {
+					t.Errorf("expected markdown to contain %q, got %q", want, md)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(md, notWant) {
+					t.Errorf("expected markdown not to contain %q, got %q", notWant, md)
+				}
+			}
+		})
+	}
+}
+
+func TestMarkdownOptions_Validate(t *testing.T) {
+	valid := []MarkdownOptions{
+		{},
+		{HeadingStyle: HeadingSetext, LinkStyle: LinkReference, Bullet: "+"},
+	}
+	for _, m := range valid {
+		if err := m.Validate(); err != nil {
+			t.Errorf("Validate(%+v) = %v, want nil", m, err)
+		}
+	}
+
+	invalid := []MarkdownOptions{
+		{HeadingStyle: "underline"},
+		{LinkStyle: "footnote"},
+		{Bullet: "1."},
+	}
+	for _, m := range invalid {
+		if err := m.Validate(); err == nil {
+			t.Errorf("Validate(%+v) = nil, want error", m)
+		}
+	}
+}
+
+func TestMarkdownOptions_String(t *testing.T) {
+	if s := (MarkdownOptions{HeadingStyle: HeadingATX, LinkStyle: LinkInline, Bullet: "-"}).String(); s != "" {
+		t.Errorf("String() of explicit defaults = %q, want empty", s)
+	}
+	m := MarkdownOptions{LinkStyle: LinkReference, DropImages: true}
+	if s := m.String(); s != "links=reference; drop-images" {
+		t.Errorf("String() = %q", s)
+	}
+}
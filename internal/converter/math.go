@@ -0,0 +1,256 @@
+package converter
+
+import (
+	"strings"
+
+	"github.com/JohannesKaufmann/html-to-markdown/v2/converter"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// texOperators maps MathML operator and identifier characters to TeX
+// commands, for MathML without a TeX annotation.
+var texOperators = map[string]string{
+	"∑": `\sum `, "∏": `\prod `, "∫": `\int `, "∮": `\oint `, "√": `\sqrt `,
+	"×": `\times `, "·": `\cdot `, "⋅": `\cdot `, "÷": `\div `, "±": `\pm `, "∓": `\mp `,
+	"≤": `\leq `, "≥": `\geq `, "≠": `\neq `, "≈": `\approx `, "≡": `\equiv `, "∼": `\sim `,
+	"∈": `\in `, "∉": `\notin `, "⊂": `\subset `, "⊆": `\subseteq `, "∪": `\cup `, "∩": `\cap `,
+	"→": `\to `, "←": `\leftarrow `, "⇒": `\Rightarrow `, "⇔": `\Leftrightarrow `, "↦": `\mapsto `,
+	"∀": `\forall `, "∃": `\exists `, "∂": `\partial `, "∇": `\nabla `, "∞": `\infty `,
+	"…": `\ldots `, "⋯": `\cdots `, "−": "-",
+	"α": `\alpha `, "β": `\beta `, "γ": `\gamma `, "δ": `\delta `, "ε": `\epsilon `,
+	"θ": `\theta `, "λ": `\lambda `, "μ": `\mu `, "π": `\pi `, "σ": `\sigma `,
+	"τ": `\tau `, "φ": `\phi `, "ω": `\omega `, "Δ": `\Delta `, "Σ": `\Sigma `,
+	"Ω": `\Omega `,
+	// Invisible times and function application.
+	"\u2062": "", "\u2061": "",
+}
+
+// normalizeMath rewrites the math in doc so it converts to LaTeX: KaTeX,
+// MathJax 3 and Wikipedia wrappers are replaced with the <math> element
+// they carry, dropping the rendered glyphs beside it, and MathJax 2
+// math/tex scripts become <math> elements holding their TeX.
+func normalizeMath(doc *html.Node) {
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; {
+			next := c.NextSibling
+			switch {
+			case c.Type != html.ElementNode:
+			case c.DataAtom == atom.Script && strings.HasPrefix(mediaType(attr(c, "type")), "math/tex"):
+				replaceMathScript(c)
+			case isMathWrapper(c):
+				if m := findElement(c, atom.Math); m != nil {
+					if mathDisplay(c) {
+						setAttr(m, "display", "block")
+					}
+					m.Parent.RemoveChild(m)
+					n.InsertBefore(m, c)
+					n.RemoveChild(c)
+				}
+			default:
+				walk(c)
+			}
+			c = next
+		}
+	}
+	walk(doc)
+}
+
+// isMathWrapper reports whether n wraps a <math> element in rendered
+// markup: KaTeX's katex and katex-display spans, MathJax 3's
+// <mjx-container> and Wikipedia's mwe-math-element.
+func isMathWrapper(n *html.Node) bool {
+	if n.Data == "mjx-container" {
+		return true
+	}
+	for _, class := range strings.Fields(attr(n, "class")) {
+		switch class {
+		case "katex", "katex-display", "mwe-math-element":
+			return true
+		}
+	}
+	return false
+}
+
+// mathDisplay reports whether a math wrapper shows its math as a block.
+func mathDisplay(n *html.Node) bool {
+	if n.Data == "mjx-container" {
+		return attr(n, "display") == "true"
+	}
+	return strings.Contains(" "+attr(n, "class")+" ", " katex-display ")
+}
+
+// replaceMathScript replaces a MathJax 2 script with a <math> element
+// holding its TeX, and removes the preview and rendered output MathJax put
+// before it.
+func replaceMathScript(script *html.Node) {
+	tex := scriptText(script)
+	m := &html.Node{Type: html.ElementNode, Data: "math", DataAtom: atom.Math}
+	setAttr(m, "alttext", tex)
+	// Empty elements lose the whitespace around them in conversion.
+	m.AppendChild(&html.Node{Type: html.TextNode, Data: tex})
+	if strings.Contains(attr(script, "type"), "mode=display") {
+		setAttr(m, "display", "block")
+	}
+	parent := script.Parent
+	parent.InsertBefore(m, script)
+	parent.RemoveChild(script)
+
+	for prev := m.PrevSibling; prev != nil; {
+		p := prev.PrevSibling
+		switch {
+		case prev.Type == html.TextNode && strings.TrimSpace(prev.Data) == "":
+		case prev.Type == html.ElementNode && strings.HasPrefix(attr(prev, "class"), "MathJax"):
+			parent.RemoveChild(prev)
+		default:
+			return
+		}
+		prev = p
+	}
+}
+
+// renderMath writes a <math> element as LaTeX: $...$ inline and $$...$$
+// on its own lines for display math. The TeX comes from the element's
+// TeX annotation or alttext, or is rebuilt from the MathML.
+func renderMath(ctx converter.Context, w converter.Writer, n *html.Node) converter.RenderStatus {
+	tex := mathTeX(n)
+	if tex == "" {
+		return converter.RenderTryNext
+	}
+	if attr(n, "display") == "block" {
+		w.WriteString("\n\n$$\n" + tex + "\n$$\n\n")
+	} else {
+		w.WriteString("$" + strings.Join(strings.Fields(tex), " ") + "$")
+	}
+	return converter.RenderSuccess
+}
+
+// mathTeX returns the TeX for a <math> element, or "".
+func mathTeX(n *html.Node) string {
+	var tex string
+	walkElements(n, func(c *html.Node) {
+		if tex == "" && c.Data == "annotation" {
+			if enc := strings.ToLower(attr(c, "encoding")); enc == "application/x-tex" || enc == "tex" {
+				tex = scriptText(c)
+			}
+		}
+	})
+	if strings.TrimSpace(tex) == "" {
+		tex = attr(n, "alttext")
+	}
+	if strings.TrimSpace(tex) == "" {
+		tex = mathMLToTeX(n)
+	}
+	tex = strings.TrimSpace(tex)
+	// Wikipedia wraps its TeX in {\displaystyle ...}.
+	for _, style := range []string{`{\displaystyle `, `{\textstyle `} {
+		if strings.HasPrefix(tex, style) && strings.HasSuffix(tex, "}") {
+			tex = strings.TrimSpace(tex[len(style) : len(tex)-1])
+		}
+	}
+	return tex
+}
+
+// mathMLToTeX rebuilds TeX from presentation MathML. It covers the common
+// elements: tokens, scripts, fractions, roots, fences and tables.
+func mathMLToTeX(n *html.Node) string {
+	var args []string
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode {
+			args = append(args, mathMLToTeX(c))
+		}
+	}
+	arg := func(i int) string {
+		if i < len(args) {
+			return texGroup(args[i])
+		}
+		return "{}"
+	}
+
+	switch n.Data {
+	case "mi", "mo", "mn":
+		text := strings.TrimSpace(innerText(n))
+		if op, ok := texOperators[text]; ok {
+			return op
+		}
+		return text
+	case "mtext":
+		return `\text{` + innerText(n) + "}"
+	case "mspace":
+		return " "
+	case "msup", "mover":
+		return arg(0) + "^" + arg(1)
+	case "msub", "munder":
+		return arg(0) + "_" + arg(1)
+	case "msubsup", "munderover":
+		return arg(0) + "_" + arg(1) + "^" + arg(2)
+	case "mfrac":
+		return `\frac` + arg(0) + arg(1)
+	case "msqrt":
+		return `\sqrt{` + strings.Join(args, "") + "}"
+	case "mroot":
+		return `\sqrt[` + strings.Trim(arg(1), "{}") + "]" + arg(0)
+	case "mfenced":
+		open, close := "(", ")"
+		if hasAttr(n, "open") {
+			open = attr(n, "open")
+		}
+		if hasAttr(n, "close") {
+			close = attr(n, "close")
+		}
+		return `\left` + texDelimiter(open) + strings.Join(args, ", ") + `\right` + texDelimiter(close)
+	case "mtable":
+		return `\begin{matrix}` + strings.Join(args, ` \\ `) + `\end{matrix}`
+	case "mtr", "mlabeledtr":
+		return strings.Join(args, " & ")
+	case "semantics":
+		// The first child is the presentation; the rest are annotations.
+		if len(args) > 0 {
+			return args[0]
+		}
+		return ""
+	case "annotation", "annotation-xml", "mphantom":
+		return ""
+	}
+	return strings.Join(args, "")
+}
+
+// texGroup braces s unless it is a single character or command.
+func texGroup(s string) string {
+	s = strings.TrimSpace(s)
+	if len([]rune(s)) == 1 {
+		return s
+	}
+	if name, ok := strings.CutPrefix(s, `\`); ok && name != "" && strings.Trim(name, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ") == "" {
+		return s
+	}
+	return "{" + s + "}"
+}
+
+// texDelimiter returns the TeX for a fence character; an empty fence is
+// written as ".".
+func texDelimiter(d string) string {
+	switch d {
+	case "":
+		return "."
+	case "{", "}":
+		return `\` + d
+	case "⟨":
+		return `\langle `
+	case "⟩":
+		return `\rangle `
+	}
+	return d
+}
+
+// setAttr sets n's attribute key to val.
+func setAttr(n *html.Node, key, val string) {
+	for i := range n.Attr {
+		if n.Attr[i].Key == key {
+			n.Attr[i].Val = val
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: val})
+}
@@ -0,0 +1,87 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+func TestHTMLToMarkdown_Math(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{
+			name: "katex inline",
+			html: `<p>Energy <span class="katex"><span class="katex-mathml"><math xmlns="http://www.w3.org/1998/Math/MathML"><semantics><mrow><mi>E</mi><mo>=</mo><mi>m</mi><msup><mi>c</mi><mn>2</mn></msup></mrow><annotation encoding="application/x-tex">E = mc^2</annotation></semantics></math></span><span class="katex-html" aria-hidden="true"><span class="base"><span class="mord mathnormal">E</span><span class="mrel">=</span><span class="mord mathnormal">m</span><span class="mord"><span class="mord mathnormal">c</span><span class="msupsub">2</span></span></span></span></span> holds.</p>`,
+			want: "Energy $E = mc^2$ holds.",
+		},
+		{
+			name: "katex display",
+			html: `<p>Sum:</p><span class="katex-display"><span class="katex"><span class="katex-mathml"><math><semantics><mrow></mrow><annotation encoding="application/x-tex">\sum_{i=1}^n x_i</annotation></semantics></math></span><span class="katex-html">∑i=1nxi</span></span></span>`,
+			want: "Sum:\n\n$$\n\\sum_{i=1}^n x_i\n$$",
+		},
+		{
+			name: "mathjax 2 scripts",
+			html: `<p>Let <span class="MathJax_Preview"></span><span class="MathJax" id="MathJax-Element-1-Frame"><nobr>a*b</nobr></span><script type="math/tex" id="MathJax-Element-1">a_1 * b_2</script> be given.</p><div class="MathJax_Display"><span>garbled</span></div><script type="math/tex; mode=display">\int_0^1 f(x)\,dx</script>`,
+			want: "Let $a_1 * b_2$ be given.\n\n$$\n\\int_0^1 f(x)\\,dx\n$$",
+		},
+		{
+			name: "mathjax 3 assistive mathml",
+			html: `<p>Root <mjx-container class="MathJax" jax="CHTML"><mjx-math><mjx-mi>x</mjx-mi></mjx-math><mjx-assistive-mml><math><msqrt><mi>x</mi></msqrt></math></mjx-assistive-mml></mjx-container>.</p>`,
+			want: "Root $\\sqrt{x}$.",
+		},
+		{
+			name: "wikipedia",
+			html: `<p>Area <span class="mwe-math-element"><span class="mwe-math-mathml-inline mwe-math-mathml-a11y" style="display: none;"><math alttext="{\displaystyle \pi r^{2}}"><semantics><mrow><mi>π</mi><msup><mi>r</mi><mn>2</mn></msup></mrow><annotation encoding="application/x-tex">{\displaystyle \pi r^{2}}</annotation></semantics></math></span><img src="https://wikimedia.org/api/rest_v1/media/math/render/svg/abc" class="mwe-math-fallback-image-inline" alt="{\displaystyle \pi r^{2}}"></span> of a circle.</p>`,
+			want: "Area $\\pi r^{2}$ of a circle.",
+		},
+		{
+			name: "arxiv latexml alttext",
+			html: `<p>Loss <math alttext="\mathcal{L}_{\theta}" class="ltx_Math" display="inline"><mrow><msub><mi class="ltx_font_mathcaligraphic">ℒ</mi><mi>θ</mi></msub></mrow></math> falls.</p>`,
+			want: "Loss $\\mathcal{L}_{\\theta}$ falls.",
+		},
+		{
+			name: "plain mathml",
+			html: `<p><math display="block"><mfrac><mrow><mi>a</mi><mo>+</mo><mi>b</mi></mrow><mn>2</mn></mfrac><mo>≤</mo><msubsup><mi>x</mi><mi>i</mi><mn>2</mn></msubsup></math></p>`,
+			want: "$$\n\\frac{a+b}2\\leq x_i^2\n$$",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := HTMLToMarkdown(tt.html)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMathMLToTeX(t *testing.T) {
+	tests := []struct {
+		html string
+		want string
+	}{
+		{`<math><mroot><mi>x</mi><mn>3</mn></mroot></math>`, `\sqrt[3]x`},
+		{`<math><mfenced><mi>a</mi><mi>b</mi></mfenced></math>`, `\left(a, b\right)`},
+		{`<math><mtable><mtr><mtd><mn>1</mn></mtd><mtd><mn>0</mn></mtd></mtr><mtr><mtd><mn>0</mn></mtd><mtd><mn>1</mn></mtd></mtr></mtable></math>`, `\begin{matrix}1 & 0 \\ 0 & 1\end{matrix}`},
+		{`<math><munderover><mo>∑</mo><mrow><mi>k</mi><mo>=</mo><mn>1</mn></mrow><mi>n</mi></munderover><mi>k</mi></math>`, `\sum_{k=1}^nk`},
+		{`<math><mtext>if</mtext><mi>x</mi></math>`, `\text{if}x`},
+	}
+	for _, tt := range tests {
+		doc, err := html.Parse(strings.NewReader(tt.html))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := mathTeX(findElement(doc, atom.Math)); got != tt.want {
+			t.Errorf("mathTeX(%s) = %q, want %q", tt.html, got, tt.want)
+		}
+	}
+}
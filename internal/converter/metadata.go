@@ -0,0 +1,117 @@
+package converter
+
+import (
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Metadata describes a converted document. The page fields are read from
+// the HTML by ExtractMetadata; the fetch fields are filled in by the caller.
+// It is rendered as YAML front matter by FrontMatter.
+type Metadata struct {
+	Title       string `yaml:"title,omitempty"`
+	Description string `yaml:"description,omitempty"`
+	Canonical   string `yaml:"canonical,omitempty"`
+	Author      string `yaml:"author,omitempty"`
+	Published   string `yaml:"published,omitempty"`
+	Language    string `yaml:"language,omitempty"`
+
+	// Source is the URL the document was fetched from.
+	Source    string    `yaml:"source,omitempty"`
+	FetchedAt time.Time `yaml:"fetched_at,omitempty"`
+	Status    int       `yaml:"status,omitempty"`
+	// Tokens is the token count of the Markdown body, if it was counted.
+	Tokens *int `yaml:"tokens,omitempty"`
+}
+
+// ExtractMetadata reads the title, description, canonical URL, author,
+// publication date and language of an HTML document. Standard tags are
+// preferred, with OpenGraph and similar properties as fallbacks. A relative
+// canonical URL is resolved against pageURL, honoring <base href>.
+func ExtractMetadata(htmlStr, pageURL string) Metadata {
+	var m Metadata
+	doc, err := html.Parse(strings.NewReader(htmlStr))
+	if err != nil {
+		return m
+	}
+
+	// meta holds the first content given for each meta name or property.
+	meta := map[string]string{}
+	var title, canonical string
+	walkElements(doc, func(n *html.Node) {
+		switch n.DataAtom {
+		case atom.Html:
+			m.Language = attr(n, "lang")
+		case atom.Title:
+			if title == "" {
+				title = innerText(n)
+			}
+		case atom.Link:
+			if canonical == "" && hasToken(attr(n, "rel"), "canonical") {
+				canonical = attr(n, "href")
+			}
+		case atom.Meta:
+			name := attr(n, "name")
+			if name == "" {
+				name = attr(n, "property")
+			}
+			if name == "" {
+				name = attr(n, "itemprop")
+			}
+			if name == "" {
+				name = attr(n, "http-equiv")
+			}
+			name = strings.ToLower(name)
+			if content := strings.TrimSpace(attr(n, "content")); name != "" && content != "" && meta[name] == "" {
+				meta[name] = content
+			}
+		}
+	})
+
+	m.Title = first(title, meta["og:title"], meta["twitter:title"])
+	m.Description = first(meta["description"], meta["og:description"], meta["twitter:description"])
+	m.Canonical = first(canonical, meta["og:url"])
+	if base := documentBase(doc, pageURL); base != nil && pageURL != "" {
+		m.Canonical = resolveURL(base, m.Canonical)
+	}
+	m.Author = first(meta["author"], meta["article:author"], meta["dc.creator"], meta["twitter:creator"])
+	m.Published = first(meta["article:published_time"], meta["datepublished"], meta["date"], meta["dc.date"], meta["pubdate"])
+	m.Language = first(m.Language, meta["content-language"], meta["og:locale"])
+	return m
+}
+
+// FrontMatter renders m as a YAML front matter block, including the
+// closing delimiter and a blank line, ready to prepend to Markdown.
+func (m Metadata) FrontMatter() string {
+	m.FetchedAt = m.FetchedAt.UTC().Truncate(time.Second)
+	out, err := yaml.Marshal(m)
+	if err != nil {
+		return ""
+	}
+	return "---\n" + string(out) + "---\n\n"
+}
+
+// hasToken reports whether the space-separated list s contains token,
+// ignoring case.
+func hasToken(s, token string) bool {
+	for _, f := range strings.Fields(s) {
+		if strings.EqualFold(f, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// first returns the first non-empty value.
+func first(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,72 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExtractMetadata(t *testing.T) {
+	page := `<!DOCTYPE html><html lang="en-GB"><head>
+<title> Growing   tomatoes </title>
+<meta name="description" content="How to grow tomatoes at home.">
+<meta property="og:description" content="Ignored in favour of the description.">
+<meta name="author" content="Ada Gardener">
+<meta property="article:published_time" content="2024-05-01T08:00:00Z">
+<link rel="alternate stylesheet" href="/print.css">
+<link rel="canonical" href="../tomatoes">
+</head><body><h1>Tomatoes</h1></body></html>`
+
+	m := ExtractMetadata(page, "https://example.com/garden/tomatoes")
+	want := Metadata{
+		Title:       "Growing tomatoes",
+		Description: "How to grow tomatoes at home.",
+		Canonical:   "https://example.com/tomatoes",
+		Author:      "Ada Gardener",
+		Published:   "2024-05-01T08:00:00Z",
+		Language:    "en-GB",
+	}
+	if m != want {
+		t.Errorf("ExtractMetadata = %+v, want %+v", m, want)
+	}
+}
+
+func TestExtractMetadata_OpenGraphFallback(t *testing.T) {
+	m := ExtractMetadata(`<html><head>
+<meta property="og:title" content="OG title">
+<meta property="og:url" content="https://example.com/og">
+<meta property="og:locale" content="fr_FR">
+</head><body></body></html>`, "")
+	if m.Title != "OG title" || m.Canonical != "https://example.com/og" || m.Language != "fr_FR" {
+		t.Errorf("expected OpenGraph fallbacks, got %+v", m)
+	}
+}
+
+func TestMetadata_FrontMatter(t *testing.T) {
+	tokens := 42
+	m := Metadata{
+		Title:     `Tomatoes: a "how-to"`,
+		Source:    "https://example.com/tomatoes",
+		FetchedAt: time.Date(2024, 5, 1, 8, 0, 0, 123, time.UTC),
+		Status:    200,
+		Tokens:    &tokens,
+	}
+	fm := m.FrontMatter()
+	if !strings.HasPrefix(fm, "---\n") || !strings.HasSuffix(fm, "---\n\n") {
+		t.Fatalf("expected a delimited block, got %q", fm)
+	}
+	for _, want := range []string{
+		`title: 'Tomatoes: a "how-to"'`,
+		"source: https://example.com/tomatoes",
+		"fetched_at: 2024-05-01T08:00:00Z",
+		"status: 200",
+		"tokens: 42",
+	} {
+		if !strings.Contains(fm, want+"\n") {
+			t.Errorf("expected front matter to contain %q, got:\n%s", want, fm)
+		}
+	}
+	if strings.Contains(fm, "description") {
+		t.Errorf("expected empty fields to be omitted, got:\n%s", fm)
+	}
+}
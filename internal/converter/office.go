@@ -0,0 +1,269 @@
+package converter
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Format names of the Office Open XML converters.
+const (
+	FormatDOCX = "docx"
+	FormatXLSX = "xlsx"
+	FormatPPTX = "pptx"
+)
+
+// DOCXConverter converts Word documents with DOCXToMarkdown.
+var DOCXConverter = &Converter{
+	Format:     FormatDOCX,
+	MediaTypes: []string{"application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+	Binary:     true,
+	Convert: func(in Input) (string, error) {
+		return DOCXToMarkdown(in.Body)
+	},
+}
+
+// XLSXConverter converts Excel workbooks with XLSXToMarkdown.
+var XLSXConverter = &Converter{
+	Format:     FormatXLSX,
+	MediaTypes: []string{"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+	Binary:     true,
+	Convert: func(in Input) (string, error) {
+		return XLSXToMarkdown(in.Body)
+	},
+}
+
+// PPTXConverter converts PowerPoint presentations with PPTXToMarkdown.
+var PPTXConverter = &Converter{
+	Format:     FormatPPTX,
+	MediaTypes: []string{"application/vnd.openxmlformats-officedocument.presentationml.presentation"},
+	Binary:     true,
+	Convert: func(in Input) (string, error) {
+		return PPTXToMarkdown(in.Body)
+	},
+}
+
+// relNS is the namespace of the relationship IDs that link Office parts.
+const relNS = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+
+// maxOfficePart caps the decompressed size of a part of an Office
+// document, so that a small archive cannot expand without bound.
+const maxOfficePart = 64 << 20
+
+// officePackage is an Office Open XML document: a zip archive of XML
+// parts.
+type officePackage struct {
+	parts map[string]*zip.File
+}
+
+func openOffice(body []byte) (*officePackage, error) {
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return nil, fmt.Errorf("reading Office document: %w", err)
+	}
+	pkg := &officePackage{parts: make(map[string]*zip.File, len(zr.File))}
+	for _, f := range zr.File {
+		pkg.parts[strings.TrimPrefix(f.Name, "/")] = f
+	}
+	return pkg, nil
+}
+
+// has reports whether the document holds the named part.
+func (p *officePackage) has(name string) bool {
+	_, ok := p.parts[name]
+	return ok
+}
+
+// read returns the content of the named part.
+func (p *officePackage) read(name string) ([]byte, error) {
+	f, ok := p.parts[name]
+	if !ok {
+		return nil, fmt.Errorf("reading Office document: missing part %s", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", name, err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, maxOfficePart+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", name, err)
+	}
+	if len(data) > maxOfficePart {
+		return nil, fmt.Errorf("reading %s: part exceeds %d bytes", name, maxOfficePart)
+	}
+	return data, nil
+}
+
+// decode unmarshals the named part into v.
+func (p *officePackage) decode(name string, v any) error {
+	data, err := p.read(name)
+	if err != nil {
+		return err
+	}
+	if err := xml.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("parsing %s: %w", name, err)
+	}
+	return nil
+}
+
+// decoder returns a token decoder over the named part.
+func (p *officePackage) decoder(name string) (*xml.Decoder, error) {
+	data, err := p.read(name)
+	if err != nil {
+		return nil, err
+	}
+	return xml.NewDecoder(bytes.NewReader(data)), nil
+}
+
+// rels returns the targets of the relationships of the named part, keyed
+// by relationship ID. Internal targets are resolved to part names;
+// external ones, such as hyperlinks, are returned as they are.
+func (p *officePackage) rels(name string) (map[string]string, error) {
+	dir, file := path.Split(name)
+	relsName := dir + "_rels/" + file + ".rels"
+	targets := map[string]string{}
+	if !p.has(relsName) {
+		return targets, nil
+	}
+	var doc struct {
+		Rels []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+			Mode   string `xml:"TargetMode,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := p.decode(relsName, &doc); err != nil {
+		return nil, err
+	}
+	for _, r := range doc.Rels {
+		switch {
+		case r.Mode == "External":
+			targets[r.ID] = r.Target
+		case strings.HasPrefix(r.Target, "/"):
+			targets[r.ID] = strings.TrimPrefix(r.Target, "/")
+		default:
+			targets[r.ID] = path.Join(dir, r.Target)
+		}
+	}
+	return targets, nil
+}
+
+// xmlAttr returns the value of the attribute of e with the given local
+// name, in any namespace.
+func xmlAttr(e xml.StartElement, local string) string {
+	for _, a := range e.Attr {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// maxListLevel is the deepest list level Word and PowerPoint offer.
+const maxListLevel = 8
+
+// listLevel parses a list level attribute. Invalid and negative levels are
+// 0, and levels past maxListLevel are maxListLevel.
+func listLevel(s string) int {
+	level, err := strconv.Atoi(s)
+	if err != nil {
+		return 0
+	}
+	return min(max(level, 0), maxListLevel)
+}
+
+// relID returns the relationship ID an element refers to.
+func relID(e xml.StartElement) string {
+	for _, a := range e.Attr {
+		if a.Name.Space == relNS && a.Name.Local == "id" {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// officeTable reads the rows of a table up to the end of its element. The
+// text of each cell is read with paragraph, called at the start of every
+// paragraph in it; the paragraphs of a cell are joined by spaces, and
+// nested tables are flattened into the cell that holds them.
+func officeTable(dec *xml.Decoder, paragraph func(*xml.Decoder) (string, error)) ([][]string, error) {
+	var rows [][]string
+	var cell []string
+	nested := 0
+	for depth := 1; depth > 0; {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "tbl":
+				nested++
+			case "tr":
+				if nested == 0 {
+					rows = append(rows, nil)
+				}
+			case "tc":
+				if nested == 0 {
+					cell = nil
+				}
+			case "p":
+				text, err := paragraph(dec)
+				if err != nil {
+					return nil, err
+				}
+				if text != "" {
+					cell = append(cell, text)
+				}
+				continue
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+			switch t.Name.Local {
+			case "tbl":
+				nested--
+			case "tc":
+				if nested == 0 && len(rows) > 0 {
+					rows[len(rows)-1] = append(rows[len(rows)-1], strings.Join(cell, " "))
+				}
+			}
+		}
+	}
+	return rows, nil
+}
+
+// markdownTable renders rows as a Markdown table with the first row as
+// header. Short rows are padded to the width of the longest.
+func markdownTable(rows [][]string) string {
+	cols := 0
+	for _, r := range rows {
+		cols = max(cols, len(r))
+	}
+	var b strings.Builder
+	row := func(cells []string) {
+		for i := range cols {
+			c := ""
+			if i < len(cells) {
+				c = strings.Join(strings.Fields(cells[i]), " ")
+			}
+			b.WriteString("| ")
+			b.WriteString(strings.ReplaceAll(c, "|", `\|`))
+			b.WriteString(" ")
+		}
+		b.WriteString("|\n")
+	}
+	row(rows[0])
+	b.WriteString(strings.Repeat("| --- ", cols) + "|\n")
+	for _, r := range rows[1:] {
+		row(r)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
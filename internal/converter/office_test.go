@@ -0,0 +1,75 @@
+package converter
+
+import (
+	"archive/zip"
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Namespace declarations for the XML parts of test documents.
+const (
+	wordNS  = `xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"`
+	sheetNS = `xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"`
+	slideNS = `xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" xmlns:p="http://schemas.openxmlformats.org/presentationml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"`
+)
+
+// officeZip packs parts, keyed by name, into an Office document.
+func officeZip(t *testing.T, parts map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range parts {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// rels returns a relationships part mapping each rId<n> to the nth target.
+func relsPart(targets ...string) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?><Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i, target := range targets {
+		mode := ""
+		if strings.HasPrefix(target, "http") {
+			mode = ` TargetMode="External"`
+		}
+		b.WriteString(`<Relationship Id="rId` + strconv.Itoa(i+1) + `" Type="x" Target="` + target + `"` + mode + `/>`)
+	}
+	b.WriteString(`</Relationships>`)
+	return b.String()
+}
+
+func TestMarkdownTable(t *testing.T) {
+	got := markdownTable([][]string{{"Name", "Note"}, {"a|b"}, {"c", "multi\nline"}})
+	want := "| Name | Note |\n| --- | --- |\n| a\\|b |  |\n| c | multi line |"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestOfficeToMarkdown_Invalid(t *testing.T) {
+	empty := officeZip(t, map[string]string{"readme.txt": "not an office document"})
+	for name, convert := range map[string]func([]byte) (string, error){
+		"docx": DOCXToMarkdown,
+		"xlsx": XLSXToMarkdown,
+		"pptx": PPTXToMarkdown,
+	} {
+		if _, err := convert([]byte("not a zip")); err == nil {
+			t.Errorf("%s: expected an error for a body that is not a zip", name)
+		}
+		if _, err := convert(empty); err == nil {
+			t.Errorf("%s: expected an error for a zip without the main part", name)
+		}
+	}
+}
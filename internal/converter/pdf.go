@@ -0,0 +1,273 @@
+package converter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// FormatPDF is the format name of the PDF converter.
+const FormatPDF = "pdf"
+
+// PDFConverter extracts the text of PDF documents as Markdown with
+// PDFToMarkdown.
+var PDFConverter = &Converter{
+	Format:     FormatPDF,
+	MediaTypes: []string{"application/pdf"},
+	Binary:     true,
+	Convert: func(in Input) (string, error) {
+		return PDFToMarkdown(in.Body)
+	},
+}
+
+// Layout thresholds for PDF text, as multiples of the font size.
+const (
+	// pdfLineTolerance is how far apart baselines may be on one line.
+	pdfLineTolerance = 0.5
+	// pdfWordGap is the horizontal gap that separates two words.
+	pdfWordGap = 0.15
+	// pdfColumnGap is the horizontal gap that separates two table cells.
+	pdfColumnGap = 2.0
+	// pdfParagraphGap is the distance between baselines that starts a new
+	// paragraph.
+	pdfParagraphGap = 1.6
+	// pdfHeadingRatio is how much larger than the body text a heading is.
+	pdfHeadingRatio = 1.15
+)
+
+// pdfPageBreak separates the pages of a PDF in its Markdown.
+const pdfPageBreak = "\n\n---\n\n"
+
+// pdfLine is a line of text on a PDF page, split into cells where its
+// words are far apart.
+type pdfLine struct {
+	Y     float64 // baseline, measured from the bottom of the page
+	Size  float64 // largest font size on the line
+	Cells []string
+}
+
+// PDFToMarkdown extracts the text of a PDF document as Markdown. Lines set
+// clearly larger than the body text become headings, ranked by size; runs
+// of lines split into the same number of widely spaced columns become
+// tables; and pages are separated by thematic breaks. Documents without a
+// text layer, such as scans, fail to convert.
+func PDFToMarkdown(body []byte) (md string, err error) {
+	// The PDF reader panics on malformed documents.
+	defer func() {
+		if r := recover(); r != nil {
+			md, err = "", fmt.Errorf("reading PDF: %v", r)
+		}
+	}()
+
+	r, err := pdf.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return "", fmt.Errorf("reading PDF: %w", err)
+	}
+	var pages [][]pdfLine
+	for i := 1; i <= r.NumPage(); i++ {
+		p := r.Page(i)
+		if p.V.IsNull() {
+			continue
+		}
+		if lines := pdfLines(p.Content().Text); len(lines) > 0 {
+			pages = append(pages, lines)
+		}
+	}
+	if len(pages) == 0 {
+		return "", errors.New("PDF has no extractable text")
+	}
+
+	bodySize := pdfBodySize(pages)
+	levels := pdfHeadingLevels(pages, bodySize)
+	out := make([]string, len(pages))
+	for i, lines := range pages {
+		out[i] = pdfPage(lines, levels)
+	}
+	return strings.Join(out, pdfPageBreak), nil
+}
+
+// pdfLines groups the glyphs of a page into lines, top to bottom.
+func pdfLines(glyphs []pdf.Text) []pdfLine {
+	sort.SliceStable(glyphs, func(i, j int) bool { return glyphs[i].Y > glyphs[j].Y })
+
+	var lines []pdfLine
+	var run []pdf.Text
+	flush := func() {
+		if line, ok := pdfLineOf(run); ok {
+			lines = append(lines, line)
+		}
+		run = run[:0]
+	}
+	for _, g := range glyphs {
+		if g.S == "\n" {
+			// The reader marks the end of each TJ array with a newline.
+			continue
+		}
+		if len(run) > 0 && run[0].Y-g.Y > pdfLineTolerance*math.Max(run[0].FontSize, 1) {
+			flush()
+		}
+		run = append(run, g)
+	}
+	flush()
+	return lines
+}
+
+// pdfLineOf assembles the glyphs on one baseline into a line, left to
+// right. It reports false when the glyphs hold no text.
+func pdfLineOf(glyphs []pdf.Text) (pdfLine, bool) {
+	if len(glyphs) == 0 {
+		return pdfLine{}, false
+	}
+	sort.SliceStable(glyphs, func(i, j int) bool { return glyphs[i].X < glyphs[j].X })
+
+	line := pdfLine{Y: glyphs[0].Y}
+	var cell strings.Builder
+	addCell := func() {
+		if text := strings.Join(strings.Fields(cell.String()), " "); text != "" {
+			line.Cells = append(line.Cells, text)
+		}
+		cell.Reset()
+	}
+	var end float64
+	for i, g := range glyphs {
+		if strings.TrimSpace(g.S) != "" && g.FontSize > line.Size {
+			line.Size = g.FontSize
+		}
+		if i > 0 {
+			switch gap := g.X - end; {
+			case gap > pdfColumnGap*g.FontSize:
+				addCell()
+			case gap > pdfWordGap*g.FontSize:
+				cell.WriteByte(' ')
+			}
+		}
+		cell.WriteString(g.S)
+		end = g.X + g.W
+	}
+	addCell()
+	return line, len(line.Cells) > 0
+}
+
+// pdfSize rounds a font size to half a point, so that sizes differing
+// only by rounding in the document compare equal.
+func pdfSize(size float64) float64 {
+	return math.Round(size*2) / 2
+}
+
+// pdfBodySize returns the font size most of the text is set in.
+func pdfBodySize(pages [][]pdfLine) float64 {
+	chars := map[float64]int{}
+	for _, lines := range pages {
+		for _, l := range lines {
+			for _, c := range l.Cells {
+				chars[pdfSize(l.Size)] += len(c)
+			}
+		}
+	}
+	var body float64
+	for size, n := range chars {
+		if n > chars[body] || n == chars[body] && size < body {
+			body = size
+		}
+	}
+	return body
+}
+
+// pdfHeadingLevels maps the font sizes used for headings to heading
+// levels: the largest size is level 1, the next level 2, and any smaller
+// ones level 3.
+func pdfHeadingLevels(pages [][]pdfLine, bodySize float64) map[float64]int {
+	seen := map[float64]bool{}
+	var sizes []float64
+	for _, lines := range pages {
+		for _, l := range lines {
+			size := pdfSize(l.Size)
+			if size >= bodySize*pdfHeadingRatio && !seen[size] {
+				seen[size] = true
+				sizes = append(sizes, size)
+			}
+		}
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(sizes)))
+	levels := make(map[float64]int, len(sizes))
+	for i, size := range sizes {
+		levels[size] = min(i+1, 3)
+	}
+	return levels
+}
+
+// pdfPage renders the lines of a page as Markdown blocks. Consecutive
+// lines of the same size and role that sit close together are joined into
+// one paragraph or heading.
+func pdfPage(lines []pdfLine, levels map[float64]int) string {
+	var blocks, text []string
+	var level int
+	flush := func() {
+		if len(text) == 0 {
+			return
+		}
+		block := strings.Join(text, " ")
+		if level > 0 {
+			block = strings.Repeat("#", level) + " " + block
+		}
+		blocks = append(blocks, block)
+		text = nil
+	}
+
+	var prev *pdfLine
+	for i := 0; i < len(lines); i++ {
+		if n := pdfTableRows(lines[i:]); n > 0 {
+			flush()
+			blocks = append(blocks, pdfTable(lines[i:i+n]))
+			i += n - 1
+			prev = nil
+			continue
+		}
+		l := &lines[i]
+		lineLevel := 0
+		if len(l.Cells) == 1 {
+			lineLevel = levels[pdfSize(l.Size)]
+		}
+		if prev == nil || lineLevel != level || pdfSize(l.Size) != pdfSize(prev.Size) ||
+			prev.Y-l.Y > pdfParagraphGap*prev.Size {
+			flush()
+		}
+		text = append(text, strings.Join(l.Cells, " "))
+		level = lineLevel
+		prev = l
+	}
+	flush()
+	return strings.Join(blocks, "\n\n")
+}
+
+// pdfTableRows returns the number of lines at the start of lines that form
+// a table: at least two lines split into the same number of cells, two or
+// more. It returns 0 when they do not.
+func pdfTableRows(lines []pdfLine) int {
+	cols := len(lines[0].Cells)
+	if cols < 2 {
+		return 0
+	}
+	n := 1
+	for n < len(lines) && len(lines[n].Cells) == cols {
+		n++
+	}
+	if n < 2 {
+		return 0
+	}
+	return n
+}
+
+// pdfTable renders rows as a Markdown table with the first row as header.
+func pdfTable(rows []pdfLine) string {
+	cells := make([][]string, len(rows))
+	for i, r := range rows {
+		cells[i] = r.Cells
+	}
+	return markdownTable(cells)
+}
@@ -0,0 +1,102 @@
+package converter
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// pdfText is a line of text placed on a test PDF page.
+type pdfText struct {
+	X, Y, Size float64
+	Text       string
+}
+
+// buildPDF writes a minimal PDF with one page per element of pages, set in
+// a font whose glyphs are all half an em wide.
+func buildPDF(pages ...[]pdfText) []byte {
+	var objs []string
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	objs = append(objs,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding /FirstChar 32 /LastChar 126 /Widths ["+
+			strings.TrimSpace(strings.Repeat("500 ", 95))+"] >>",
+	)
+	for i, texts := range pages {
+		var content strings.Builder
+		for _, t := range texts {
+			fmt.Fprintf(&content, "BT /F1 %g Tf %g %g Td (%s) Tj ET\n", t.Size, t.X, t.Y, t.Text)
+		}
+		objs = append(objs,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", 5+2*i),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+		)
+	}
+
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objs))
+	for i, obj := range objs {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objs)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objs)+1, xref)
+	return b.Bytes()
+}
+
+var reportPDF = buildPDF(
+	[]pdfText{
+		{72, 740, 24, "Quarterly Report"},
+		{72, 700, 16, "Summary"},
+		{72, 670, 11, "Revenue grew in every region,"},
+		{72, 657, 11, "driven by new customers."},
+		{72, 630, 11, "A second paragraph."},
+		{72, 600, 11, "Region"}, {300, 600, 11, "Sales"},
+		{72, 586, 11, "North"}, {300, 586, 11, "120"},
+		{72, 572, 11, "South"}, {300, 572, 11, "95"},
+	},
+	[]pdfText{
+		{72, 740, 16, "Appendix"},
+		{72, 710, 11, "More text here."},
+	},
+)
+
+func TestPDFToMarkdown(t *testing.T) {
+	md, err := PDFToMarkdown(reportPDF)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "# Quarterly Report\n\n" +
+		"## Summary\n\n" +
+		"Revenue grew in every region, driven by new customers.\n\n" +
+		"A second paragraph.\n\n" +
+		"| Region | Sales |\n| --- | --- |\n| North | 120 |\n| South | 95 |" +
+		"\n\n---\n\n" +
+		"## Appendix\n\n" +
+		"More text here."
+	if md != want {
+		t.Errorf("got:\n%s\nwant:\n%s", md, want)
+	}
+}
+
+func TestPDFToMarkdown_Invalid(t *testing.T) {
+	for name, body := range map[string][]byte{
+		"not a PDF": []byte("<html>not a pdf</html>"),
+		"truncated": reportPDF[:len(reportPDF)/2],
+		"no text":   buildPDF([]pdfText{}),
+	} {
+		if _, err := PDFToMarkdown(body); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
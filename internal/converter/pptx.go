@@ -0,0 +1,167 @@
+package converter
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// pptxPresentation is the part listing the slides of a presentation.
+const pptxPresentation = "ppt/presentation.xml"
+
+// pptxShape is the text of a shape on a slide.
+type pptxShape struct {
+	title       bool // title placeholder
+	placeholder bool // any placeholder, such as the slide body
+	paragraphs  []string
+	levels      []int
+}
+
+// PPTXToMarkdown converts a PowerPoint presentation to Markdown: a section
+// per slide, headed with the slide number and title. The text of the
+// slide's body placeholders becomes a bulleted list, other text boxes
+// become paragraphs, and tables become tables.
+func PPTXToMarkdown(body []byte) (string, error) {
+	pkg, err := openOffice(body)
+	if err != nil {
+		return "", err
+	}
+	var presentation struct {
+		Slides []struct {
+			ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sldIdLst>sldId"`
+	}
+	if err := pkg.decode(pptxPresentation, &presentation); err != nil {
+		return "", err
+	}
+	targets, err := pkg.rels(pptxPresentation)
+	if err != nil {
+		return "", err
+	}
+
+	sections := make([]string, 0, len(presentation.Slides))
+	for i, s := range presentation.Slides {
+		target, ok := targets[s.ID]
+		if !ok {
+			return "", fmt.Errorf("reading Office document: slide %d has no part", i+1)
+		}
+		dec, err := pkg.decoder(target)
+		if err != nil {
+			return "", err
+		}
+		title, blocks, err := pptxSlide(dec)
+		if err != nil {
+			return "", fmt.Errorf("parsing %s: %w", target, err)
+		}
+		heading := "## Slide " + strconv.Itoa(i+1)
+		if title != "" {
+			heading += ": " + title
+		}
+		sections = append(sections, strings.Join(append([]string{heading}, blocks...), "\n\n"))
+	}
+	return strings.Join(sections, "\n\n"), nil
+}
+
+// pptxSlide reads a slide, returning its title and its other content as
+// Markdown blocks.
+func pptxSlide(dec *xml.Decoder) (string, []string, error) {
+	var title string
+	var blocks []string
+	var shape *pptxShape
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return title, blocks, nil
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "sp":
+				shape = &pptxShape{}
+			case "ph":
+				if shape != nil {
+					shape.placeholder = true
+					typ := xmlAttr(t, "type")
+					shape.title = typ == "title" || typ == "ctrTitle"
+				}
+			case "p":
+				text, level, err := drawingParagraph(dec)
+				if err != nil {
+					return "", nil, err
+				}
+				if shape != nil && text != "" {
+					shape.paragraphs = append(shape.paragraphs, text)
+					shape.levels = append(shape.levels, level)
+				}
+			case "tbl":
+				rows, err := officeTable(dec, func(dec *xml.Decoder) (string, error) {
+					text, _, err := drawingParagraph(dec)
+					return text, err
+				})
+				if err != nil {
+					return "", nil, err
+				}
+				if len(rows) > 0 {
+					blocks = append(blocks, markdownTable(rows))
+				}
+			}
+		case xml.EndElement:
+			if t.Name.Local != "sp" || shape == nil {
+				continue
+			}
+			switch {
+			case len(shape.paragraphs) == 0:
+			case shape.title && title == "":
+				title = strings.Join(shape.paragraphs, " ")
+			case shape.placeholder:
+				items := make([]string, len(shape.paragraphs))
+				for i, p := range shape.paragraphs {
+					items[i] = strings.Repeat("    ", shape.levels[i]) + "- " + p
+				}
+				blocks = append(blocks, strings.Join(items, "\n"))
+			default:
+				blocks = append(blocks, shape.paragraphs...)
+			}
+			shape = nil
+		}
+	}
+}
+
+// drawingParagraph reads a DrawingML paragraph, as used in slides, up to
+// the end of its element, returning its text and outline level.
+func drawingParagraph(dec *xml.Decoder) (string, int, error) {
+	var text strings.Builder
+	level := 0
+	for depth := 1; depth > 0; {
+		tok, err := dec.Token()
+		if err != nil {
+			return "", 0, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "pPr":
+				level = listLevel(xmlAttr(t, "lvl"))
+			case "t":
+				var s string
+				if err := dec.DecodeElement(&s, &t); err != nil {
+					return "", 0, err
+				}
+				text.WriteString(s)
+				continue
+			case "br":
+				text.WriteString(" ")
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+	}
+	return strings.Join(strings.Fields(text.String()), " "), level, nil
+}
@@ -0,0 +1,64 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPPTXToMarkdown(t *testing.T) {
+	deck := officeZip(t, map[string]string{
+		"ppt/presentation.xml": `<p:presentation ` + slideNS + `><p:sldIdLst>
+<p:sldId id="256" r:id="rId2"/><p:sldId id="257" r:id="rId1"/>
+</p:sldIdLst></p:presentation>`,
+		"ppt/_rels/presentation.xml.rels": relsPart("slides/slide2.xml", "slides/slide1.xml"),
+		"ppt/slides/slide1.xml": `<p:sld ` + slideNS + `><p:cSld><p:spTree>
+<p:sp><p:nvSpPr><p:nvPr><p:ph type="ctrTitle"/></p:nvPr></p:nvSpPr><p:txBody><a:p><a:r><a:t>Roadmap</a:t></a:r><a:br/><a:r><a:t>2025</a:t></a:r></a:p></p:txBody></p:sp>
+<p:sp><p:nvSpPr><p:nvPr><p:ph idx="1"/></p:nvPr></p:nvSpPr><p:txBody>
+<a:p><a:r><a:t>Faster builds</a:t></a:r></a:p>
+<a:p><a:pPr lvl="1"/><a:r><a:t>Remote cache</a:t></a:r></a:p>
+</p:txBody></p:sp>
+<p:sp><p:nvSpPr><p:nvPr/></p:nvSpPr><p:txBody><a:p><a:r><a:t>Draft</a:t></a:r></a:p></p:txBody></p:sp>
+</p:spTree></p:cSld></p:sld>`,
+		"ppt/slides/slide2.xml": `<p:sld ` + slideNS + `><p:cSld><p:spTree>
+<p:graphicFrame><a:graphic><a:graphicData><a:tbl>
+<a:tr><a:tc><a:txBody><a:p><a:r><a:t>Quarter</a:t></a:r></a:p></a:txBody></a:tc><a:tc><a:txBody><a:p><a:r><a:t>Goal</a:t></a:r></a:p></a:txBody></a:tc></a:tr>
+<a:tr><a:tc><a:txBody><a:p><a:r><a:t>Q1</a:t></a:r></a:p></a:txBody></a:tc><a:tc><a:txBody><a:p><a:r><a:t>Beta</a:t></a:r></a:p></a:txBody></a:tc></a:tr>
+</a:tbl></a:graphicData></a:graphic></p:graphicFrame>
+</p:spTree></p:cSld></p:sld>`,
+	})
+
+	md, err := PPTXToMarkdown(deck)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "## Slide 1: Roadmap 2025\n\n" +
+		"- Faster builds\n    - Remote cache\n\n" +
+		"Draft\n\n" +
+		"## Slide 2\n\n" +
+		"| Quarter | Goal |\n| --- | --- |\n| Q1 | Beta |"
+	if md != want {
+		t.Errorf("got:\n%s\nwant:\n%s", md, want)
+	}
+}
+
+func TestPPTXToMarkdown_ListLevelClamped(t *testing.T) {
+	deck := officeZip(t, map[string]string{
+		"ppt/presentation.xml":            `<p:presentation ` + slideNS + `><p:sldIdLst><p:sldId id="256" r:id="rId1"/></p:sldIdLst></p:presentation>`,
+		"ppt/_rels/presentation.xml.rels": relsPart("slides/slide1.xml"),
+		"ppt/slides/slide1.xml": `<p:sld ` + slideNS + `><p:cSld><p:spTree>
+<p:sp><p:nvSpPr><p:nvPr><p:ph idx="1"/></p:nvPr></p:nvSpPr><p:txBody>
+<a:p><a:pPr lvl="-3"/><a:r><a:t>Negative</a:t></a:r></a:p>
+<a:p><a:pPr lvl="2000000000"/><a:r><a:t>Huge</a:t></a:r></a:p>
+</p:txBody></p:sp>
+</p:spTree></p:cSld></p:sld>`,
+	})
+
+	md, err := PPTXToMarkdown(deck)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "## Slide 1\n\n- Negative\n" + strings.Repeat("    ", maxListLevel) + "- Huge"
+	if md != want {
+		t.Errorf("got %q, want %q", md, want)
+	}
+}
@@ -0,0 +1,144 @@
+package converter
+
+import (
+	"errors"
+	"mime"
+	"strings"
+)
+
+// Format names of the HTML and JSON converters. They identify conversions
+// in cache keys.
+const (
+	FormatHTML = "html"
+	FormatJSON = "json"
+)
+
+// ErrNotApplicable is wrapped by the errors of converters given a document
+// they do not handle after all, such as XML served with a generic type that
+// is not a feed. Such documents are passed through unconverted rather than
+// reported as conversion failures.
+var ErrNotApplicable = errors.New("converter does not apply to the document")
+
+// Input is a document to convert and the settings that apply to it. Each
+// converter reads the settings for its format and ignores the others.
+type Input struct {
+	// Body is the document, decoded to UTF-8 unless the converter is
+	// Binary.
+	Body []byte
+	// HTML controls the conversion of HTML documents.
+	HTML Options
+	// Template is the Mustache template for JSON documents. When empty, a
+	// template is generated from the document's shape.
+	Template string
+	// FeedEntries caps the entries rendered from RSS and Atom feeds. Zero
+	// renders them all.
+	FeedEntries int
+}
+
+// Converter turns documents of one format into Markdown.
+type Converter struct {
+	// Format names the converter, e.g. FormatHTML.
+	Format string
+	// MediaTypes lists the media types the converter handles: full types
+	// such as "text/html", or structured syntax suffixes such as "+json",
+	// which match every type ending with them.
+	MediaTypes []string
+	// Binary marks converters of binary documents, such as PDF, whose
+	// body is passed as received rather than decoded to UTF-8. They need
+	// the whole document, so bodies over the size limit are not converted.
+	Binary bool
+	// Convert converts a document to Markdown.
+	Convert func(in Input) (string, error)
+}
+
+// HTMLConverter converts HTML and XHTML documents with ConvertHTML.
+var HTMLConverter = &Converter{
+	Format:     FormatHTML,
+	MediaTypes: []string{"text/html", "application/xhtml+xml"},
+	Convert: func(in Input) (string, error) {
+		return ConvertHTML(string(in.Body), in.HTML)
+	},
+}
+
+// JSONConverter converts JSON documents, including +json types such as
+// application/ld+json, with JSONToMarkdown.
+var JSONConverter = &Converter{
+	Format:     FormatJSON,
+	MediaTypes: []string{"application/json", "+json"},
+	Convert: func(in Input) (string, error) {
+		return JSONToMarkdown(in.Body, in.Template)
+	},
+}
+
+// Default holds the built-in converters.
+var Default = NewRegistry(HTMLConverter, JSONConverter, FeedConverter, PDFConverter, DOCXConverter, XLSXConverter, PPTXConverter)
+
+// Registry maps media types to the converters that handle them.
+type Registry struct {
+	converters []*Converter
+	types      map[string]*Converter
+	suffixes   map[string]*Converter
+}
+
+// NewRegistry returns a registry holding the given converters.
+func NewRegistry(converters ...*Converter) *Registry {
+	r := &Registry{
+		types:    map[string]*Converter{},
+		suffixes: map[string]*Converter{},
+	}
+	for _, c := range converters {
+		r.Register(c)
+	}
+	return r
+}
+
+// Register adds c to the registry. Its media types take over from any
+// converter registered for them before.
+func (r *Registry) Register(c *Converter) {
+	r.converters = append(r.converters, c)
+	for _, mt := range c.MediaTypes {
+		mt = strings.ToLower(mt)
+		if strings.HasPrefix(mt, "+") {
+			r.suffixes[mt] = c
+		} else {
+			r.types[mt] = c
+		}
+	}
+}
+
+// Lookup returns the converter for a Content-Type header value, or nil when
+// none handles it. A converter registered for the exact media type is
+// preferred over one registered for its suffix.
+func (r *Registry) Lookup(contentType string) *Converter {
+	mt := mediaType(contentType)
+	if mt == "" {
+		return nil
+	}
+	if c, ok := r.types[mt]; ok {
+		return c
+	}
+	if i := strings.LastIndexByte(mt, '+'); i >= 0 {
+		return r.suffixes[mt[i:]]
+	}
+	return nil
+}
+
+// Formats returns the formats of the registered converters, in the order
+// they were registered.
+func (r *Registry) Formats() []string {
+	formats := make([]string, 0, len(r.converters))
+	for _, c := range r.converters {
+		formats = append(formats, c.Format)
+	}
+	return formats
+}
+
+// mediaType returns the lowercased media type of a Content-Type header
+// value, without parameters.
+func mediaType(contentType string) string {
+	if mt, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mt
+	}
+	mt, _, _ := strings.Cut(contentType, ";")
+	return strings.ToLower(strings.TrimSpace(mt))
+}
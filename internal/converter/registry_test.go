@@ -0,0 +1,74 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistry_Lookup(t *testing.T) {
+	tests := []struct {
+		ct   string
+		want string
+	}{
+		{"text/html", FormatHTML},
+		{"text/html; charset=utf-8", FormatHTML},
+		{"TEXT/HTML", FormatHTML},
+		{"application/xhtml+xml", FormatHTML},
+		{"application/json", FormatJSON},
+		{"application/json; charset=utf-8", FormatJSON},
+		{"application/ld+json", FormatJSON},
+		{"application/problem+json; charset=utf-8", FormatJSON},
+		{"application/xml", FormatFeed},
+		{"text/xml; charset=utf-8", FormatFeed},
+		{"application/rss+xml", FormatFeed},
+		{"application/pdf", FormatPDF},
+		{"application/vnd.openxmlformats-officedocument.wordprocessingml.document", FormatDOCX},
+		{"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", FormatXLSX},
+		{"application/vnd.openxmlformats-officedocument.presentationml.presentation", FormatPPTX},
+		{"application/atom+xml", FormatFeed},
+		{"image/svg+xml", ""},
+		{"text/plain", ""},
+		{"text/markdown", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ct, func(t *testing.T) {
+			got := ""
+			if c := Default.Lookup(tt.ct); c != nil {
+				got = c.Format
+			}
+			if got != tt.want {
+				t.Errorf("Lookup(%q) = %q, want %q", tt.ct, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistry_Register(t *testing.T) {
+	xml := &Converter{
+		Format:     "xml",
+		MediaTypes: []string{"application/xml", "+xml"},
+		Convert: func(in Input) (string, error) {
+			return "```xml\n" + string(in.Body) + "\n```", nil
+		},
+	}
+	r := NewRegistry(HTMLConverter, JSONConverter, xml)
+
+	// An exact media type wins over a suffix.
+	if c := r.Lookup("application/xhtml+xml"); c != HTMLConverter {
+		t.Errorf("expected xhtml to stay with the HTML converter, got %+v", c)
+	}
+	c := r.Lookup("application/atom+xml")
+	if c != xml {
+		t.Fatalf("expected +xml types to use the registered converter, got %+v", c)
+	}
+	md, err := c.Convert(Input{Body: []byte("<feed/>")})
+	if err != nil || !strings.Contains(md, "<feed/>") {
+		t.Errorf("Convert = %q, %v", md, err)
+	}
+
+	if got := strings.Join(r.Formats(), ","); got != "html,json,xml" {
+		t.Errorf("Formats() = %q, want html,json,xml", got)
+	}
+}
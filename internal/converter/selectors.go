@@ -0,0 +1,98 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Selectors narrow a document to the parts worth converting with CSS
+// selectors: elements matching Exclude are removed, then, if any element
+// matches Include, only the matching elements are converted.
+type Selectors struct {
+	// Include and Exclude are the selector groups as written, such as
+	// "main article" or ".sidebar, nav, .ad".
+	Include string
+	Exclude string
+
+	include cascadia.SelectorGroup
+	exclude cascadia.SelectorGroup
+}
+
+// CompileSelectors parses the include and exclude selector groups. Either
+// may be empty.
+func CompileSelectors(include, exclude string) (*Selectors, error) {
+	s := &Selectors{Include: strings.TrimSpace(include), Exclude: strings.TrimSpace(exclude)}
+	var err error
+	if s.Include != "" {
+		if s.include, err = cascadia.ParseGroup(s.Include); err != nil {
+			return nil, fmt.Errorf("parsing include selector %q: %w", s.Include, err)
+		}
+	}
+	if s.Exclude != "" {
+		if s.exclude, err = cascadia.ParseGroup(s.Exclude); err != nil {
+			return nil, fmt.Errorf("parsing exclude selector %q: %w", s.Exclude, err)
+		}
+	}
+	return s, nil
+}
+
+// String identifies the selectors, for cache keys.
+func (s *Selectors) String() string {
+	if s == nil {
+		return ""
+	}
+	return "include=" + s.Include + "; exclude=" + s.Exclude
+}
+
+// removeExcluded removes the elements matching the exclude selectors from
+// doc.
+func (s *Selectors) removeExcluded(doc *html.Node) {
+	if s == nil || s.exclude == nil {
+		return
+	}
+	for _, n := range cascadia.QueryAll(doc, s.exclude) {
+		if n.Parent != nil {
+			n.Parent.RemoveChild(n)
+		}
+	}
+}
+
+// included returns a container holding the elements of doc that match the
+// include selectors, in document order, or nil if there are none. Matches
+// nested inside another match are kept only once, as part of it.
+func (s *Selectors) included(doc *html.Node) *html.Node {
+	if s == nil || s.include == nil {
+		return nil
+	}
+	matches := cascadia.QueryAll(doc, s.include)
+	if len(matches) == 0 {
+		return nil
+	}
+
+	kept := map[*html.Node]bool{}
+	var roots []*html.Node
+	for _, n := range matches {
+		nested := false
+		for anc := n.Parent; anc != nil; anc = anc.Parent {
+			if kept[anc] {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			kept[n] = true
+			roots = append(roots, n)
+		}
+	}
+
+	container := &html.Node{Type: html.ElementNode, DataAtom: atom.Div, Data: "div"}
+	for _, n := range roots {
+		n.Parent.RemoveChild(n)
+		container.AppendChild(n)
+	}
+	return container
+}
@@ -0,0 +1,60 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+)
+
+const docsPage = `<html><body>
+<nav><a href="/">Docs home</a></nav>
+<div class="layout">
+  <div class="sidebar"><a href="/a">Getting started</a></div>
+  <main><article><h1>Install</h1><p>Run the installer.</p><div class="ad">Buy now</div></article></main>
+  <main><article><h2>Upgrade</h2><p>Run it again.</p></article></main>
+</div></body></html>`
+
+func TestConvertHTML_Selectors(t *testing.T) {
+	sel, err := CompileSelectors("main article", ".sidebar, nav, .ad")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	md, err := ConvertHTML(docsPage, Options{Selectors: sel})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{"# Install", "Run the installer.", "## Upgrade"} {
+		if !strings.Contains(md, want) {
+			t.Errorf("expected %q in:\n%s", want, md)
+		}
+	}
+	for _, unwanted := range []string{"Docs home", "Getting started", "Buy now"} {
+		if strings.Contains(md, unwanted) {
+			t.Errorf("expected %q to be dropped from:\n%s", unwanted, md)
+		}
+	}
+}
+
+func TestConvertHTML_SelectorsNoInclude(t *testing.T) {
+	sel, _ := CompileSelectors(".missing", "nav")
+	md, err := ConvertHTML(docsPage, Options{Selectors: sel})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(md, "Docs home") || !strings.Contains(md, "Getting started") {
+		t.Errorf("expected the whole page minus excluded elements, got:\n%s", md)
+	}
+}
+
+func TestConvertHTML_SelectorsNested(t *testing.T) {
+	sel, _ := CompileSelectors("main, article", "")
+	md, _ := ConvertHTML(docsPage, Options{Selectors: sel})
+	if n := strings.Count(md, "# Install"); n != 1 {
+		t.Errorf("expected nested matches once, got %d in:\n%s", n, md)
+	}
+}
+
+func TestCompileSelectors_Invalid(t *testing.T) {
+	if _, err := CompileSelectors("main >", ""); err == nil {
+		t.Error("expected an error for an invalid selector")
+	}
+}
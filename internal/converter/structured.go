@@ -0,0 +1,199 @@
+package converter
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// StructuredData is the machine-readable data embedded in an HTML page:
+// JSON-LD blocks, OpenGraph properties and microdata items. Conversion to
+// Markdown drops all of it, so it is extracted separately.
+type StructuredData struct {
+	// JSONLD holds the decoded application/ld+json scripts. Scripts
+	// holding an array contribute each element.
+	JSONLD []any `json:"jsonld,omitempty"`
+	// OpenGraph maps OpenGraph properties, such as og:title or
+	// product:price:amount, to their first value.
+	OpenGraph map[string]string `json:"opengraph,omitempty"`
+	// Microdata holds the top-level microdata items.
+	Microdata []MicrodataItem `json:"microdata,omitempty"`
+}
+
+// MicrodataItem is an element marked with itemscope and the properties
+// found inside it. Property values are strings, or items for properties
+// that are items themselves.
+type MicrodataItem struct {
+	Type       string           `json:"type,omitempty"`
+	ID         string           `json:"id,omitempty"`
+	Properties map[string][]any `json:"properties,omitempty"`
+}
+
+// ExtractStructuredData reads the JSON-LD, OpenGraph and microdata of an
+// HTML document. Relative URLs in microdata are resolved against pageURL,
+// honoring <base href>. JSON-LD scripts that fail to parse are skipped.
+func ExtractStructuredData(htmlStr, pageURL string) StructuredData {
+	var s StructuredData
+	doc, err := html.Parse(strings.NewReader(htmlStr))
+	if err != nil {
+		return s
+	}
+	var base *url.URL
+	if pageURL != "" {
+		base = documentBase(doc, pageURL)
+	}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch {
+			case n.DataAtom == atom.Script && strings.EqualFold(mediaType(attr(n, "type")), "application/ld+json"):
+				s.addJSONLD(scriptText(n))
+			case n.DataAtom == atom.Meta && attr(n, "property") != "":
+				prop := strings.ToLower(attr(n, "property"))
+				if content := strings.TrimSpace(attr(n, "content")); strings.Contains(prop, ":") && content != "" {
+					if s.OpenGraph == nil {
+						s.OpenGraph = map[string]string{}
+					}
+					if _, ok := s.OpenGraph[prop]; !ok {
+						s.OpenGraph[prop] = content
+					}
+				}
+			}
+			// Items often span the whole page, as with <html itemscope>,
+			// so the walk goes on inside them for JSON-LD, OpenGraph and
+			// further top-level items.
+			if hasAttr(n, "itemscope") && !hasAttr(n, "itemprop") {
+				s.Microdata = append(s.Microdata, microdataItem(n, base))
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return s
+}
+
+// addJSONLD decodes a JSON-LD script and adds its contents.
+func (s *StructuredData) addJSONLD(script string) {
+	var v any
+	if err := json.Unmarshal([]byte(strings.TrimSpace(script)), &v); err != nil {
+		return
+	}
+	if list, ok := v.([]any); ok {
+		s.JSONLD = append(s.JSONLD, list...)
+	} else {
+		s.JSONLD = append(s.JSONLD, v)
+	}
+}
+
+// Empty reports whether the page carried no structured data.
+func (s StructuredData) Empty() bool {
+	return len(s.JSONLD) == 0 && len(s.OpenGraph) == 0 && len(s.Microdata) == 0
+}
+
+// Appendix renders s as a Markdown section to append to a converted page:
+// a "Structured data" heading followed by the data as a JSON code block.
+// It returns "" when s is empty.
+func (s StructuredData) Appendix() string {
+	if s.Empty() {
+		return ""
+	}
+	out, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return ""
+	}
+	return "## Structured data\n\n```json\n" + string(out) + "\n```"
+}
+
+// microdataItem reads the item n defines. URL values are resolved against
+// base unless it is nil.
+func microdataItem(n *html.Node, base *url.URL) MicrodataItem {
+	item := MicrodataItem{
+		Type:       attr(n, "itemtype"),
+		ID:         attr(n, "itemid"),
+		Properties: map[string][]any{},
+	}
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			names := strings.Fields(attr(c, "itemprop"))
+			nested := hasAttr(c, "itemscope")
+			if len(names) > 0 {
+				var value any
+				if nested {
+					value = microdataItem(c, base)
+				} else {
+					value = microdataValue(c, base)
+				}
+				for _, name := range names {
+					item.Properties[name] = append(item.Properties[name], value)
+				}
+			}
+			// Properties inside a nested item belong to it.
+			if !nested {
+				walk(c)
+			}
+		}
+	}
+	walk(n)
+	return item
+}
+
+// microdataValue returns the value of a property element, which depends on
+// the element: a URL for links and media, an attribute for meta, data and
+// time elements, and the text content otherwise.
+func microdataValue(n *html.Node, base *url.URL) string {
+	link := func(key string) string {
+		if base == nil {
+			return attr(n, key)
+		}
+		return resolveURL(base, attr(n, key))
+	}
+	switch n.DataAtom {
+	case atom.Meta:
+		return strings.TrimSpace(attr(n, "content"))
+	case atom.A, atom.Area, atom.Link:
+		return link("href")
+	case atom.Img, atom.Audio, atom.Video, atom.Source, atom.Iframe, atom.Embed, atom.Track:
+		return link("src")
+	case atom.Object:
+		return link("data")
+	case atom.Data, atom.Meter:
+		return attr(n, "value")
+	case atom.Time:
+		if hasAttr(n, "datetime") {
+			return attr(n, "datetime")
+		}
+	}
+	return innerText(n)
+}
+
+// scriptText returns the raw content of a script element.
+func scriptText(n *html.Node) string {
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode {
+			b.WriteString(c.Data)
+		}
+	}
+	return b.String()
+}
+
+// hasAttr reports whether n has the attribute key, which may be empty as
+// for boolean attributes.
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package converter
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const productPage = `<!DOCTYPE html>
+<html><head>
+<title>Widget Pro</title>
+<meta property="og:title" content="Widget Pro">
+<meta property="og:image" content="https://cdn.example.com/w1.jpg">
+<meta property="og:image" content="https://cdn.example.com/w2.jpg">
+<meta property="product:price:amount" content="19.99">
+<meta name="description" content="Not OpenGraph">
+<script type="application/ld+json">
+{"@context": "https://schema.org", "@type": "Product", "name": "Widget Pro", "sku": "WP-1",
+ "offers": {"@type": "Offer", "price": "19.99", "priceCurrency": "USD"}}
+</script>
+<script type="application/ld+json">[{"@type": "BreadcrumbList"}, {"@type": "WebSite"}]</script>
+<script type="application/ld+json">{not json</script>
+</head><body>
+<div itemscope itemtype="https://schema.org/Product">
+  <h1 itemprop="name">Widget Pro</h1>
+  <img itemprop="image" src="/img/widget.jpg">
+  <div itemprop="offers" itemscope itemtype="https://schema.org/Offer">
+    <meta itemprop="priceCurrency" content="USD">
+    $<span itemprop="price">19.99</span>
+    <link itemprop="availability" href="https://schema.org/InStock">
+  </div>
+  <p>Released <time itemprop="releaseDate" datetime="2024-05-01">May 1</time></p>
+</div>
+</body></html>`
+
+func TestExtractStructuredData(t *testing.T) {
+	s := ExtractStructuredData(productPage, "https://shop.example.com/widgets/pro")
+
+	if len(s.JSONLD) != 3 {
+		t.Fatalf("expected 3 JSON-LD values, got %d: %v", len(s.JSONLD), s.JSONLD)
+	}
+	if product, _ := s.JSONLD[0].(map[string]any); product["sku"] != "WP-1" {
+		t.Errorf("expected the product SKU from JSON-LD, got %v", s.JSONLD[0])
+	}
+
+	wantOG := map[string]string{
+		"og:title":             "Widget Pro",
+		"og:image":             "https://cdn.example.com/w1.jpg",
+		"product:price:amount": "19.99",
+	}
+	if !reflect.DeepEqual(s.OpenGraph, wantOG) {
+		t.Errorf("OpenGraph = %v, want %v", s.OpenGraph, wantOG)
+	}
+
+	wantMicrodata := []MicrodataItem{{
+		Type: "https://schema.org/Product",
+		Properties: map[string][]any{
+			"name":  {"Widget Pro"},
+			"image": {"https://shop.example.com/img/widget.jpg"},
+			"offers": {MicrodataItem{
+				Type: "https://schema.org/Offer",
+				Properties: map[string][]any{
+					"priceCurrency": {"USD"},
+					"price":         {"19.99"},
+					"availability":  {"https://schema.org/InStock"},
+				},
+			}},
+			"releaseDate": {"2024-05-01"},
+		},
+	}}
+	if !reflect.DeepEqual(s.Microdata, wantMicrodata) {
+		t.Errorf("Microdata = %#v, want %#v", s.Microdata, wantMicrodata)
+	}
+}
+
+func TestExtractStructuredData_PageItem(t *testing.T) {
+	page := `<html itemscope itemtype="https://schema.org/WebPage"><head>
+<meta itemprop="name" content="Docs">
+<meta property="og:title" content="Docs">
+<script type="application/ld+json">{"@type": "Article"}</script>
+</head><body>
+<div itemscope itemtype="https://schema.org/Person"><span itemprop="name">Ada</span></div>
+</body></html>`
+	s := ExtractStructuredData(page, "")
+
+	if len(s.JSONLD) != 1 || s.OpenGraph["og:title"] != "Docs" {
+		t.Errorf("expected JSON-LD and OpenGraph inside <html itemscope>, got %v and %v", s.JSONLD, s.OpenGraph)
+	}
+	wantMicrodata := []MicrodataItem{
+		{Type: "https://schema.org/WebPage", Properties: map[string][]any{"name": {"Docs"}}},
+		{Type: "https://schema.org/Person", Properties: map[string][]any{"name": {"Ada"}}},
+	}
+	if !reflect.DeepEqual(s.Microdata, wantMicrodata) {
+		t.Errorf("Microdata = %#v, want %#v", s.Microdata, wantMicrodata)
+	}
+}
+
+func TestStructuredData_Appendix(t *testing.T) {
+	if got := ExtractStructuredData("<p>Plain page</p>", "").Appendix(); got != "" {
+		t.Errorf("expected no appendix for a page without structured data, got %q", got)
+	}
+
+	appendix := ExtractStructuredData(productPage, "").Appendix()
+	body, ok := strings.CutPrefix(appendix, "## Structured data\n\n```json\n")
+	if !ok || !strings.HasSuffix(body, "\n```") {
+		t.Fatalf("unexpected appendix layout: %q", appendix)
+	}
+	var decoded StructuredData
+	if err := json.Unmarshal([]byte(strings.TrimSuffix(body, "\n```")), &decoded); err != nil {
+		t.Fatalf("appendix does not hold valid JSON: %v", err)
+	}
+	if decoded.OpenGraph["product:price:amount"] != "19.99" {
+		t.Errorf("expected the price in the appendix, got %q", appendix)
+	}
+}
@@ -0,0 +1,68 @@
+package converter
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// urlAttrs maps the elements rendered as Markdown links and images to the
+// attribute holding their URL.
+var urlAttrs = map[atom.Atom]string{
+	atom.A:   "href",
+	atom.Img: "src",
+}
+
+// documentBase returns the URL relative references in doc resolve against:
+// the first <base href>, itself resolved against pageURL, or pageURL. It
+// returns nil if pageURL is not a valid URL.
+func documentBase(doc *html.Node, pageURL string) *url.URL {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil
+	}
+	if b := findElement(doc, atom.Base); b != nil {
+		if href := strings.TrimSpace(attr(b, "href")); href != "" {
+			if u, err := base.Parse(href); err == nil {
+				base = u
+			}
+		}
+	}
+	return base
+}
+
+// resolveURLs rewrites the link and image URLs in doc to absolute URLs,
+// honoring <base href>.
+func resolveURLs(doc *html.Node, pageURL string) {
+	base := documentBase(doc, pageURL)
+	if base == nil {
+		return
+	}
+	walkElements(doc, func(n *html.Node) {
+		key, ok := urlAttrs[n.DataAtom]
+		if !ok {
+			return
+		}
+		for i := range n.Attr {
+			if n.Attr[i].Key == key {
+				n.Attr[i].Val = resolveURL(base, n.Attr[i].Val)
+			}
+		}
+	})
+}
+
+// resolveURL resolves ref against base. Empty and unparsable references
+// are returned unchanged.
+func resolveURL(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return ref
+	}
+	u, err := base.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return u.String()
+}
@@ -0,0 +1,196 @@
+package converter
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// xlsxWorkbook is the part listing the sheets of a workbook.
+const xlsxWorkbook = "xl/workbook.xml"
+
+// xlsxMaxColumns is the number of columns in a sheet: Excel's last column
+// is XFD.
+const xlsxMaxColumns = 16384
+
+// xlsxMaxCells bounds the cells rendered for a sheet, counting the empty
+// ones a table pads its rows with. The rows past it are left out.
+const xlsxMaxCells = 1 << 20
+
+// xlsxText is a shared or inline string: plain text, or rich text split
+// into runs.
+type xlsxText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.Text
+	}
+	var b strings.Builder
+	for _, r := range t.Runs {
+		b.WriteString(r.Text)
+	}
+	return b.String()
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		Cells []struct {
+			Ref    string   `xml:"r,attr"`
+			Type   string   `xml:"t,attr"`
+			Value  string   `xml:"v"`
+			Inline xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// XLSXToMarkdown converts an Excel workbook to Markdown: a section per
+// sheet, headed with the sheet name, holding a table of its cells with
+// the first row as header. Cells show their stored values, so formulas
+// give their last computed result and dates their serial number.
+func XLSXToMarkdown(body []byte) (string, error) {
+	pkg, err := openOffice(body)
+	if err != nil {
+		return "", err
+	}
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			ID   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := pkg.decode(xlsxWorkbook, &workbook); err != nil {
+		return "", err
+	}
+	targets, err := pkg.rels(xlsxWorkbook)
+	if err != nil {
+		return "", err
+	}
+	var shared []string
+	if name := "xl/sharedStrings.xml"; pkg.has(name) {
+		var sst struct {
+			Items []xlsxText `xml:"si"`
+		}
+		if err := pkg.decode(name, &sst); err != nil {
+			return "", err
+		}
+		for _, si := range sst.Items {
+			shared = append(shared, si.String())
+		}
+	}
+
+	sections := make([]string, 0, len(workbook.Sheets))
+	for _, s := range workbook.Sheets {
+		target, ok := targets[s.ID]
+		if !ok {
+			return "", fmt.Errorf("reading Office document: sheet %q has no part", s.Name)
+		}
+		var sheet xlsxSheet
+		if err := pkg.decode(target, &sheet); err != nil {
+			return "", err
+		}
+		section := "## " + s.Name
+		if rows := sheet.grid(shared); len(rows) > 0 {
+			cols := 0
+			for _, r := range rows {
+				cols = max(cols, len(r))
+			}
+			shown := min(len(rows), xlsxMaxCells/cols)
+			section += "\n\n" + markdownTable(rows[:shown])
+			if omitted := len(rows) - shown; omitted > 0 {
+				section += fmt.Sprintf("\n\n_%d more rows not shown._", omitted)
+			}
+		}
+		sections = append(sections, section)
+	}
+	return strings.Join(sections, "\n\n"), nil
+}
+
+// grid returns the text of the sheet's cells by row and column, leaving
+// out empty rows and the columns empty in every row, so a stray cell far to
+// the right does not pad every row out to it. Cells referring to columns
+// past xlsxMaxColumns are dropped, as no valid workbook has them.
+func (s *xlsxSheet) grid(shared []string) [][]string {
+	type cell struct {
+		col  int
+		text string
+	}
+	var sparse [][]cell
+	used := map[int]bool{}
+	for _, r := range s.Rows {
+		var row []cell
+		next := 0
+		for _, c := range r.Cells {
+			col := next
+			if c.Ref != "" {
+				var ok bool
+				if col, ok = xlsxColumn(c.Ref); !ok {
+					continue
+				}
+			}
+			var text string
+			switch c.Type {
+			case "s":
+				if i, err := strconv.Atoi(c.Value); err == nil && i >= 0 && i < len(shared) {
+					text = shared[i]
+				}
+			case "inlineStr":
+				text = c.Inline.String()
+			case "b":
+				text = map[string]string{"0": "FALSE", "1": "TRUE"}[c.Value]
+			default:
+				text = c.Value
+			}
+			if strings.TrimSpace(text) == "" {
+				continue
+			}
+			row = append(row, cell{col, text})
+			used[col] = true
+			next = max(next, col+1)
+		}
+		if len(row) > 0 {
+			sparse = append(sparse, row)
+		}
+	}
+
+	// Number the used columns from the left.
+	cols := slices.Sorted(maps.Keys(used))
+	index := make(map[int]int, len(cols))
+	for i, col := range cols {
+		index[col] = i
+	}
+	rows := make([][]string, 0, len(sparse))
+	for _, cells := range sparse {
+		width := 0
+		for _, c := range cells {
+			width = max(width, index[c.col]+1)
+		}
+		row := make([]string, width)
+		for _, c := range cells {
+			row[index[c.col]] = c.text
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// xlsxColumn returns the zero-based column of a cell reference such as
+// "B7", and false when the column is past xlsxMaxColumns.
+func xlsxColumn(ref string) (int, bool) {
+	col := 0
+	for _, r := range strings.ToUpper(ref) {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		if col = col*26 + int(r-'A'+1); col > xlsxMaxColumns {
+			return 0, false
+		}
+	}
+	return max(col-1, 0), true
+}
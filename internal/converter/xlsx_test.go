@@ -0,0 +1,112 @@
+package converter
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestXLSXToMarkdown(t *testing.T) {
+	book := officeZip(t, map[string]string{
+		"xl/workbook.xml": `<workbook ` + sheetNS + `><sheets>
+<sheet name="Prices" sheetId="1" r:id="rId1"/>
+<sheet name="Empty" sheetId="2" r:id="rId2"/>
+</sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": relsPart("worksheets/sheet1.xml", "/xl/worksheets/sheet2.xml"),
+		"xl/sharedStrings.xml": `<sst ` + sheetNS + `>
+<si><t>SKU</t></si><si><t>Price</t></si><si><r><t>Widget </t></r><r><t>Pro</t></r></si>
+</sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet ` + sheetNS + `><sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1" t="inlineStr"><is><t>In stock</t></is></c></row>
+<row r="2"/>
+<row r="3"><c r="A3" t="s"><v>2</v></c><c r="B3"><v>19.99</v></c><c r="C3" t="b"><v>1</v></c></row>
+<row r="4"><c r="A4"><f>A3</f></c><c r="C4" t="b"><v>0</v></c></row>
+</sheetData></worksheet>`,
+		"xl/worksheets/sheet2.xml": `<worksheet ` + sheetNS + `><sheetData/></worksheet>`,
+	})
+
+	md, err := XLSXToMarkdown(book)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "## Prices\n\n" +
+		"| SKU | Price | In stock |\n| --- | --- | --- |\n| Widget Pro | 19.99 | TRUE |\n|  |  | FALSE |\n\n" +
+		"## Empty"
+	if md != want {
+		t.Errorf("got:\n%s\nwant:\n%s", md, want)
+	}
+}
+
+func TestXLSXColumn(t *testing.T) {
+	for ref, want := range map[string]int{"A1": 0, "B7": 1, "Z3": 25, "AA10": 26, "ab2": 27, "XFD1": 16383} {
+		if got, ok := xlsxColumn(ref); got != want || !ok {
+			t.Errorf("xlsxColumn(%q) = %d, %v; want %d, true", ref, got, ok, want)
+		}
+	}
+	for _, ref := range []string{"XFE1", "ZZZZZZZ1", strings.Repeat("Z", 40) + "1"} {
+		if _, ok := xlsxColumn(ref); ok {
+			t.Errorf("xlsxColumn(%q) accepted a column past XFD", ref)
+		}
+	}
+}
+
+func TestXLSXSheetGrid_ColumnLimit(t *testing.T) {
+	var sheet xlsxSheet
+	err := xml.Unmarshal([]byte(`<worksheet><sheetData><row r="1">
+<c r="A1" t="inlineStr"><is><t>kept</t></is></c>
+<c r="ZZZZZZZ1" t="inlineStr"><is><t>hostile</t></is></c>
+</row></sheetData></worksheet>`), &sheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := sheet.grid(nil)
+	if len(rows) != 1 || len(rows[0]) != 1 || rows[0][0] != "kept" {
+		t.Errorf("grid = %q, want only the cell within the column limit", rows)
+	}
+}
+
+func TestXLSXSheetGrid_EmptyColumns(t *testing.T) {
+	var sheet xlsxSheet
+	err := xml.Unmarshal([]byte(`<worksheet><sheetData>
+<row r="1"><c r="A1" t="inlineStr"><is><t>Name</t></is></c><c r="XFD1" t="inlineStr"><is><t>Far</t></is></c></row>
+<row r="2"><c r="A2" t="inlineStr"><is><t>a</t></is></c><c r="C2"><v>1</v></c></row>
+</sheetData></worksheet>`), &sheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := sheet.grid(nil)
+	want := [][]string{{"Name", "", "Far"}, {"a", "1"}}
+	if fmt.Sprint(rows) != fmt.Sprint(want) {
+		t.Errorf("grid = %q, want %q", rows, want)
+	}
+}
+
+func TestXLSXToMarkdown_CellLimit(t *testing.T) {
+	// Every cell in a column of its own: n cells render as n rows of n
+	// columns.
+	const n = 1100
+	var cells strings.Builder
+	for i := range n {
+		ref := string(rune('A'+i/26/26%26)) + string(rune('A'+i/26%26)) + string(rune('A'+i%26))
+		fmt.Fprintf(&cells, `<row r="%d"><c r="%s%d"><v>%d</v></c></row>`, i+1, ref, i+1, i)
+	}
+	book := officeZip(t, map[string]string{
+		"xl/workbook.xml":            `<workbook ` + sheetNS + `><sheets><sheet name="Diagonal" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": relsPart("worksheets/sheet1.xml"),
+		"xl/worksheets/sheet1.xml":   `<worksheet ` + sheetNS + `><sheetData>` + cells.String() + `</sheetData></worksheet>`,
+	})
+
+	md, err := XLSXToMarkdown(book)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	shown := xlsxMaxCells / n
+	// The header and data rows, and the delimiter row.
+	if got := strings.Count(md, "\n|"); got != shown+1 {
+		t.Errorf("rendered %d table lines, want %d", got, shown+1)
+	}
+	if want := fmt.Sprintf("_%d more rows not shown._", n-shown); !strings.HasSuffix(md, want) {
+		t.Errorf("expected the note %q, got %q", want, md[max(len(md)-100, 0):])
+	}
+}
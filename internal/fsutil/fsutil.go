@@ -0,0 +1,110 @@
+// Package fsutil provides file writes that are safe for concurrent
+// processes sharing a directory: atomic replacement and advisory locks.
+package fsutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// tempMarker is part of every temporary file name created by
+// WriteFileAtomic, so leftovers from a crash can be recognized.
+const tempMarker = ".tmp-"
+
+// WriteFileAtomic writes data to path so that readers see either the old
+// contents or the new contents, never a partial write. The data goes to a
+// temporary file in the same directory, which is synced and then renamed
+// over path.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	return writeFile(path, data, perm, true)
+}
+
+// ReplaceFile is WriteFileAtomic without the sync: readers still never see
+// a partial write, but a crash may lose the new contents. It suits data
+// that is cheap to lose, such as access statistics.
+func ReplaceFile(path string, data []byte, perm os.FileMode) error {
+	return writeFile(path, data, perm, false)
+}
+
+// writeFile implements WriteFileAtomic and ReplaceFile, syncing the
+// temporary file before the rename when sync is set.
+func writeFile(path string, data []byte, perm os.FileMode, sync bool) error {
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := os.CreateTemp(dir, "."+name+tempMarker+"*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	// Remove the temporary file on any failure before the rename.
+	ok := false
+	defer func() {
+		if !ok {
+			tmp.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	if sync {
+		if err := tmp.Sync(); err != nil {
+			return fmt.Errorf("syncing %s: %w", path, err)
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("closing %s: %w", path, err)
+	}
+	if err := os.Chmod(tmpPath, perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	ok = true
+	return nil
+}
+
+// IsTemp reports whether name is a temporary file left by WriteFileAtomic.
+func IsTemp(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.Contains(name, tempMarker)
+}
+
+// FileLock is an exclusive advisory lock held on a lock file. It
+// serializes cooperating processes (and goroutines) that lock the same
+// path; it does not stop other writers.
+type FileLock struct {
+	f *os.File
+}
+
+// Lock opens (creating if needed) the lock file at path and blocks until
+// it holds an exclusive lock on it.
+func Lock(path string) (*FileLock, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("opening lock file: %w", err)
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("locking %s: %w", path, err)
+	}
+	return &FileLock{f: f}, nil
+}
+
+// Unlock releases the lock and closes the lock file.
+func (l *FileLock) Unlock() error {
+	if l == nil {
+		return nil
+	}
+	err := unlockFile(l.f)
+	if cerr := l.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
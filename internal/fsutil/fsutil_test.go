@@ -0,0 +1,113 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file.txt")
+
+	for _, content := range []string{"first", "second"} {
+		if err := WriteFileAtomic(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("WriteFileAtomic error: %v", err)
+		}
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("ReadFile error: %v", err)
+		}
+		if string(got) != content {
+			t.Errorf("content = %q, want %q", got, content)
+		}
+	}
+
+	info, _ := os.Stat(path)
+	if perm := info.Mode().Perm(); perm != 0o644 {
+		t.Errorf("perm = %o, want 644", perm)
+	}
+	files, _ := os.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("expected no temporary files to remain, got %d files", len(files))
+	}
+}
+
+func TestReplaceFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file.txt")
+	os.WriteFile(path, []byte("old"), 0o644)
+
+	if err := ReplaceFile(path, []byte("new"), 0o644); err != nil {
+		t.Fatalf("ReplaceFile error: %v", err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "new" {
+		t.Errorf("content = %q, want %q", got, "new")
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 1 {
+		t.Errorf("expected no temporary files to remain, got %d files", len(files))
+	}
+}
+
+func TestWriteFileAtomic_MissingDir(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "file.txt")
+	if err := WriteFileAtomic(path, []byte("x"), 0o644); err == nil {
+		t.Error("expected error writing into a missing directory")
+	}
+}
+
+func TestIsTemp(t *testing.T) {
+	tests := map[string]bool{
+		".abc.meta.tmp-123": true,
+		"abc.meta":          false,
+		".locks":            false,
+		"abc.tmp-1":         false,
+	}
+	for name, want := range tests {
+		if got := IsTemp(name); got != want {
+			t.Errorf("IsTemp(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lock")
+
+	first, err := Lock(path)
+	if err != nil {
+		t.Fatalf("Lock error: %v", err)
+	}
+
+	var (
+		mu       sync.Mutex
+		released bool
+		acquired = make(chan bool)
+	)
+	go func() {
+		second, err := Lock(path)
+		if err != nil {
+			t.Errorf("second Lock error: %v", err)
+			acquired <- false
+			return
+		}
+		mu.Lock()
+		ok := released
+		mu.Unlock()
+		second.Unlock()
+		acquired <- ok
+	}()
+
+	// The second lock must wait for the first to be released.
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	released = true
+	mu.Unlock()
+	if err := first.Unlock(); err != nil {
+		t.Fatalf("Unlock error: %v", err)
+	}
+	if ok := <-acquired; !ok {
+		t.Error("second lock was acquired while the first was held")
+	}
+}
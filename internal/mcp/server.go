@@ -3,17 +3,20 @@ package mcp
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 
 	"github.com/rickcrawford/markdowninthemiddle/internal/converter"
 	"github.com/rickcrawford/markdowninthemiddle/internal/output"
+	"github.com/rickcrawford/markdowninthemiddle/internal/rules"
 	"github.com/rickcrawford/markdowninthemiddle/internal/templates"
 	"github.com/rickcrawford/markdowninthemiddle/internal/tokens"
 )
@@ -24,14 +27,35 @@ type Deps struct {
 	TokenCounter  *tokens.Counter
 	OutputWriter  *output.Writer
 	TemplateStore *templates.Store
+	RuleStore     *rules.Store
+	// Registry maps content types to converters (default: converter.Default)
+	Registry *converter.Registry
+	// Markdown is the default style of the Markdown written for HTML
+	Markdown converter.MarkdownOptions
+	// MaxFeedEntries caps the entries rendered from RSS and Atom feeds (0 = all)
+	MaxFeedEntries int
+	// OutputFrontMatter prepends YAML front matter to OutputWriter files
+	OutputFrontMatter bool
+	// StructuredData appends the JSON-LD, OpenGraph and microdata of HTML
+	// pages to the Markdown and returns it in the result
+	StructuredData bool
+	// Compact runs the Markdown through converter.Compact to save tokens
+	Compact bool
 }
 
 // Handler handles MCP tool calls
 type Handler struct {
-	httpClient    *http.Client
-	tokenCounter  *tokens.Counter
-	outputWriter  *output.Writer
-	templateStore *templates.Store
+	httpClient        *http.Client
+	tokenCounter      *tokens.Counter
+	outputWriter      *output.Writer
+	templateStore     *templates.Store
+	ruleStore         *rules.Store
+	registry          *converter.Registry
+	markdown          converter.MarkdownOptions
+	maxFeedEntries    int
+	outputFrontMatter bool
+	structuredData    bool
+	compact           bool
 }
 
 // New creates an MCP server with registered tools
@@ -43,10 +67,17 @@ func New(deps Deps) *server.MCPServer {
 
 	// Register tools
 	handler := &Handler{
-		httpClient:    deps.HTTPClient,
-		tokenCounter:  deps.TokenCounter,
-		outputWriter:  deps.OutputWriter,
-		templateStore: deps.TemplateStore,
+		httpClient:        deps.HTTPClient,
+		tokenCounter:      deps.TokenCounter,
+		outputWriter:      deps.OutputWriter,
+		templateStore:     deps.TemplateStore,
+		ruleStore:         deps.RuleStore,
+		registry:          deps.Registry,
+		markdown:          deps.Markdown,
+		maxFeedEntries:    deps.MaxFeedEntries,
+		outputFrontMatter: deps.OutputFrontMatter,
+		structuredData:    deps.StructuredData,
+		compact:           deps.Compact,
 	}
 
 	RegisterTools(s, handler)
@@ -68,6 +99,45 @@ func RegisterTools(s *server.MCPServer, handler *Handler) {
 						"type":        "string",
 						"description": "The URL to fetch",
 					},
+					"heading_style": map[string]any{
+						"type":        "string",
+						"enum":        []string{converter.HeadingATX, converter.HeadingSetext},
+						"description": "Heading style for HTML pages (default from config)",
+					},
+					"link_style": map[string]any{
+						"type":        "string",
+						"enum":        []string{converter.LinkInline, converter.LinkReference},
+						"description": "Link style for HTML pages (default from config)",
+					},
+					"bullet": map[string]any{
+						"type":        "string",
+						"enum":        []string{"-", "*", "+"},
+						"description": "Unordered list marker for HTML pages (default from config)",
+					},
+					"drop_images": map[string]any{
+						"type":        "boolean",
+						"description": "Leave images out of the Markdown (default from config)",
+					},
+					"raw_tables": map[string]any{
+						"type":        "boolean",
+						"description": "Keep tables as HTML instead of converting them (default from config)",
+					},
+					"structured_data": map[string]any{
+						"type":        "boolean",
+						"description": "Extract JSON-LD, OpenGraph and microdata from HTML pages (default from config)",
+					},
+					"compact": map[string]any{
+						"type":        "boolean",
+						"description": "Compact the Markdown to save tokens: drop data URIs, tracking parameters and repeated links, shorten long URLs (default from config)",
+					},
+					"max_tokens": map[string]any{
+						"type":        "integer",
+						"description": "Return at most this many tokens of the Markdown, ending on a paragraph or heading boundary",
+					},
+					"token_offset": map[string]any{
+						"type":        "integer",
+						"description": "Token offset of the window to return; pass next_token_offset from the previous call to page through a document",
+					},
 				},
 				Required: []string{"url"},
 			}),
@@ -102,6 +172,18 @@ func (h *Handler) handleFetchMarkdown(ctx context.Context, request mcp.CallToolR
 		return mcp.NewToolResultError("url is required"), nil
 	}
 
+	// Markdown style arguments override the configured style
+	style := converter.MarkdownOptions{
+		HeadingStyle: request.GetString("heading_style", h.markdown.HeadingStyle),
+		LinkStyle:    request.GetString("link_style", h.markdown.LinkStyle),
+		Bullet:       request.GetString("bullet", h.markdown.Bullet),
+		DropImages:   request.GetBool("drop_images", h.markdown.DropImages),
+		RawTables:    request.GetBool("raw_tables", h.markdown.RawTables),
+	}
+	if err := style.Validate(); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
 	// Fetch the content using configured transport (http or chromedp)
 	resp, err := h.httpClient.Get(url)
 	if err != nil {
@@ -115,33 +197,58 @@ func (h *Handler) handleFetchMarkdown(ctx context.Context, request mcp.CallToolR
 		return mcp.NewToolResultError(fmt.Sprintf("Error reading response: %v", err)), nil
 	}
 
-	// Determine content type
+	// Determine content type and the converter for it
 	contentType := resp.Header.Get("Content-Type")
+	conv := h.converters().Lookup(contentType)
 
 	// Convert to markdown
-	var markdown string
-	switch {
-	case isJSON(contentType):
-		// Convert JSON to Markdown
+	markdown := string(body)
+	var page converter.Metadata
+	var structured *converter.StructuredData
+	if conv != nil {
+		// Decode text bodies to UTF-8 before converting them
+		if !conv.Binary {
+			if body, err = converter.ToUTF8(body, contentType); err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("Error decoding response: %v", err)), nil
+			}
+		}
+
+		// Links resolve against the final URL, after any redirects.
+		pageURL := resp.Request.URL.String()
 		template := ""
 		if h.templateStore != nil {
 			template = h.templateStore.Match(url)
 		}
-		md, err := converter.JSONToMarkdown(body, template)
-		if err != nil {
-			return mcp.NewToolResultError(fmt.Sprintf("Error converting JSON: %v", err)), nil
+		md, err := conv.Convert(converter.Input{
+			Body: body,
+			HTML: converter.Options{
+				BaseURL:   pageURL,
+				Selectors: h.ruleStore.Match(pageURL),
+				Markdown:  style,
+			},
+			Template:    template,
+			FeedEntries: h.maxFeedEntries,
+		})
+		// Documents the converter does not handle after all, such as XML
+		// that is not a feed, are returned as-is.
+		if err != nil && !errors.Is(err, converter.ErrNotApplicable) {
+			return mcp.NewToolResultError(fmt.Sprintf("Error converting %s: %v", strings.ToUpper(conv.Format), err)), nil
 		}
-		markdown = md
-	case isHTML(contentType):
-		// Convert HTML to Markdown
-		md, err := converter.HTMLToMarkdown(string(body))
-		if err != nil {
-			return mcp.NewToolResultError(fmt.Sprintf("Error converting HTML: %v", err)), nil
+		if err == nil {
+			markdown = md
+			if conv.Format == converter.FormatHTML && h.outputWriter != nil && h.outputFrontMatter {
+				page = converter.ExtractMetadata(string(body), pageURL)
+			}
+			if conv.Format == converter.FormatHTML && request.GetBool("structured_data", h.structuredData) {
+				if data := converter.ExtractStructuredData(string(body), pageURL); !data.Empty() {
+					markdown = strings.TrimSpace(markdown + "\n\n" + data.Appendix())
+					structured = &data
+				}
+			}
+			if request.GetBool("compact", h.compact) {
+				markdown = converter.Compact(markdown)
+			}
 		}
-		markdown = md
-	default:
-		// Return as-is
-		markdown = string(body)
 	}
 
 	// Count tokens if available
@@ -152,7 +259,17 @@ func (h *Handler) handleFetchMarkdown(ctx context.Context, request mcp.CallToolR
 
 	// Write output if enabled
 	if h.outputWriter != nil {
-		if err := h.outputWriter.Write(url, []byte(markdown)); err != nil {
+		out := markdown
+		if h.outputFrontMatter {
+			page.Source = url
+			page.FetchedAt = time.Now()
+			page.Status = resp.StatusCode
+			if h.tokenCounter != nil {
+				page.Tokens = &tokenCount
+			}
+			out = page.FrontMatter() + markdown
+		}
+		if err := h.outputWriter.Write(url, []byte(out)); err != nil {
 			log.Printf("error writing output: %v", err)
 		}
 	}
@@ -163,6 +280,21 @@ func (h *Handler) handleFetchMarkdown(ctx context.Context, request mcp.CallToolR
 		"tokens":      tokenCount,
 		"status_code": resp.StatusCode,
 	}
+	if structured != nil {
+		result["structured_data"] = structured
+	}
+
+	// Return one token window of the Markdown if asked to
+	offset, maxTokens := request.GetInt("token_offset", 0), request.GetInt("max_tokens", 0)
+	if h.tokenCounter != nil && (offset > 0 || maxTokens > 0) {
+		w := h.tokenCounter.Window(markdown, offset, maxTokens)
+		result["markdown"] = w.Text
+		result["tokens"] = h.tokenCounter.Count(w.Text)
+		result["token_total"] = w.Total
+		if w.Next >= 0 {
+			result["next_token_offset"] = w.Next
+		}
+	}
 
 	resultJSON, _ := json.MarshalIndent(result, "", "  ")
 
@@ -201,14 +333,10 @@ func (h *Handler) handleFetchRaw(ctx context.Context, request mcp.CallToolReques
 	return mcp.NewToolResultText(string(resultJSON)), nil
 }
 
-// isHTML checks if content type is HTML
-func isHTML(contentType string) bool {
-	ct := strings.ToLower(contentType)
-	return strings.Contains(ct, "text/html") || strings.Contains(ct, "xhtml")
-}
-
-// isJSON checks if content type is JSON
-func isJSON(contentType string) bool {
-	ct := strings.ToLower(contentType)
-	return strings.Contains(ct, "application/json") || strings.Contains(ct, "ld+json")
+// converters returns the registry used to pick a converter
+func (h *Handler) converters() *converter.Registry {
+	if h.registry != nil {
+		return h.registry
+	}
+	return converter.Default
 }
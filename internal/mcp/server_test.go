@@ -1,9 +1,17 @@
 package mcp
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/rickcrawford/markdowninthemiddle/internal/converter"
+	"github.com/rickcrawford/markdowninthemiddle/internal/tokens"
 )
 
 func TestNew_CreatesServer(t *testing.T) {
@@ -17,48 +25,6 @@ func TestNew_CreatesServer(t *testing.T) {
 	}
 }
 
-func TestHandler_IsHTML(t *testing.T) {
-	tests := []struct {
-		contentType string
-		expected    bool
-	}{
-		{"text/html", true},
-		{"text/html; charset=utf-8", true},
-		{"application/xhtml+xml", true},
-		{"application/json", false},
-		{"text/plain", false},
-		{"", false},
-	}
-
-	for _, tt := range tests {
-		result := isHTML(tt.contentType)
-		if result != tt.expected {
-			t.Errorf("isHTML(%q) = %v, want %v", tt.contentType, result, tt.expected)
-		}
-	}
-}
-
-func TestHandler_IsJSON(t *testing.T) {
-	tests := []struct {
-		contentType string
-		expected    bool
-	}{
-		{"application/json", true},
-		{"application/json; charset=utf-8", true},
-		{"application/ld+json", true},
-		{"text/html", false},
-		{"text/plain", false},
-		{"", false},
-	}
-
-	for _, tt := range tests {
-		result := isJSON(tt.contentType)
-		if result != tt.expected {
-			t.Errorf("isJSON(%q) = %v, want %v", tt.contentType, result, tt.expected)
-		}
-	}
-}
-
 func TestHandler_MockHTTPServer(t *testing.T) {
 	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/html")
@@ -78,3 +44,157 @@ func TestHandler_MockHTTPServer(t *testing.T) {
 		t.Errorf("Expected status 200, got %d", resp.StatusCode)
 	}
 }
+
+// fetchMarkdown calls the fetch_markdown tool with args and decodes its
+// result.
+func fetchMarkdown(t *testing.T, h *Handler, args map[string]any) map[string]any {
+	t.Helper()
+	req := mcp.CallToolRequest{}
+	req.Params.Name = "fetch_markdown"
+	req.Params.Arguments = args
+
+	result, err := h.handleFetchMarkdown(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.IsError || len(result.Content) == 0 {
+		t.Fatalf("tool returned an error: %+v", result.Content)
+	}
+	var out map[string]any
+	if err := json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &out); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	return out
+}
+
+func TestHandler_FetchMarkdownAbsoluteLinks(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/docs/page", http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body><a href="../guide/setup">Setup</a><img src="img/a.png" alt="A"></body></html>`))
+	}))
+	defer mockServer.Close()
+
+	h := &Handler{httpClient: mockServer.Client()}
+	md, _ := fetchMarkdown(t, h, map[string]any{"url": mockServer.URL + "/old"})["markdown"].(string)
+
+	// Links resolve against the page the redirect led to.
+	for _, want := range []string{
+		"[Setup](" + mockServer.URL + "/guide/setup)",
+		"![A](" + mockServer.URL + "/docs/img/a.png)",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("expected markdown to contain %q, got %q", want, md)
+		}
+	}
+}
+
+func TestHandler_FetchMarkdownStyle(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body><h2>Usage</h2><ul><li>one</li></ul><p><a href="/setup">Setup</a></p></body></html>`))
+	}))
+	defer mockServer.Close()
+
+	h := &Handler{
+		httpClient: mockServer.Client(),
+		markdown:   converter.MarkdownOptions{HeadingStyle: converter.HeadingSetext, Bullet: "*"},
+	}
+	md, _ := fetchMarkdown(t, h, map[string]any{
+		"url":        mockServer.URL,
+		"link_style": "reference",
+		"bullet":     "+",
+	})["markdown"].(string)
+
+	for _, want := range []string{"Usage\n-----", "+ one", "[Setup][1]", "[1]: " + mockServer.URL + "/setup"} {
+		if !strings.Contains(md, want) {
+			t.Errorf("expected markdown to contain %q, got %q", want, md)
+		}
+	}
+
+	req := mcp.CallToolRequest{}
+	req.Params.Arguments = map[string]any{"url": mockServer.URL, "heading_style": "underline"}
+	result, _ := h.handleFetchMarkdown(context.Background(), req)
+	if !result.IsError {
+		t.Error("expected an error for an invalid heading style")
+	}
+}
+
+func TestHandler_FetchMarkdownStructuredData(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><meta property="og:title" content="Widget"></head><body><p>Hello</p></body></html>`))
+	}))
+	defer mockServer.Close()
+
+	h := &Handler{httpClient: mockServer.Client()}
+	out := fetchMarkdown(t, h, map[string]any{"url": mockServer.URL})
+	if _, ok := out["structured_data"]; ok {
+		t.Error("expected no structured_data by default")
+	}
+
+	out = fetchMarkdown(t, h, map[string]any{"url": mockServer.URL, "structured_data": true})
+	data, _ := out["structured_data"].(map[string]any)
+	og, _ := data["opengraph"].(map[string]any)
+	if og["og:title"] != "Widget" {
+		t.Errorf("expected og:title in structured_data, got %v", out["structured_data"])
+	}
+	if md, _ := out["markdown"].(string); !strings.Contains(md, "## Structured data") {
+		t.Errorf("expected the structured data appendix, got %q", md)
+	}
+}
+
+func TestHandler_FetchMarkdownTokenWindow(t *testing.T) {
+	tc, _ := tokens.NewCounter("cl100k_base")
+	if tc == nil {
+		t.Skip("tiktoken encoding unavailable")
+	}
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body><h1>Guide</h1><p>First paragraph.</p><p>Second paragraph.</p></body></html>`))
+	}))
+	defer mockServer.Close()
+
+	h := &Handler{httpClient: mockServer.Client(), tokenCounter: tc}
+	out := fetchMarkdown(t, h, map[string]any{"url": mockServer.URL, "max_tokens": tc.Count("# Guide\n\n")})
+	if out["markdown"] != "# Guide" {
+		t.Errorf("markdown = %q, want the first window", out["markdown"])
+	}
+	if got, want := out["token_total"], float64(tc.Count("# Guide\n\nFirst paragraph.\n\nSecond paragraph.")); got != want {
+		t.Errorf("token_total = %v, want %v", got, want)
+	}
+
+	next, ok := out["next_token_offset"].(float64)
+	if !ok {
+		t.Fatalf("missing next_token_offset in %v", out)
+	}
+	out = fetchMarkdown(t, h, map[string]any{"url": mockServer.URL, "token_offset": next})
+	if out["markdown"] != "First paragraph.\n\nSecond paragraph." {
+		t.Errorf("markdown = %q, want the rest of the page", out["markdown"])
+	}
+	if _, ok := out["next_token_offset"]; ok {
+		t.Errorf("unexpected next_token_offset on the last window")
+	}
+}
+
+func TestHandler_FetchMarkdownCompact(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body><p><a href="/guide?utm_source=mcp">Guide</a> <img src="data:image/gif;base64,R0lGOD==" alt="dot"></p></body></html>`))
+	}))
+	defer mockServer.Close()
+
+	h := &Handler{httpClient: mockServer.Client(), compact: true}
+	md, _ := fetchMarkdown(t, h, map[string]any{"url": mockServer.URL})["markdown"].(string)
+	if want := "[Guide](" + mockServer.URL + "/guide) dot"; md != want {
+		t.Errorf("markdown = %q, want %q", md, want)
+	}
+
+	md, _ = fetchMarkdown(t, h, map[string]any{"url": mockServer.URL, "compact": false})["markdown"].(string)
+	if !strings.Contains(md, "utm_source") || !strings.Contains(md, "data:image/gif") {
+		t.Errorf("expected uncompacted markdown, got %q", md)
+	}
+}
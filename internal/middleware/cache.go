@@ -0,0 +1,292 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/rickcrawford/markdowninthemiddle/internal/cache"
+	"github.com/rickcrawford/markdowninthemiddle/internal/converter"
+)
+
+// Values for the X-Cache response header.
+const (
+	cacheHit         = "HIT"
+	cacheMiss        = "MISS"
+	cacheRevalidated = "REVALIDATED"
+	cacheStale       = "STALE"
+)
+
+// Warning header values for stale responses (RFC 7234 §5.5).
+const (
+	warningStale            = `110 - "Response is Stale"`
+	warningRevalidateFailed = `111 - "Revalidation Failed"`
+	warningDisconnected     = `112 - "Disconnected Operation"`
+)
+
+// markdownKey returns the Markdown cache key for converting the response
+// cached under key with the given converter format. Besides the
+// source key it covers every setting that changes the output: the
+// converter, the Mustache template or extraction mode, selector rule,
+// Markdown style, structured data appendix and compaction, and the
+// converter version.
+func (rp *ResponseProcessor) markdownKey(req *http.Request, key, kind string) string {
+	switch kind {
+	case converter.FormatHTML:
+		return rp.htmlMarkdownKey(req, key, rp.extractMode(req))
+	case converter.FormatJSON:
+		return rp.conversionKey(req, key, kind, rp.template(req))
+	case converter.FormatFeed:
+		setting := "entries=" + strconv.Itoa(rp.MaxFeedEntries)
+		if style := rp.markdownOptions(req).String(); style != "" {
+			setting += "\n" + style
+		}
+		return rp.conversionKey(req, key, kind, setting)
+	}
+	return rp.conversionKey(req, key, kind, "")
+}
+
+// htmlMarkdownKey returns the Markdown cache key for converting the HTML
+// response to req cached under key with the given extraction mode.
+func (rp *ResponseProcessor) htmlMarkdownKey(req *http.Request, key, extract string) string {
+	setting := extract
+	if sel := rp.RuleStore.Match(req.URL.String()); sel != nil {
+		setting += "\n" + sel.String()
+	}
+	if style := rp.markdownOptions(req).String(); style != "" {
+		setting += "\n" + style
+	}
+	if rp.StructuredData {
+		setting += "\nstructured-data"
+	}
+	return rp.conversionKey(req, key, converter.FormatHTML, setting)
+}
+
+// conversionKey builds a Markdown cache key from the source key, the
+// converter and its setting, plus the settings shared by every converter.
+// Conversions with front matter or compaction are kept apart from those
+// without.
+func (rp *ResponseProcessor) conversionKey(req *http.Request, key, kind, setting string) string {
+	settings := []string{kind, setting, converter.Version}
+	if rp.FrontMatter {
+		settings = append(settings, "front-matter")
+	}
+	if rp.compact(req) {
+		settings = append(settings, "compact")
+	}
+	return cache.MarkdownKey(key, settings...)
+}
+
+// cachedMarkdown answers req from the Markdown cache layer when a fresh
+// conversion exists for one of the converters that apply to it.
+func (rp *ResponseProcessor) cachedMarkdown(req *http.Request, key string) (*http.Response, bool) {
+	if rp.Cache == nil || req.Method != http.MethodGet || rp.Cache.Bypass(req) {
+		return nil, false
+	}
+	for _, kind := range rp.registry().Formats() {
+		if !rp.converts(req, kind) {
+			continue
+		}
+		cached, ok := rp.Cache.GetMarkdown(rp.markdownKey(req, key, kind))
+		if !ok || rp.Cache.Freshness(req, &cached.Metadata) != cache.Fresh {
+			continue
+		}
+		resp := &http.Response{
+			Status:     "200 OK",
+			StatusCode: http.StatusOK,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     http.Header{},
+			Request:    req,
+		}
+		resp.Header.Set("X-Cache", cacheHit)
+		resp.Header.Set("Age", strconv.Itoa(int(cached.Age().Seconds())))
+		if kind == converter.FormatHTML && rp.extractMode(req) == converter.ExtractArticle {
+			// The full-page conversion is cached alongside the article;
+			// reading its count is not a hit on it.
+			if full, ok := rp.Cache.PeekMarkdown(rp.htmlMarkdownKey(req, key, converter.ExtractFull)); ok && full.Tokens >= 0 {
+				resp.Header.Set("X-Token-Count-Full", strconv.Itoa(full.Tokens))
+			}
+		}
+		setStructuredData(resp, cached.StructuredData)
+		return rp.writeMarkdown(req, resp, cached.Text, cached.Tokens), true
+	}
+	return nil, false
+}
+
+// fetch returns the response for req. When a cache is configured, entries
+// are used according to their freshness and the client's Cache-Control:
+// fresh entries are served from disk, stale ones are revalidated with a
+// conditional request (a 304 refreshes the entry), and stale-while-revalidate
+// and stale-if-error allow serving a stale copy. The returned status is the
+// X-Cache value, or empty when caching does not apply. key is the cache key
+// for req from DiskCache.RequestKey.
+func (rp *ResponseProcessor) fetch(req *http.Request, key string) (*http.Response, string, error) {
+	if rp.Offline {
+		resp, status := rp.replay(req, key)
+		return resp, status, nil
+	}
+	if rp.Cache == nil || req.Method != http.MethodGet || rp.Cache.Bypass(req) {
+		resp, err := rp.Inner.RoundTrip(req)
+		return resp, "", err
+	}
+
+	entry, ok := rp.Cache.Lookup(key)
+	if !ok {
+		if rp.Cache.OnlyIfCached(req) {
+			return gatewayTimeout(req, "no cached response available (only-if-cached)"), cacheMiss, nil
+		}
+		resp, err := rp.Inner.RoundTrip(req)
+		return resp, cacheMiss, err
+	}
+
+	switch rp.Cache.Freshness(req, &entry.Metadata) {
+	case cache.Fresh:
+		resp := entry.Response(req)
+		if !entry.Fresh() {
+			// Served under the client's max-stale.
+			resp.Header.Add("Warning", warningStale)
+		}
+		return resp, cacheHit, nil
+	case cache.StaleWhileRevalidate:
+		go rp.revalidateInBackground(req, key, entry)
+		resp := entry.Response(req)
+		resp.Header.Add("Warning", warningStale)
+		return resp, cacheStale, nil
+	}
+
+	if rp.Cache.OnlyIfCached(req) {
+		return gatewayTimeout(req, "no fresh cached response available (only-if-cached)"), cacheMiss, nil
+	}
+
+	resp, refreshed, err := rp.revalidate(req, key, entry)
+	if (err != nil || refreshed == nil && resp.StatusCode >= 500) && rp.Cache.StaleIfError(req, &entry.Metadata) {
+		if err != nil {
+			log.Printf("revalidation failed, serving stale %s: %v", key, err)
+		} else {
+			resp.Body.Close()
+		}
+		stale := entry.Response(req)
+		stale.Header.Add("Warning", warningRevalidateFailed)
+		return stale, cacheStale, nil
+	}
+	if err != nil {
+		return resp, cacheMiss, err
+	}
+	if refreshed != nil {
+		return refreshed.Response(req), cacheRevalidated, nil
+	}
+	return resp, cacheMiss, nil
+}
+
+// replay answers req from the cache alone, for offline mode. Entries are
+// served whatever their age, so recorded pages replay deterministically;
+// anything not in the cache is answered with 504. The second result is the
+// X-Cache value.
+func (rp *ResponseProcessor) replay(req *http.Request, key string) (*http.Response, string) {
+	if req.Method != http.MethodGet {
+		return gatewayTimeout(req, "offline: only cached GET requests can be answered"), cacheMiss
+	}
+	entry, ok := rp.Cache.Lookup(key)
+	if !ok {
+		return gatewayTimeout(req, "offline: no cached response for "+req.URL.String()), cacheMiss
+	}
+	resp := entry.Response(req)
+	if !entry.Fresh() {
+		resp.Header.Add("Warning", warningDisconnected)
+		return resp, cacheStale
+	}
+	return resp, cacheHit
+}
+
+// revalidate requests a stale entry from upstream, conditionally when it
+// carries validators. On a 304 the entry is refreshed and returned;
+// otherwise the upstream response is returned for normal processing.
+func (rp *ResponseProcessor) revalidate(req *http.Request, key string, entry *cache.Entry) (*http.Response, *cache.Entry, error) {
+	condReq := req.Clone(req.Context())
+	if entry.ETag != "" {
+		condReq.Header.Set("If-None-Match", entry.ETag)
+	}
+	if entry.LastModified != "" {
+		condReq.Header.Set("If-Modified-Since", entry.LastModified)
+	}
+
+	resp, err := rp.Inner.RoundTrip(condReq)
+	if err != nil || resp.StatusCode != http.StatusNotModified {
+		return resp, nil, err
+	}
+	resp.Body.Close()
+
+	refreshed, err := rp.Cache.Refresh(key, resp.Header, rp.Cache.TTL(resp))
+	if err != nil {
+		log.Printf("cache refresh error: %v", err)
+		return nil, entry, nil
+	}
+	return nil, refreshed, nil
+}
+
+// revalidateInBackground refreshes an entry served under
+// stale-while-revalidate. The request is detached from the client's
+// context, which ends as soon as the stale response has been written.
+func (rp *ResponseProcessor) revalidateInBackground(req *http.Request, key string, entry *cache.Entry) {
+	if _, busy := rp.revalidating.LoadOrStore(key, struct{}{}); busy {
+		return
+	}
+	defer rp.revalidating.Delete(key)
+
+	bgReq := req.Clone(context.WithoutCancel(req.Context()))
+	resp, refreshed, err := rp.revalidate(bgReq, key, entry)
+	if err != nil {
+		log.Printf("background revalidation of %s failed: %v", key, err)
+		return
+	}
+	if refreshed != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if conv := rp.registry().Lookup(resp.Header.Get("Content-Type")); conv == nil || conv.Format != converter.FormatHTML || !rp.Cache.Cacheable(bgReq, resp) {
+		return
+	}
+	body, err := rp.readBody(resp)
+	if err != nil {
+		log.Printf("background revalidation of %s failed: %v", key, err)
+		return
+	}
+	rp.storeHTML(bgReq, rp.Cache.VariantKey(bgReq, resp), resp, body)
+}
+
+// storeHTML caches an upstream HTML response under key if its headers
+// allow it.
+func (rp *ResponseProcessor) storeHTML(req *http.Request, key string, resp *http.Response, body []byte) {
+	if !rp.Cache.Cacheable(req, resp) {
+		return
+	}
+	if err := rp.Cache.Store(key, resp, body, rp.Cache.TTL(resp)); err != nil {
+		log.Printf("cache put error: %v", err)
+	}
+}
+
+// gatewayTimeout is the response to a request that must be answered from
+// the cache but cannot be, as for only-if-cached (RFC 9111 §5.2.1.7).
+func gatewayTimeout(req *http.Request, msg string) *http.Response {
+	body := msg + "\n"
+	header := http.Header{}
+	header.Set("Content-Type", "text/plain; charset=utf-8")
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	return &http.Response{
+		Status:        "504 Gateway Timeout",
+		StatusCode:    http.StatusGatewayTimeout,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,130 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/rickcrawford/markdowninthemiddle/internal/converter"
+)
+
+// sharedResponse is the outcome of a coalesced round trip. Responses whose
+// body this transport already holds in memory (a bufferedBody) are copied
+// for every caller; any other response is streamed to the leader alone and
+// followers fetch it themselves.
+type sharedResponse struct {
+	resp *http.Response
+	body string
+	// streamed reports that resp.Body was left unread for the leader.
+	streamed bool
+}
+
+// bufferedBody is a response body read into memory by this transport,
+// within MaxBodySize, after decompressing or converting it.
+type bufferedBody struct {
+	*strings.Reader
+	data string
+}
+
+func newBufferedBody(data string) *bufferedBody {
+	return &bufferedBody{Reader: strings.NewReader(data), data: data}
+}
+
+// Close implements io.Closer.
+func (*bufferedBody) Close() error { return nil }
+
+// coalescable reports whether req may share an upstream fetch with
+// concurrent identical requests. Requests carrying credentials are never
+// shared, since their responses may be specific to the caller.
+func coalescable(req *http.Request) bool {
+	return req.Method == http.MethodGet &&
+		req.Header.Get("Authorization") == "" &&
+		req.Header.Get("Cookie") == ""
+}
+
+// coalesceKey identifies requests that produce the same response: the cache
+// key (URL plus any Vary headers), the client's cache directives, the
+// conversions that apply, the extraction mode, the Markdown style,
+// compaction and the token window.
+func (rp *ResponseProcessor) coalesceKey(req *http.Request) string {
+	html, json := rp.converts(req, converter.FormatHTML), rp.converts(req, converter.FormatJSON)
+	offset, maxTokens, _ := rp.tokenWindow(req)
+	return rp.Cache.RequestKey(req) + "\n" + cacheDirectives(req) + "\n" + strconv.FormatBool(html) + "," + strconv.FormatBool(json) + "," + rp.extractMode(req) + "," + rp.markdownOptions(req).String() + "," + strconv.FormatBool(rp.compact(req)) + "," + strconv.Itoa(offset) + "," + strconv.Itoa(maxTokens)
+}
+
+// cacheDirectives returns the normalized Cache-Control and Pragma headers of
+// req. Requests with different directives, such as no-cache or
+// only-if-cached, may be answered differently and are never merged.
+func cacheDirectives(req *http.Request) string {
+	var parts []string
+	for _, name := range []string{"Cache-Control", "Pragma"} {
+		var directives []string
+		for _, v := range req.Header.Values(name) {
+			for _, d := range strings.Split(v, ",") {
+				if d = strings.ToLower(strings.Join(strings.Fields(d), "")); d != "" {
+					directives = append(directives, d)
+				}
+			}
+		}
+		parts = append(parts, strings.Join(directives, ","))
+	}
+	return strings.Join(parts, ";")
+}
+
+// coalesce runs roundTrip once for all concurrent callers with the same
+// coalesceKey. Followers get a copy of the leader's response marked with
+// X-Coalesced: true.
+func (rp *ResponseProcessor) coalesce(req *http.Request) (*http.Response, error) {
+	leader := false
+	v, err, _ := rp.inflight.Do(rp.coalesceKey(req), func() (any, error) {
+		leader = true
+		resp, err := rp.roundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		body, ok := resp.Body.(*bufferedBody)
+		if !ok {
+			return &sharedResponse{resp: resp, streamed: true}, nil
+		}
+		return &sharedResponse{resp: resp, body: body.data}, nil
+	})
+
+	if leader {
+		if err != nil {
+			return nil, err
+		}
+		shared := v.(*sharedResponse)
+		if shared.streamed {
+			return shared.resp, nil
+		}
+		return shared.copy(req), nil
+	}
+
+	// The leader's failure is only shared when it was not caused by the
+	// leader's own client going away.
+	if err != nil {
+		if errors.Is(err, context.Canceled) && req.Context().Err() == nil {
+			return rp.roundTrip(req)
+		}
+		return nil, err
+	}
+	shared := v.(*sharedResponse)
+	if shared.streamed {
+		return rp.roundTrip(req)
+	}
+	resp := shared.copy(req)
+	resp.Header.Set("X-Coalesced", "true")
+	return resp, nil
+}
+
+// copy returns a response for req with its own header map and body reader.
+func (s *sharedResponse) copy(req *http.Request) *http.Response {
+	resp := *s.resp
+	resp.Header = s.resp.Header.Clone()
+	resp.Body = newBufferedBody(s.body)
+	resp.ContentLength = int64(len(s.body))
+	resp.Request = req
+	return &resp
+}
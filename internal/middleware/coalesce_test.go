@@ -0,0 +1,203 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingTransport holds every request until release is closed, so tests
+// can line up concurrent callers.
+type blockingTransport struct {
+	contentType string
+	body        string
+	release     chan struct{}
+	calls       atomic.Int32
+}
+
+func (b *blockingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b.calls.Add(1)
+	<-b.release
+	header := http.Header{}
+	header.Set("Content-Type", b.contentType)
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(b.body)),
+		ContentLength: int64(len(b.body)),
+	}, nil
+}
+
+// fetchConcurrently issues n identical requests built by newReq through rp,
+// releasing the upstream once they have all started.
+func fetchConcurrently(t *testing.T, rp *ResponseProcessor, upstream *blockingTransport, n int, newReq func() *http.Request) (bodies []string, coalesced int) {
+	t.Helper()
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := rp.RoundTrip(newReq())
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			mu.Lock()
+			defer mu.Unlock()
+			bodies = append(bodies, string(body))
+			if resp.Header.Get("X-Coalesced") == "true" {
+				coalesced++
+			}
+		}()
+	}
+	// Give every caller time to join the in-flight request.
+	time.Sleep(50 * time.Millisecond)
+	close(upstream.release)
+	wg.Wait()
+	return bodies, coalesced
+}
+
+func TestResponseProcessor_Coalesce(t *testing.T) {
+	upstream := &blockingTransport{
+		contentType: "text/html",
+		body:        "<h1>Shared</h1>",
+		release:     make(chan struct{}),
+	}
+	rp := &ResponseProcessor{ConvertHTML: true, Coalesce: true, Inner: upstream}
+
+	bodies, coalesced := fetchConcurrently(t, rp, upstream, 5, func() *http.Request {
+		req, _ := http.NewRequest("GET", "http://example.com/doc", nil)
+		return req
+	})
+
+	if got := upstream.calls.Load(); got != 1 {
+		t.Errorf("expected 1 upstream call, got %d", got)
+	}
+	if coalesced != 4 {
+		t.Errorf("expected 4 coalesced responses, got %d", coalesced)
+	}
+	for _, body := range bodies {
+		if !strings.Contains(body, "# Shared") {
+			t.Errorf("expected converted body, got %q", body)
+		}
+	}
+}
+
+func TestResponseProcessor_CoalesceSkipsCredentials(t *testing.T) {
+	upstream := &blockingTransport{
+		contentType: "text/html",
+		body:        "<h1>Private</h1>",
+		release:     make(chan struct{}),
+	}
+	rp := &ResponseProcessor{ConvertHTML: true, Coalesce: true, Inner: upstream}
+
+	_, coalesced := fetchConcurrently(t, rp, upstream, 3, func() *http.Request {
+		req, _ := http.NewRequest("GET", "http://example.com/account", nil)
+		req.Header.Set("Cookie", "session=abc")
+		return req
+	})
+
+	if got := upstream.calls.Load(); got != 3 {
+		t.Errorf("expected 3 upstream calls, got %d", got)
+	}
+	if coalesced != 0 {
+		t.Errorf("expected no coalesced responses, got %d", coalesced)
+	}
+}
+
+func TestResponseProcessor_CoalesceCacheDirectives(t *testing.T) {
+	upstream := &blockingTransport{
+		contentType: "text/html",
+		body:        "<h1>Shared</h1>",
+		release:     make(chan struct{}),
+	}
+	rp := &ResponseProcessor{ConvertHTML: true, Coalesce: true, Inner: upstream}
+
+	var n atomic.Int32
+	_, coalesced := fetchConcurrently(t, rp, upstream, 4, func() *http.Request {
+		req, _ := http.NewRequest("GET", "http://example.com/page", nil)
+		// Half the callers force revalidation and must not share a
+		// response with those that accept a cached one.
+		if n.Add(1)%2 == 0 {
+			req.Header.Set("Cache-Control", "No-Cache")
+		}
+		return req
+	})
+	if got := upstream.calls.Load(); got != 2 || coalesced != 2 {
+		t.Errorf("upstream calls = %d, coalesced = %d; want 2, 2", got, coalesced)
+	}
+}
+
+func TestCacheDirectives(t *testing.T) {
+	a, _ := http.NewRequest("GET", "http://example.com/", nil)
+	a.Header.Set("Cache-Control", "max-age=0, No-Cache")
+	b, _ := http.NewRequest("GET", "http://example.com/", nil)
+	b.Header.Add("Cache-Control", "max-age = 0")
+	b.Header.Add("Cache-Control", "no-cache")
+	if cacheDirectives(a) != cacheDirectives(b) {
+		t.Errorf("equivalent directives differ: %q, %q", cacheDirectives(a), cacheDirectives(b))
+	}
+	c, _ := http.NewRequest("GET", "http://example.com/", nil)
+	c.Header.Set("Pragma", "no-cache")
+	if d, _ := http.NewRequest("GET", "http://example.com/", nil); cacheDirectives(c) == cacheDirectives(d) {
+		t.Error("Pragma: no-cache should change the directives")
+	}
+}
+
+func TestResponseProcessor_CoalesceStreamed(t *testing.T) {
+	upstream := &blockingTransport{
+		contentType: "image/png",
+		body:        "png",
+		release:     make(chan struct{}),
+	}
+	rp := &ResponseProcessor{ConvertHTML: true, Coalesce: true, Inner: upstream}
+
+	bodies, _ := fetchConcurrently(t, rp, upstream, 3, func() *http.Request {
+		req, _ := http.NewRequest("GET", "http://example.com/logo.png", nil)
+		return req
+	})
+
+	// Bodies that are not buffered are fetched by each caller.
+	if got := upstream.calls.Load(); got != 3 {
+		t.Errorf("expected 3 upstream calls, got %d", got)
+	}
+	for _, body := range bodies {
+		if body != "png" {
+			t.Errorf("body = %q, want %q", body, "png")
+		}
+	}
+}
+
+func TestResponseProcessor_CoalesceUnconvertedJSON(t *testing.T) {
+	upstream := &blockingTransport{
+		contentType: "application/json",
+		body:        `{"a":1}`,
+		release:     make(chan struct{}),
+	}
+	// JSON conversion is off, so the upstream body passes through unread
+	// and unbounded; it must not be buffered for followers.
+	rp := &ResponseProcessor{ConvertHTML: true, Coalesce: true, Inner: upstream}
+
+	bodies, coalesced := fetchConcurrently(t, rp, upstream, 3, func() *http.Request {
+		req, _ := http.NewRequest("GET", "http://example.com/api", nil)
+		return req
+	})
+	if got := upstream.calls.Load(); got != 3 || coalesced != 0 {
+		t.Errorf("upstream calls = %d, coalesced = %d; want 3, 0", got, coalesced)
+	}
+	for _, body := range bodies {
+		if body != `{"a":1}` {
+			t.Errorf("body = %q", body)
+		}
+	}
+}
@@ -1,17 +1,24 @@
 package middleware
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"io"
 	"log"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/rickcrawford/markdowninthemiddle/internal/cache"
 	"github.com/rickcrawford/markdowninthemiddle/internal/converter"
 	"github.com/rickcrawford/markdowninthemiddle/internal/output"
+	"github.com/rickcrawford/markdowninthemiddle/internal/rules"
 	"github.com/rickcrawford/markdowninthemiddle/internal/templates"
 	"github.com/rickcrawford/markdowninthemiddle/internal/tokens"
+	"golang.org/x/sync/singleflight"
 )
 
 // ResponseProcessor holds the dependencies needed by the response-rewriting
@@ -25,18 +32,114 @@ type ResponseProcessor struct {
 	ConvertJSON bool
 	// NegotiateOnly when true only converts when the client sends Accept: text/markdown.
 	NegotiateOnly bool
+	// Extract is the part of HTML documents to convert (converter.ExtractFull
+	// or converter.ExtractArticle). Clients override it per request with the
+	// X-Extract header.
+	Extract string
+	// Markdown is the style of the Markdown written for HTML. Clients
+	// override it per request with the X-Markdown-* headers.
+	Markdown converter.MarkdownOptions
+	// MaxFeedEntries caps the entries rendered from RSS and Atom feeds.
+	// 0 = all.
+	MaxFeedEntries int
 	// TokenCounter counts tokens on converted markdown responses.
 	TokenCounter *tokens.Counter
-	// Cache stores HTML responses to disk.
+	// Cache holds fetched responses and their Markdown conversions on disk.
+	// It answers fresh requests, revalidates and serves stale entries, and
+	// replays responses in Offline mode. Nil disables caching.
 	Cache *cache.DiskCache
 	// OutputWriter writes converted Markdown files to a directory.
 	OutputWriter *output.Writer
+	// FrontMatter prepends YAML front matter with page metadata to converted
+	// responses.
+	FrontMatter bool
+	// StructuredData appends the JSON-LD, OpenGraph and microdata of HTML
+	// pages to their Markdown as a "Structured data" section, and returns
+	// it as JSON in the X-Structured-Data header.
+	StructuredData bool
+	// Compact runs converted Markdown through converter.Compact to save
+	// tokens. Clients override it per request with the X-Compact header.
+	Compact bool
+	// OutputFrontMatter prepends YAML front matter to the files written by
+	// OutputWriter.
+	OutputFrontMatter bool
+	// Registry maps response content types to converters. When nil,
+	// converter.Default is used.
+	Registry *converter.Registry
 	// TemplateStore holds user-defined Mustache templates for JSON conversion.
 	TemplateStore *templates.Store
+	// RuleStore holds per-site CSS selector rules for HTML conversion.
+	RuleStore *rules.Store
 	// Inner is the actual transport used to make requests.
 	Inner http.RoundTripper
 	// TransportType is the type of transport used (http or chrome).
 	TransportType string
+	// Offline answers every request from Cache and never calls Inner.
+	Offline bool
+	// Coalesce shares one upstream fetch and conversion among concurrent
+	// identical GET requests.
+	Coalesce bool
+
+	// revalidating holds the cache keys with a background revalidation in
+	// flight, so stale-while-revalidate triggers at most one per entry.
+	revalidating sync.Map
+	// inflight deduplicates concurrent identical requests when Coalesce is set.
+	inflight singleflight.Group
+}
+
+// extractHeader is the request header that overrides
+// ResponseProcessor.Extract.
+const extractHeader = "X-Extract"
+
+// compactHeader is the request header that overrides
+// ResponseProcessor.Compact.
+const compactHeader = "X-Compact"
+
+// Request headers that ask for one token-bounded window of the Markdown,
+// and the response headers that describe it.
+const (
+	maxTokensHeader       = "X-Max-Tokens"
+	tokenOffsetHeader     = "X-Token-Offset"
+	tokenTotalHeader      = "X-Token-Total"
+	nextTokenOffsetHeader = "X-Next-Token-Offset"
+)
+
+// conversionErrorHeader is the response header that reports why a response
+// the proxy should have converted was passed through unconverted.
+const conversionErrorHeader = "X-Conversion-Error"
+
+// structuredDataHeader is the response header holding the structured data
+// of a converted page as JSON. Data larger than maxStructuredDataHeader is
+// left out of it, as proxies and clients limit header sizes; it is still in
+// the Markdown.
+const (
+	structuredDataHeader    = "X-Structured-Data"
+	maxStructuredDataHeader = 8 << 10
+)
+
+// Request headers that override the fields of ResponseProcessor.Markdown.
+const (
+	headingStyleHeader = "X-Markdown-Heading-Style"
+	linkStyleHeader    = "X-Markdown-Link-Style"
+	bulletHeader       = "X-Markdown-Bullet"
+	dropImagesHeader   = "X-Markdown-Drop-Images"
+	rawTablesHeader    = "X-Markdown-Raw-Tables"
+)
+
+// markdownVary lists the request headers a Markdown response depends on:
+// Accept, the token window headers and every header that changes the
+// conversion.
+var markdownVary = []string{
+	"accept",
+	"x-max-tokens",
+	"x-token-offset",
+	"x-extract",
+	"x-compact",
+	"x-markdown-heading-style",
+	"x-markdown-link-style",
+	"x-markdown-bullet",
+	"x-markdown-drop-images",
+	"x-markdown-raw-tables",
 }
 
 // wantsMarkdown checks if the request Accept header includes text/markdown.
@@ -51,50 +154,158 @@ func wantsMarkdown(req *http.Request) bool {
 	return false
 }
 
-// RoundTrip implements http.RoundTripper. It delegates to the inner transport,
-// then post-processes the response: decompresses encoded bodies, enforces size
-// limits, caches HTML, converts HTML to Markdown, and counts tokens.
+// RoundTrip implements http.RoundTripper. It answers from the disk cache when
+// possible, otherwise delegates to the inner transport, then post-processes
+// the response: decompresses encoded bodies, enforces size limits, caches
+// HTML, converts HTML to Markdown, and counts tokens.
 // When JSON conversion is enabled, JSON responses are also converted to
 // Markdown using Mustache templates (user-defined or auto-generated).
+// When Coalesce is set, concurrent identical requests share one upstream
+// fetch and conversion.
 func (rp *ResponseProcessor) RoundTrip(req *http.Request) (*http.Response, error) {
-	resp, err := rp.Inner.RoundTrip(req)
+	if rp.Coalesce && coalescable(req) {
+		return rp.coalesce(req)
+	}
+	return rp.roundTrip(req)
+}
+
+// roundTrip fetches and processes a single request; see RoundTrip.
+func (rp *ResponseProcessor) roundTrip(req *http.Request) (*http.Response, error) {
+	// The cache key covers the request headers that the URL's responses
+	// vary on; it is computed once and shared by both cache layers.
+	key := rp.Cache.RequestKey(req)
+
+	// A cached conversion skips both the upstream fetch and the conversion.
+	if resp, ok := rp.cachedMarkdown(req, key); ok {
+		return resp, nil
+	}
+
+	resp, cacheStatus, err := rp.fetch(req, key)
 	if err != nil {
 		return resp, err
 	}
+	if cacheStatus == cacheMiss && rp.Cache.Cacheable(req, resp) {
+		// A fresh response may name different Vary headers than the
+		// index the lookup used.
+		key = rp.Cache.VariantKey(req, resp)
+	}
 
-	// Add transport type header
-	if rp.TransportType != "" {
+	// Add transport type header when the response came from upstream.
+	if rp.TransportType != "" && cacheStatus != cacheHit && cacheStatus != cacheStale {
 		resp.Header.Set("X-Transport", rp.TransportType)
 	}
+	if cacheStatus != "" {
+		resp.Header.Set("X-Cache", cacheStatus)
+	}
 
 	ct := resp.Header.Get("Content-Type")
-	isHTML := converter.IsHTMLContentType(ct)
-	isJSON := converter.IsJSONContentType(ct)
-
-	if !isHTML && !isJSON {
+	conv := rp.registry().Lookup(ct)
+	if conv == nil {
 		return resp, nil
 	}
+	isHTML := conv.Format == converter.FormatHTML
 
 	// Determine whether to convert this response.
-	shouldConvertHTML := isHTML && rp.ConvertHTML
-	shouldConvertJSON := isJSON && rp.ConvertJSON
-	if rp.NegotiateOnly {
-		wants := wantsMarkdown(req)
-		shouldConvertHTML = isHTML && wants
-		shouldConvertJSON = isJSON && wants
+	shouldConvert := rp.converts(req, conv.Format)
+
+	// If no conversion applies and it's not HTML (which we still decompress), bail early.
+	if !isHTML && !shouldConvert {
+		return resp, nil
+	}
+
+	// Binary documents are only converted whole; larger ones pass through.
+	if conv.Binary {
+		if tooLarge, err := rp.readWhole(resp); err != nil {
+			log.Printf("reading response body: %v", err)
+			return resp, nil
+		} else if tooLarge {
+			resp.Header.Set(conversionErrorHeader, "body exceeds the "+strconv.FormatInt(rp.MaxBodySize, 10)+" byte limit")
+			return resp, nil
+		}
+	}
+
+	rawBytes, err := rp.readBody(resp)
+	if err != nil {
+		log.Printf("reading response body: %v", err)
+		return resp, nil
+	}
+
+	// Close the original body now that we've consumed it.
+	resp.Body.Close()
+
+	rawStr := string(rawBytes)
+
+	// Cache the original HTML if caching is enabled and response is cacheable.
+	// Responses served from the cache are already stored.
+	if isHTML && cacheStatus == cacheMiss {
+		rp.storeHTML(req, key, resp, rawBytes)
 	}
 
-	// If neither conversion applies and it's not HTML (which we still decompress), bail early.
-	if !isHTML && !shouldConvertJSON {
+	// Convert to Markdown with the converter registered for the content
+	// type. Conversions work on UTF-8 text, whatever charset the body was
+	// sent in.
+	if shouldConvert {
+		text := rawBytes
+		if !conv.Binary {
+			if text, err = converter.ToUTF8(rawBytes, ct); err != nil {
+				log.Printf("charset decoding error: %v", err)
+				text = rawBytes
+			}
+		}
+
+		extract := rp.extractMode(req)
+		md, err := conv.Convert(converter.Input{
+			Body:        text,
+			HTML:        rp.htmlOptions(req, extract),
+			Template:    rp.template(req),
+			FeedEntries: rp.MaxFeedEntries,
+		})
+		if errors.Is(err, converter.ErrNotApplicable) {
+			// Not a document the converter handles, such as XML that is
+			// not a feed: pass it through as is.
+			return setRawBody(resp, rawStr), nil
+		}
+		if err != nil {
+			log.Printf("%s-to-markdown conversion error: %v", conv.Format, err)
+			// Fall through with the original body.
+			resp.Header.Set(conversionErrorHeader, err.Error())
+			return setRawBody(resp, rawStr), nil
+		}
+
+		if !isHTML {
+			return rp.finalizeMarkdown(resp, req, md, pageInfo{}, rp.markdownKey(req, key, conv.Format), cacheStatus), nil
+		}
+
+		htmlStr := string(text)
+		page := rp.pageInfo(req, htmlStr)
+		resp = rp.finalizeMarkdown(resp, req, md, page, rp.markdownKey(req, key, conv.Format), cacheStatus)
+		if extract == converter.ExtractArticle {
+			rp.countFullPage(resp, req, key, htmlStr, page, cacheStatus)
+		}
 		return resp, nil
 	}
 
+	// Not converting — return the decompressed body.
+	return setRawBody(resp, rawStr), nil
+}
+
+// setRawBody replaces the body of resp with its decompressed original.
+func setRawBody(resp *http.Response, body string) *http.Response {
+	resp.Body = newBufferedBody(body)
+	resp.ContentLength = int64(len(body))
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return resp
+}
+
+// readBody decompresses the response body and reads it up to MaxBodySize.
+// The caller remains responsible for closing resp.Body.
+func (rp *ResponseProcessor) readBody(resp *http.Response) ([]byte, error) {
 	// Decompress encoded body.
 	encoding := resp.Header.Get("Content-Encoding")
 	body, err := Decompress(resp.Body, encoding)
 	if err != nil {
-		log.Printf("decompress error: %v", err)
-		return resp, nil
+		return nil, err
 	}
 
 	// Enforce body size limit.
@@ -102,93 +313,355 @@ func (rp *ResponseProcessor) RoundTrip(req *http.Request) (*http.Response, error
 	if rp.MaxBodySize > 0 {
 		reader = io.LimitReader(body, rp.MaxBodySize)
 	}
+	return io.ReadAll(reader)
+}
 
-	rawBytes, err := io.ReadAll(reader)
+// readWhole decompresses the response body and, when it fits within
+// MaxBodySize, replaces resp.Body with it. A larger body is left to stream
+// through, decompressed, and readWhole reports that it is too large.
+func (rp *ResponseProcessor) readWhole(resp *http.Response) (tooLarge bool, err error) {
+	body, err := Decompress(resp.Body, resp.Header.Get("Content-Encoding"))
 	if err != nil {
-		log.Printf("reading response body: %v", err)
-		return resp, nil
+		return false, err
+	}
+	var reader io.Reader = body
+	if rp.MaxBodySize > 0 {
+		reader = io.LimitReader(body, rp.MaxBodySize+1)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return false, err
+	}
+	if rp.MaxBodySize > 0 && int64(len(data)) > rp.MaxBodySize {
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(data), body), resp.Body}
+		resp.ContentLength = -1
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		return true, nil
 	}
-
-	// Close the original body now that we've consumed it.
 	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	resp.Header.Del("Content-Encoding")
+	return false, nil
+}
 
-	rawStr := string(rawBytes)
-
-	// Cache the original HTML if caching is enabled and response is cacheable.
-	if isHTML && rp.Cache != nil && cache.IsCacheable(resp) {
-		ttl := cache.TTL(resp)
-		if err := rp.Cache.Put(req.URL.String(), rawBytes, ttl); err != nil {
-			log.Printf("cache put error: %v", err)
-		}
+// registry returns the converters to dispatch responses to.
+func (rp *ResponseProcessor) registry() *converter.Registry {
+	if rp.Registry != nil {
+		return rp.Registry
 	}
+	return converter.Default
+}
 
-	// Convert JSON to Markdown via Mustache templates.
-	if shouldConvertJSON {
-		// Look up a user-defined template for this URL.
-		var tpl string
-		if rp.TemplateStore != nil {
-			tpl = rp.TemplateStore.Match(req.URL.String())
-		}
+// converts reports whether responses to req in the given format should be
+// converted, taking content negotiation into account. JSON has its own
+// switch; ConvertHTML covers every other format.
+func (rp *ResponseProcessor) converts(req *http.Request, format string) bool {
+	if rp.NegotiateOnly {
+		return wantsMarkdown(req)
+	}
+	if format == converter.FormatJSON {
+		return rp.ConvertJSON
+	}
+	return rp.ConvertHTML
+}
 
-		md, err := converter.JSONToMarkdown(rawBytes, tpl)
-		if err != nil {
-			log.Printf("json-to-markdown conversion error: %v", err)
-			// Fall through with original JSON.
-			resp.Body = io.NopCloser(strings.NewReader(rawStr))
-			resp.ContentLength = int64(len(rawStr))
-			return resp, nil
-		}
+// extractMode returns the extraction mode for req: the X-Extract header
+// when it names a known mode, otherwise the configured default.
+func (rp *ResponseProcessor) extractMode(req *http.Request) string {
+	mode := strings.ToLower(strings.TrimSpace(req.Header.Get(extractHeader)))
+	if mode == "" || !converter.ValidExtract(mode) {
+		mode = rp.Extract
+	}
+	if mode == "" {
+		return converter.ExtractFull
+	}
+	return mode
+}
 
-		return rp.finalizeMarkdown(resp, req, md), nil
+// compact reports whether the Markdown for req is compacted: the
+// X-Compact header when it holds a boolean, otherwise the configured
+// default.
+func (rp *ResponseProcessor) compact(req *http.Request) bool {
+	if v, err := strconv.ParseBool(req.Header.Get(compactHeader)); err == nil {
+		return v
 	}
+	return rp.Compact
+}
 
-	// Convert HTML to Markdown.
-	if shouldConvertHTML {
-		md, err := converter.HTMLToMarkdown(rawStr)
-		if err != nil {
-			log.Printf("html-to-markdown conversion error: %v", err)
-			// Fall through with original HTML.
-			resp.Body = io.NopCloser(strings.NewReader(rawStr))
-			resp.ContentLength = int64(len(rawStr))
-			return resp, nil
+// markdownOptions returns the Markdown style for req: the configured style
+// with the valid X-Markdown-* header values applied over it.
+func (rp *ResponseProcessor) markdownOptions(req *http.Request) converter.MarkdownOptions {
+	m := rp.Markdown
+	override := func(header string, field *string) {
+		v := strings.TrimSpace(req.Header.Get(header))
+		if v == "" {
+			return
+		}
+		prev := *field
+		*field = strings.ToLower(v)
+		if m.Validate() != nil {
+			*field = prev
 		}
+	}
+	override(headingStyleHeader, &m.HeadingStyle)
+	override(linkStyleHeader, &m.LinkStyle)
+	override(bulletHeader, &m.Bullet)
+	if v, err := strconv.ParseBool(req.Header.Get(dropImagesHeader)); err == nil {
+		m.DropImages = v
+	}
+	if v, err := strconv.ParseBool(req.Header.Get(rawTablesHeader)); err == nil {
+		m.RawTables = v
+	}
+	return m
+}
 
-		return rp.finalizeMarkdown(resp, req, md), nil
+// htmlOptions returns the HTML conversion options for req with the given
+// extraction mode.
+func (rp *ResponseProcessor) htmlOptions(req *http.Request, extract string) converter.Options {
+	return converter.Options{
+		Extract:   extract,
+		BaseURL:   req.URL.String(),
+		Selectors: rp.RuleStore.Match(req.URL.String()),
+		Markdown:  rp.markdownOptions(req),
 	}
+}
 
-	// Not converting — return the decompressed body.
-	resp.Body = io.NopCloser(strings.NewReader(rawStr))
-	resp.ContentLength = int64(len(rawStr))
-	resp.Header.Del("Content-Encoding")
-	resp.Header.Set("Content-Length", strconv.Itoa(len(rawStr)))
-	return resp, nil
+// countFullPage converts the whole page behind an extracted article so the
+// response can report the tokens extraction saved in X-Token-Count-Full.
+// The full conversion is cached like any other.
+func (rp *ResponseProcessor) countFullPage(resp *http.Response, req *http.Request, key, body string, page pageInfo, cacheStatus string) {
+	if rp.TokenCounter == nil {
+		return
+	}
+	md, err := converter.ConvertHTML(body, rp.htmlOptions(req, converter.ExtractFull))
+	if err != nil {
+		log.Printf("html-to-markdown conversion error: %v", err)
+		return
+	}
+	md = page.withAppendix(md)
+	if rp.compact(req) {
+		md = converter.Compact(md)
+	}
+	count := rp.TokenCounter.Count(md)
+	resp.Header.Set("X-Token-Count-Full", strconv.Itoa(count))
+	if rp.FrontMatter {
+		md = rp.frontMatterFor(req, resp, page.meta, count) + md
+	}
+	rp.putMarkdown(req, resp, rp.htmlMarkdownKey(req, key, converter.ExtractFull), md, count, page.structured, cacheStatus)
 }
 
-// finalizeMarkdown sets the response body to the converted Markdown, counts
-// tokens, writes output, and updates response headers.
-func (rp *ResponseProcessor) finalizeMarkdown(resp *http.Response, req *http.Request, md string) *http.Response {
-	// Count tokens on the converted Markdown and set header.
+// template returns the user-defined Mustache template for req's URL, if any.
+func (rp *ResponseProcessor) template(req *http.Request) string {
+	if rp.TemplateStore == nil {
+		return ""
+	}
+	return rp.TemplateStore.Match(req.URL.String())
+}
+
+// finalizeMarkdown sets the response body to the converted Markdown,
+// compacted if requested, counts tokens, writes output, and updates
+// response headers. page holds the
+// metadata and structured data of HTML documents. When the response came
+// through the cache and may be stored, the conversion is cached under mdKey
+// so repeat requests skip it.
+func (rp *ResponseProcessor) finalizeMarkdown(resp *http.Response, req *http.Request, md string, page pageInfo, mdKey, cacheStatus string) *http.Response {
+	md = page.withAppendix(md)
+	if rp.compact(req) {
+		md = converter.Compact(md)
+	}
+
+	// Count tokens on the converted Markdown.
+	count := -1
 	if rp.TokenCounter != nil {
-		count := rp.TokenCounter.Count(md)
-		resp.Header.Set("X-Token-Count", strconv.Itoa(count))
+		count = rp.TokenCounter.Count(md)
+	}
+
+	var frontMatter string
+	if rp.frontMatter() {
+		frontMatter = rp.frontMatterFor(req, resp, page.meta, count)
 	}
 
 	// Write converted Markdown to output directory if configured.
 	if rp.OutputWriter != nil {
-		if err := rp.OutputWriter.Write(req.URL.String(), []byte(md)); err != nil {
+		out := md
+		if rp.OutputFrontMatter {
+			out = frontMatter + md
+		}
+		if err := rp.OutputWriter.Write(req.URL.String(), []byte(out)); err != nil {
 			log.Printf("output write error: %v", err)
 		}
 	}
 
+	if rp.FrontMatter {
+		md = frontMatter + md
+	}
+
+	rp.putMarkdown(req, resp, mdKey, md, count, page.structured, cacheStatus)
+
+	setStructuredData(resp, page.structured)
+	return rp.writeMarkdown(req, resp, md, count)
+}
+
+// pageInfo is what the proxy takes from an HTML page besides its Markdown.
+type pageInfo struct {
+	// meta is the page metadata for front matter.
+	meta converter.Metadata
+	// structured is the page's structured data as JSON, and appendix its
+	// Markdown section. Both are empty unless StructuredData is set and
+	// the page has some.
+	structured []byte
+	appendix   string
+}
+
+// pageInfo extracts what the conversion of the HTML page htmlStr needs
+// besides the Markdown.
+func (rp *ResponseProcessor) pageInfo(req *http.Request, htmlStr string) pageInfo {
+	var page pageInfo
+	if rp.frontMatter() {
+		page.meta = converter.ExtractMetadata(htmlStr, req.URL.String())
+	}
+	if rp.StructuredData {
+		data := converter.ExtractStructuredData(htmlStr, req.URL.String())
+		if !data.Empty() {
+			page.appendix = data.Appendix()
+			page.structured, _ = json.Marshal(data)
+		}
+	}
+	return page
+}
+
+// withAppendix returns md followed by the structured data appendix, if any.
+func (p pageInfo) withAppendix(md string) string {
+	if p.appendix == "" {
+		return md
+	}
+	return strings.TrimSpace(md + "\n\n" + p.appendix)
+}
+
+// setStructuredData sets the X-Structured-Data header to data, compacted,
+// unless it is empty or too large for a header.
+func setStructuredData(resp *http.Response, data []byte) {
+	var b bytes.Buffer
+	if len(data) == 0 || json.Compact(&b, data) != nil || b.Len() > maxStructuredDataHeader {
+		return
+	}
+	resp.Header.Set(structuredDataHeader, b.String())
+}
+
+// frontMatter reports whether any conversion output carries front matter.
+func (rp *ResponseProcessor) frontMatter() bool {
+	return rp.FrontMatter || rp.OutputWriter != nil && rp.OutputFrontMatter
+}
+
+// frontMatterFor renders the front matter for a conversion of resp: the
+// page metadata plus the source URL, fetch time, status and token count.
+// The fetch time of cached responses is derived from their Age header.
+func (rp *ResponseProcessor) frontMatterFor(req *http.Request, resp *http.Response, page converter.Metadata, tokens int) string {
+	page.Source = req.URL.String()
+	page.FetchedAt = time.Now()
+	if age, err := strconv.Atoi(resp.Header.Get("Age")); err == nil && age > 0 {
+		page.FetchedAt = page.FetchedAt.Add(-time.Duration(age) * time.Second)
+	}
+	page.Status = resp.StatusCode
+	if tokens >= 0 {
+		page.Tokens = &tokens
+	}
+	return page.FrontMatter()
+}
+
+// putMarkdown caches a conversion of resp under mdKey for as long as the
+// source response stays fresh, if resp came through the cache and may be
+// stored.
+func (rp *ResponseProcessor) putMarkdown(req *http.Request, resp *http.Response, mdKey, md string, count int, structured []byte, cacheStatus string) {
+	if cacheStatus == "" || !rp.Cache.Cacheable(req, resp) {
+		return
+	}
+	if ttl := rp.Cache.TTL(resp); ttl > 0 {
+		if err := rp.Cache.PutMarkdown(mdKey, md, count, structured, ttl); err != nil {
+			log.Printf("markdown cache put error: %v", err)
+		}
+	}
+}
+
+// tokenWindow returns the window of the Markdown req asks for with the
+// X-Token-Offset and X-Max-Tokens headers, and whether it asks for one.
+// Windows need a TokenCounter.
+func (rp *ResponseProcessor) tokenWindow(req *http.Request) (offset, maxTokens int, ok bool) {
+	if rp.TokenCounter == nil {
+		return 0, 0, false
+	}
+	if v, err := strconv.Atoi(strings.TrimSpace(req.Header.Get(tokenOffsetHeader))); err == nil && v > 0 {
+		offset = v
+	}
+	if v, err := strconv.Atoi(strings.TrimSpace(req.Header.Get(maxTokensHeader))); err == nil && v > 0 {
+		maxTokens = v
+	}
+	return offset, maxTokens, offset > 0 || maxTokens > 0
+}
+
+// writeMarkdown sets the response body to md, or to the window of it req
+// asks for. A window response counts the tokens in the window in
+// X-Token-Count and in the whole document in X-Token-Total and, unless it
+// reaches the end, gives the offset of the next window in
+// X-Next-Token-Offset.
+func (rp *ResponseProcessor) writeMarkdown(req *http.Request, resp *http.Response, md string, tokens int) *http.Response {
+	offset, maxTokens, windowed := rp.tokenWindow(req)
+	if !windowed {
+		return setMarkdownBody(resp, md, tokens)
+	}
+	w := rp.TokenCounter.Window(md, offset, maxTokens)
+	resp.Header.Set(tokenTotalHeader, strconv.Itoa(w.Total))
+	if w.Next >= 0 {
+		resp.Header.Set(nextTokenOffsetHeader, strconv.Itoa(w.Next))
+	}
+	return setMarkdownBody(resp, w.Text, rp.TokenCounter.Count(w.Text))
+}
+
+// setMarkdownBody replaces the response body with md and updates the
+// response headers. tokens is omitted from the headers when negative.
+func setMarkdownBody(resp *http.Response, md string, tokens int) *http.Response {
+	if tokens >= 0 {
+		resp.Header.Set("X-Token-Count", strconv.Itoa(tokens))
+	}
+
 	// Replace response body with Markdown.
-	resp.Body = io.NopCloser(strings.NewReader(md))
+	resp.Body = newBufferedBody(md)
 	resp.ContentLength = int64(len(md))
 	resp.Header.Set("Content-Type", "text/markdown; charset=utf-8")
 	resp.Header.Del("Content-Encoding")
 	resp.Header.Set("Content-Length", strconv.Itoa(len(md)))
 	// Signal that the response varies based on the Accept header,
-	// consistent with Cloudflare's Markdown for Agents approach.
-	resp.Header.Set("Vary", "accept")
+	// consistent with Cloudflare's Markdown for Agents approach, and on
+	// the token window and conversion headers, so caches keep whole
+	// documents, windows and differently converted documents apart.
+	addVary(resp.Header, markdownVary...)
 
 	return resp
 }
+
+// addVary adds names to the Vary header of h, keeping the names it already
+// lists. A Vary: * is left as it is.
+func addVary(h http.Header, names ...string) {
+	var vary []string
+	seen := map[string]bool{}
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name == "*" {
+				return
+			} else if name != "" && !seen[strings.ToLower(name)] {
+				seen[strings.ToLower(name)] = true
+				vary = append(vary, name)
+			}
+		}
+	}
+	for _, name := range names {
+		if !seen[name] {
+			vary = append(vary, name)
+		}
+	}
+	h.Set("Vary", strings.Join(vary, ", "))
+}
@@ -1,12 +1,24 @@
 package middleware
 
 import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/rickcrawford/markdowninthemiddle/internal/cache"
+	"github.com/rickcrawford/markdowninthemiddle/internal/converter"
+	"github.com/rickcrawford/markdowninthemiddle/internal/output"
+	"github.com/rickcrawford/markdowninthemiddle/internal/rules"
 	"github.com/rickcrawford/markdowninthemiddle/internal/tokens"
 )
 
@@ -34,6 +46,58 @@ func (m *mockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	}, nil
 }
 
+// validatingTransport serves a fixed HTML body with an ETag, answers
+// matching conditional requests with 304, and counts upstream calls.
+type validatingTransport struct {
+	body         string
+	contentType  string // defaults to text/html
+	etag         string
+	maxAge       int
+	noStore      bool
+	cacheControl string // overrides maxAge and noStore when set
+	statusCode   int    // defaults to 200
+	calls        int
+}
+
+func (v *validatingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	v.calls++
+	header := http.Header{}
+	if v.etag != "" {
+		header.Set("ETag", v.etag)
+	}
+	if v.cacheControl != "" {
+		header.Set("Cache-Control", v.cacheControl)
+	} else if v.noStore {
+		header.Set("Cache-Control", "no-store")
+	} else {
+		header.Set("Cache-Control", "max-age="+strconv.Itoa(v.maxAge))
+	}
+
+	if v.etag != "" && req.Header.Get("If-None-Match") == v.etag {
+		return &http.Response{
+			StatusCode: http.StatusNotModified,
+			Header:     header,
+			Body:       io.NopCloser(strings.NewReader("")),
+		}, nil
+	}
+
+	ct := v.contentType
+	if ct == "" {
+		ct = "text/html"
+	}
+	header.Set("Content-Type", ct)
+	status := v.statusCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return &http.Response{
+		StatusCode:    status,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(v.body)),
+		ContentLength: int64(len(v.body)),
+	}, nil
+}
+
 func TestResponseProcessor_HTMLToMarkdown(t *testing.T) {
 	// Token counter may be nil if tiktoken can't download encodings (no network).
 	tc, _ := tokens.NewCounter("cl100k_base")
@@ -86,8 +150,8 @@ func TestResponseProcessor_HTMLToMarkdown(t *testing.T) {
 	}
 
 	vary := resp.Header.Get("Vary")
-	if vary != "accept" {
-		t.Errorf("expected Vary: accept, got %q", vary)
+	if vary != markdownVaryHeader {
+		t.Errorf("expected Vary: %s, got %q", markdownVaryHeader, vary)
 	}
 }
 
@@ -297,8 +361,8 @@ func TestResponseProcessor_JSONToMarkdown(t *testing.T) {
 	}
 
 	vary := resp.Header.Get("Vary")
-	if vary != "accept" {
-		t.Errorf("expected Vary: accept, got %q", vary)
+	if vary != markdownVaryHeader {
+		t.Errorf("expected Vary: %s, got %q", markdownVaryHeader, vary)
 	}
 
 	// Verify token count is in response header
@@ -388,6 +452,462 @@ func TestResponseProcessor_JSONNegotiateOnly(t *testing.T) {
 	}
 }
 
+func TestResponseProcessor_CacheHit(t *testing.T) {
+	dc, err := cache.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("cache.New: %v", err)
+	}
+	upstream := &validatingTransport{body: "<h1>Cached</h1>", etag: `"v1"`, maxAge: 3600}
+	rp := &ResponseProcessor{ConvertHTML: true, Cache: dc, Inner: upstream}
+
+	for i, want := range []string{"MISS", "HIT"} {
+		req, _ := http.NewRequest("GET", "http://example.com/doc", nil)
+		resp, err := rp.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("request %d: unexpected error: %v", i, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if got := resp.Header.Get("X-Cache"); got != want {
+			t.Errorf("request %d: X-Cache = %q, want %q", i, got, want)
+		}
+		if !strings.Contains(string(body), "# Cached") {
+			t.Errorf("request %d: expected converted markdown, got %q", i, body)
+		}
+	}
+
+	if upstream.calls != 1 {
+		t.Errorf("expected 1 upstream call, got %d", upstream.calls)
+	}
+}
+
+func TestResponseProcessor_CacheRevalidated(t *testing.T) {
+	dc, err := cache.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("cache.New: %v", err)
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "text/html")
+	header.Set("ETag", `"v1"`)
+	stale := &http.Response{StatusCode: http.StatusOK, Header: header}
+	if err := dc.Store("http://example.com/doc", stale, []byte("<h1>Stale</h1>"), -time.Minute); err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+
+	upstream := &validatingTransport{body: "<h1>Fresh</h1>", etag: `"v1"`, maxAge: 600}
+	rp := &ResponseProcessor{ConvertHTML: true, Cache: dc, Inner: upstream}
+
+	req, _ := http.NewRequest("GET", "http://example.com/doc", nil)
+	resp, err := rp.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if got := resp.Header.Get("X-Cache"); got != "REVALIDATED" {
+		t.Errorf("X-Cache = %q, want REVALIDATED", got)
+	}
+	if resp.Header.Get("Age") == "" {
+		t.Error("expected Age header")
+	}
+	if !strings.Contains(string(body), "# Stale") {
+		t.Errorf("expected cached body after 304, got %q", body)
+	}
+
+	entry, ok := dc.Lookup("http://example.com/doc")
+	if !ok || !entry.Fresh() {
+		t.Error("expected entry to be fresh after revalidation")
+	}
+}
+
+func TestResponseProcessor_MarkdownCache(t *testing.T) {
+	tc, _ := tokens.NewCounter("cl100k_base")
+	dc, err := cache.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("cache.New: %v", err)
+	}
+	// JSON is not kept in the HTML layer, so a hit can only come from the
+	// Markdown layer.
+	upstream := &validatingTransport{
+		body:        `{"title":"Cached JSON"}`,
+		contentType: "application/json",
+		etag:        `"j1"`,
+		maxAge:      3600,
+	}
+	rp := &ResponseProcessor{ConvertJSON: true, TokenCounter: tc, Cache: dc, Inner: upstream}
+
+	var bodies, counts []string
+	for i, want := range []string{"MISS", "HIT"} {
+		req, _ := http.NewRequest("GET", "http://example.com/api", nil)
+		resp, err := rp.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("request %d: unexpected error: %v", i, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		bodies = append(bodies, string(body))
+		counts = append(counts, resp.Header.Get("X-Token-Count"))
+
+		if got := resp.Header.Get("X-Cache"); got != want {
+			t.Errorf("request %d: X-Cache = %q, want %q", i, got, want)
+		}
+		if !strings.Contains(resp.Header.Get("Content-Type"), "text/markdown") {
+			t.Errorf("request %d: expected text/markdown, got %q", i, resp.Header.Get("Content-Type"))
+		}
+	}
+
+	if upstream.calls != 1 {
+		t.Errorf("expected 1 upstream call, got %d", upstream.calls)
+	}
+	if bodies[0] != bodies[1] {
+		t.Errorf("cached body differs: %q vs %q", bodies[0], bodies[1])
+	}
+	if counts[0] != counts[1] {
+		t.Errorf("cached X-Token-Count differs: %q vs %q", counts[0], counts[1])
+	}
+}
+
+func TestResponseProcessor_MarkdownCache_Uncacheable(t *testing.T) {
+	dc, err := cache.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("cache.New: %v", err)
+	}
+	upstream := &validatingTransport{body: `{"title":"x"}`, contentType: "application/json", noStore: true}
+	rp := &ResponseProcessor{ConvertJSON: true, Cache: dc, Inner: upstream}
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("GET", "http://example.com/api", nil)
+		resp, err := rp.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+	}
+	if upstream.calls != 2 {
+		t.Errorf("expected 2 upstream calls for a no-store response, got %d", upstream.calls)
+	}
+}
+
+// languageTransport serves a greeting in the language named by the
+// request's Accept-Language header, with the given Vary header.
+type languageTransport struct {
+	vary  string
+	calls int
+}
+
+func (l *languageTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	l.calls++
+	body := map[string]string{"de": "<p>Hallo</p>", "fr": "<p>Bonjour</p>"}[req.Header.Get("Accept-Language")]
+	if body == "" {
+		body = "<p>Hello</p>"
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "text/html")
+	header.Set("Cache-Control", "max-age=3600")
+	header.Set("Vary", l.vary)
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}, nil
+}
+
+func TestResponseProcessor_CacheVary(t *testing.T) {
+	dc, err := cache.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("cache.New: %v", err)
+	}
+	upstream := &languageTransport{vary: "Accept-Language"}
+	rp := &ResponseProcessor{ConvertHTML: true, Cache: dc, Inner: upstream}
+
+	steps := []struct {
+		lang, cache, body string
+	}{
+		{"de", "MISS", "Hallo"},
+		{"fr", "MISS", "Bonjour"},
+		{"de", "HIT", "Hallo"},
+		{"fr", "HIT", "Bonjour"},
+	}
+	for i, step := range steps {
+		req, _ := http.NewRequest("GET", "http://example.com/docs", nil)
+		req.Header.Set("Accept-Language", step.lang)
+		resp, err := rp.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("request %d: unexpected error: %v", i, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if got := resp.Header.Get("X-Cache"); got != step.cache {
+			t.Errorf("request %d (%s): X-Cache = %q, want %q", i, step.lang, got, step.cache)
+		}
+		if !strings.Contains(string(body), step.body) {
+			t.Errorf("request %d (%s): body = %q, want %q", i, step.lang, body, step.body)
+		}
+	}
+	if upstream.calls != 2 {
+		t.Errorf("expected 2 upstream calls, got %d", upstream.calls)
+	}
+}
+
+func TestResponseProcessor_CacheVaryStar(t *testing.T) {
+	dc, err := cache.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("cache.New: %v", err)
+	}
+	upstream := &languageTransport{vary: "*"}
+	rp := &ResponseProcessor{ConvertHTML: true, Cache: dc, Inner: upstream}
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("GET", "http://example.com/docs", nil)
+		resp, err := rp.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+	}
+	if upstream.calls != 2 {
+		t.Errorf("expected Vary: * responses never to be cached, got %d upstream calls", upstream.calls)
+	}
+}
+
+func TestResponseProcessor_ClientNoCache(t *testing.T) {
+	dc, err := cache.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("cache.New: %v", err)
+	}
+	upstream := &validatingTransport{body: "<h1>Doc</h1>", etag: `"v1"`, maxAge: 3600}
+	rp := &ResponseProcessor{ConvertHTML: true, Cache: dc, Inner: upstream}
+
+	for i, want := range []string{"MISS", "REVALIDATED"} {
+		req, _ := http.NewRequest("GET", "http://example.com/doc", nil)
+		if i > 0 {
+			req.Header.Set("Cache-Control", "no-cache")
+		}
+		resp, err := rp.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("request %d: unexpected error: %v", i, err)
+		}
+		resp.Body.Close()
+		if got := resp.Header.Get("X-Cache"); got != want {
+			t.Errorf("request %d: X-Cache = %q, want %q", i, got, want)
+		}
+	}
+	if upstream.calls != 2 {
+		t.Errorf("expected no-cache to reach upstream, got %d calls", upstream.calls)
+	}
+}
+
+func TestResponseProcessor_ClientNoStore(t *testing.T) {
+	dc, err := cache.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("cache.New: %v", err)
+	}
+	upstream := &validatingTransport{body: "<h1>Doc</h1>", etag: `"v1"`, maxAge: 3600}
+	rp := &ResponseProcessor{ConvertHTML: true, Cache: dc, Inner: upstream}
+
+	req, _ := http.NewRequest("GET", "http://example.com/doc", nil)
+	req.Header.Set("Cache-Control", "no-store")
+	resp, err := rp.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if got := resp.Header.Get("X-Cache"); got != "" {
+		t.Errorf("X-Cache = %q, want none for a no-store request", got)
+	}
+	if _, ok := dc.Lookup("http://example.com/doc"); ok {
+		t.Error("no-store request must not populate the cache")
+	}
+}
+
+func TestResponseProcessor_OnlyIfCached(t *testing.T) {
+	dc, err := cache.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("cache.New: %v", err)
+	}
+	upstream := &validatingTransport{body: "<h1>Doc</h1>", maxAge: 3600}
+	rp := &ResponseProcessor{ConvertHTML: true, Cache: dc, Inner: upstream}
+
+	req, _ := http.NewRequest("GET", "http://example.com/doc", nil)
+	req.Header.Set("Cache-Control", "only-if-cached")
+	resp, err := rp.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("status = %d, want 504", resp.StatusCode)
+	}
+	if upstream.calls != 0 {
+		t.Errorf("expected no upstream calls, got %d", upstream.calls)
+	}
+}
+
+func TestResponseProcessor_StaleIfError(t *testing.T) {
+	dc, err := cache.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("cache.New: %v", err)
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "text/html")
+	header.Set("Cache-Control", "max-age=60, stale-if-error=3600")
+	stale := &http.Response{StatusCode: http.StatusOK, Header: header}
+	if err := dc.Store("http://example.com/doc", stale, []byte("<h1>Stale</h1>"), -time.Minute); err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+
+	upstream := &validatingTransport{body: "down", maxAge: 0, statusCode: http.StatusServiceUnavailable}
+	rp := &ResponseProcessor{ConvertHTML: true, Cache: dc, Inner: upstream}
+
+	req, _ := http.NewRequest("GET", "http://example.com/doc", nil)
+	resp, err := rp.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+	if got := resp.Header.Get("X-Cache"); got != "STALE" {
+		t.Errorf("X-Cache = %q, want STALE", got)
+	}
+	if !strings.HasPrefix(resp.Header.Get("Warning"), "111") {
+		t.Errorf("Warning = %q, want 111", resp.Header.Get("Warning"))
+	}
+	if !strings.Contains(string(body), "# Stale") {
+		t.Errorf("expected stale body, got %q", body)
+	}
+}
+
+// failingTransport fails every request, like an unreachable upstream.
+type failingTransport struct {
+	calls int
+}
+
+func (f *failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.calls++
+	return nil, errors.New("connection refused")
+}
+
+func TestResponseProcessor_ServeStaleOnError(t *testing.T) {
+	dc, err := cache.NewWithOptions(t.TempDir(), cache.Options{ServeStaleOnError: true})
+	if err != nil {
+		t.Fatalf("cache.NewWithOptions: %v", err)
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "text/html")
+	header.Set("ETag", `"v1"`)
+	stale := &http.Response{StatusCode: http.StatusOK, Header: header}
+	dc.Store("http://example.com/doc", stale, []byte("<h1>Stale</h1>"), -time.Hour)
+
+	rp := &ResponseProcessor{ConvertHTML: true, Cache: dc, Inner: &failingTransport{}}
+
+	req, _ := http.NewRequest("GET", "http://example.com/doc", nil)
+	resp, err := rp.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("expected stale response instead of error, got %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if got := resp.Header.Get("X-Cache"); got != "STALE" {
+		t.Errorf("X-Cache = %q, want STALE", got)
+	}
+	if resp.Header.Get("Warning") == "" {
+		t.Error("expected Warning header")
+	}
+	if !strings.Contains(string(body), "# Stale") {
+		t.Errorf("expected stale body, got %q", body)
+	}
+
+	// Without a cached copy the error still surfaces.
+	req, _ = http.NewRequest("GET", "http://example.com/other", nil)
+	if _, err := rp.RoundTrip(req); err == nil {
+		t.Error("expected error for an uncached URL")
+	}
+}
+
+func TestResponseProcessor_Offline(t *testing.T) {
+	dc, err := cache.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("cache.New: %v", err)
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "text/html")
+	dc.Store("http://example.com/fresh", &http.Response{StatusCode: http.StatusOK, Header: header}, []byte("<h1>Fresh</h1>"), time.Hour)
+	dc.Store("http://example.com/expired", &http.Response{StatusCode: http.StatusOK, Header: header}, []byte("<h1>Expired</h1>"), -time.Hour)
+
+	upstream := &failingTransport{}
+	rp := &ResponseProcessor{ConvertHTML: true, Cache: dc, Inner: upstream, Offline: true}
+
+	tests := []struct {
+		url    string
+		status int
+		cache  string
+		body   string
+	}{
+		{"http://example.com/fresh", http.StatusOK, "HIT", "# Fresh"},
+		{"http://example.com/expired", http.StatusOK, "STALE", "# Expired"},
+		{"http://example.com/missing", http.StatusGatewayTimeout, "MISS", "offline"},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", tt.url, nil)
+		resp, err := rp.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.url, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.url, resp.StatusCode, tt.status)
+		}
+		if got := resp.Header.Get("X-Cache"); got != tt.cache {
+			t.Errorf("%s: X-Cache = %q, want %q", tt.url, got, tt.cache)
+		}
+		if !strings.Contains(string(body), tt.body) {
+			t.Errorf("%s: body = %q, want %q", tt.url, body, tt.body)
+		}
+	}
+	if upstream.calls != 0 {
+		t.Errorf("offline mode made %d upstream calls", upstream.calls)
+	}
+}
+
+func TestResponseProcessor_MustRevalidateError(t *testing.T) {
+	dc, err := cache.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("cache.New: %v", err)
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "text/html")
+	header.Set("Cache-Control", "max-age=60, must-revalidate, stale-if-error=3600")
+	stale := &http.Response{StatusCode: http.StatusOK, Header: header}
+	dc.Store("http://example.com/doc", stale, []byte("<h1>Stale</h1>"), -time.Minute)
+
+	upstream := &validatingTransport{body: "down", maxAge: 0, statusCode: http.StatusServiceUnavailable}
+	rp := &ResponseProcessor{ConvertHTML: true, Cache: dc, Inner: upstream}
+
+	req, _ := http.NewRequest("GET", "http://example.com/doc", nil)
+	resp, err := rp.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503 for a must-revalidate entry", resp.StatusCode)
+	}
+}
+
 func BenchmarkResponseProcessor_HTMLToMarkdown(b *testing.B) {
 	tc, _ := tokens.NewCounter("cl100k_base")
 
@@ -414,3 +934,789 @@ func BenchmarkResponseProcessor_HTMLToMarkdown(b *testing.B) {
 		resp.Body.Close()
 	}
 }
+
+func TestResponseProcessor_ExtractArticle(t *testing.T) {
+	tc, _ := tokens.NewCounter("cl100k_base")
+
+	page := `<html><body><nav><a href="/">Home</a> <a href="/pricing">Pricing</a></nav>
+<article><h1>Release notes</h1>
+<p>This release improves startup time, reduces memory use, and fixes several crashes.</p>
+<p>Upgrading is recommended for everyone, and no configuration changes are required.</p></article>
+</body></html>`
+	rp := &ResponseProcessor{
+		ConvertHTML:  true,
+		Extract:      "article",
+		TokenCounter: tc,
+		Inner:        &mockTransport{statusCode: 200, contentType: "text/html", body: page},
+	}
+
+	req, _ := http.NewRequest("GET", "http://example.com/notes", nil)
+	resp, err := rp.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), "# Release notes") || strings.Contains(string(body), "Pricing") {
+		t.Errorf("expected only the article, got %q", body)
+	}
+	if tc != nil {
+		article, _ := strconv.Atoi(resp.Header.Get("X-Token-Count"))
+		full, _ := strconv.Atoi(resp.Header.Get("X-Token-Count-Full"))
+		if article <= 0 || full <= article {
+			t.Errorf("X-Token-Count = %d, X-Token-Count-Full = %d, want 0 < article < full", article, full)
+		}
+	}
+
+	// Clients can ask for the whole page.
+	req, _ = http.NewRequest("GET", "http://example.com/notes", nil)
+	req.Header.Set("X-Extract", "full")
+	resp, err = rp.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), "Pricing") {
+		t.Errorf("expected the full page with X-Extract: full, got %q", body)
+	}
+	if resp.Header.Get("X-Token-Count-Full") != "" {
+		t.Error("expected no X-Token-Count-Full for a full-page conversion")
+	}
+}
+
+func TestResponseProcessor_ExtractCache(t *testing.T) {
+	dc, _ := cache.New(t.TempDir())
+	upstream := &validatingTransport{
+		body:   `<html><body><nav><a href="/">Home</a></nav><article><p>The article body, long enough, with commas, to be picked as the main content.</p></article></body></html>`,
+		maxAge: 60,
+	}
+	rp := &ResponseProcessor{ConvertHTML: true, Cache: dc, Inner: upstream}
+
+	fetch := func(extract string) string {
+		req, _ := http.NewRequest("GET", "http://example.com/extract", nil)
+		req.Header.Set("X-Extract", extract)
+		resp, err := rp.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	article := fetch("article")
+	full := fetch("full")
+	if article == full || strings.Contains(article, "Home") || !strings.Contains(full, "Home") {
+		t.Errorf("expected distinct conversions per extraction mode, got %q and %q", article, full)
+	}
+	if again := fetch("article"); again != article {
+		t.Errorf("cached article = %q, want %q", again, article)
+	}
+	if upstream.calls != 1 {
+		t.Errorf("expected 1 upstream call, got %d", upstream.calls)
+	}
+}
+
+const metadataPage = `<html lang="en"><head><title>Release notes</title>
+<meta name="description" content="What changed in this release.">
+<link rel="canonical" href="https://example.com/notes"></head>
+<body><h1>Release notes</h1><p>Faster startup.</p></body></html>`
+
+func TestResponseProcessor_FrontMatter(t *testing.T) {
+	dir := t.TempDir()
+	ow, _ := output.New(dir)
+	rp := &ResponseProcessor{
+		ConvertHTML:       true,
+		FrontMatter:       true,
+		OutputWriter:      ow,
+		OutputFrontMatter: true,
+		Inner:             &mockTransport{statusCode: 200, contentType: "text/html", body: metadataPage},
+	}
+
+	req, _ := http.NewRequest("GET", "http://example.com/notes", nil)
+	resp, err := rp.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	md := string(body)
+	if !strings.HasPrefix(md, "---\n") {
+		t.Fatalf("expected front matter, got %q", md)
+	}
+	for _, want := range []string{
+		"title: Release notes\n",
+		"description: What changed in this release.\n",
+		"canonical: https://example.com/notes\n",
+		"language: en\n",
+		"source: http://example.com/notes\n",
+		"fetched_at: ",
+		"status: 200\n",
+		"---\n\n# Release notes",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("expected response to contain %q, got:\n%s", want, md)
+		}
+	}
+
+	file, err := os.ReadFile(filepath.Join(dir, "example.com__notes.md"))
+	if err != nil {
+		t.Fatalf("reading output file: %v", err)
+	}
+	if !strings.HasPrefix(string(file), "---\n") {
+		t.Errorf("expected front matter in output file, got %q", file)
+	}
+}
+
+func TestResponseProcessor_FrontMatterOutputOnly(t *testing.T) {
+	dir := t.TempDir()
+	ow, _ := output.New(dir)
+	rp := &ResponseProcessor{
+		ConvertHTML:       true,
+		OutputWriter:      ow,
+		OutputFrontMatter: true,
+		Inner:             &mockTransport{statusCode: 200, contentType: "text/html", body: metadataPage},
+	}
+
+	req, _ := http.NewRequest("GET", "http://example.com/notes", nil)
+	resp, err := rp.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if strings.HasPrefix(string(body), "---") {
+		t.Errorf("expected no front matter on the response, got %q", body)
+	}
+
+	file, _ := os.ReadFile(filepath.Join(dir, "example.com__notes.md"))
+	if !strings.Contains(string(file), "title: Release notes\n") {
+		t.Errorf("expected front matter in output file, got %q", file)
+	}
+}
+
+func TestResponseProcessor_AbsoluteLinks(t *testing.T) {
+	rp := &ResponseProcessor{
+		ConvertHTML: true,
+		Inner: &mockTransport{
+			statusCode:  200,
+			contentType: "text/html",
+			body:        `<p><a href="../setup">Setup</a> <img src="/img/a.png" alt="A"></p>`,
+		},
+	}
+
+	req, _ := http.NewRequest("GET", "https://example.com/docs/guide/intro", nil)
+	resp, err := rp.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	for _, want := range []string{"[Setup](https://example.com/docs/setup)", "![A](https://example.com/img/a.png)"} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("expected %q in %q", want, body)
+		}
+	}
+}
+
+func TestResponseProcessor_Charset(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		convertJSON bool
+		want        string
+	}{
+		{
+			name:        "shift_jis meta",
+			contentType: "text/html",
+			body:        `<html><head><meta charset="Shift_JIS"></head><body><h1>` + "\x93\xfa\x96\x7b" + `</h1></body></html>`,
+			want:        "# 日本",
+		},
+		{
+			name:        "gbk header",
+			contentType: "text/html; charset=GBK",
+			body:        "<p>\xd6\xd0\xce\xc4</p>",
+			want:        "中文",
+		},
+		{
+			name:        "latin1 json",
+			contentType: "application/json; charset=iso-8859-1",
+			body:        "{\"city\":\"Z\xfcrich\"}",
+			convertJSON: true,
+			want:        "Zürich",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp := &ResponseProcessor{
+				ConvertHTML: true,
+				ConvertJSON: tt.convertJSON,
+				Inner:       &mockTransport{statusCode: 200, contentType: tt.contentType, body: tt.body},
+			}
+			req, _ := http.NewRequest("GET", "http://example.com/", nil)
+			resp, err := rp.RoundTrip(req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			if !strings.Contains(string(body), tt.want) {
+				t.Errorf("expected %q in %q", tt.want, body)
+			}
+			if ct := resp.Header.Get("Content-Type"); ct != "text/markdown; charset=utf-8" {
+				t.Errorf("Content-Type = %q, want text/markdown; charset=utf-8", ct)
+			}
+		})
+	}
+}
+
+func TestResponseProcessor_SelectorRules(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "docs.example.com.yml"), []byte("include: main\nexclude: .ad\n"), 0644)
+	store, err := rules.New(dir)
+	if err != nil {
+		t.Fatalf("loading rules: %v", err)
+	}
+
+	page := `<html><body><nav>Menu</nav><main><h1>Guide</h1><p>Steps.</p><div class="ad">Buy now</div></main></body></html>`
+	rp := &ResponseProcessor{
+		ConvertHTML: true,
+		RuleStore:   store,
+		Inner:       &mockTransport{statusCode: 200, contentType: "text/html", body: page},
+	}
+
+	fetch := func(rawURL string) string {
+		req, _ := http.NewRequest("GET", rawURL, nil)
+		resp, err := rp.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	md := fetch("https://docs.example.com/guide")
+	if !strings.Contains(md, "# Guide") || strings.Contains(md, "Menu") || strings.Contains(md, "Buy now") {
+		t.Errorf("expected the rule to apply, got %q", md)
+	}
+	if md := fetch("https://other.org/guide"); !strings.Contains(md, "Menu") {
+		t.Errorf("expected no rule for other hosts, got %q", md)
+	}
+}
+
+func TestResponseProcessor_MarkdownStyle(t *testing.T) {
+	dc, _ := cache.New(t.TempDir())
+	upstream := &validatingTransport{
+		body:   `<html><body><h1>Guide</h1><ul><li>one</li></ul><p><a href="/setup">Setup</a> <img src="/a.png" alt="A"></p></body></html>`,
+		maxAge: 60,
+	}
+	rp := &ResponseProcessor{
+		ConvertHTML: true,
+		Markdown:    converter.MarkdownOptions{Bullet: "*"},
+		Cache:       dc,
+		Inner:       upstream,
+	}
+
+	fetch := func(headers map[string]string) string {
+		req, _ := http.NewRequest("GET", "http://example.com/style", nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := rp.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	configured := fetch(nil)
+	if !strings.Contains(configured, "* one") || !strings.Contains(configured, "[Setup](http://example.com/setup)") {
+		t.Errorf("expected the configured style, got %q", configured)
+	}
+
+	styled := fetch(map[string]string{
+		"X-Markdown-Heading-Style": "setext",
+		"X-Markdown-Link-Style":    "reference",
+		"X-Markdown-Bullet":        "+",
+		"X-Markdown-Drop-Images":   "true",
+	})
+	for _, want := range []string{"Guide\n=====", "+ one", "[Setup][1]", "[1]: http://example.com/setup"} {
+		if !strings.Contains(styled, want) {
+			t.Errorf("expected %q in %q", want, styled)
+		}
+	}
+	if strings.Contains(styled, "![A]") {
+		t.Errorf("expected images to be dropped, got %q", styled)
+	}
+
+	if invalid := fetch(map[string]string{"X-Markdown-Bullet": "1."}); invalid != configured {
+		t.Errorf("expected an invalid header to be ignored, got %q", invalid)
+	}
+	if upstream.calls != 1 {
+		t.Errorf("expected 1 upstream call, got %d", upstream.calls)
+	}
+}
+
+func TestResponseProcessor_Registry(t *testing.T) {
+	csv := &converter.Converter{
+		Format:     "csv",
+		MediaTypes: []string{"text/csv"},
+		Convert: func(in converter.Input) (string, error) {
+			return "| " + strings.ReplaceAll(strings.TrimSpace(string(in.Body)), ",", " | ") + " |", nil
+		},
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		registry    *converter.Registry
+		want        string
+	}{
+		{
+			name:        "xhtml",
+			contentType: "application/xhtml+xml; charset=utf-8",
+			body:        `<html xmlns="http://www.w3.org/1999/xhtml"><body><h1>Title</h1></body></html>`,
+			want:        "# Title",
+		},
+		{
+			name:        "json suffix",
+			contentType: "application/ld+json",
+			body:        `{"name":"Widget"}`,
+			want:        "## name",
+		},
+		{
+			name:        "registered converter",
+			contentType: "text/csv",
+			body:        "a,b\n",
+			registry:    converter.NewRegistry(converter.HTMLConverter, csv),
+			want:        "| a | b |",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp := &ResponseProcessor{
+				ConvertHTML: true,
+				ConvertJSON: true,
+				Registry:    tt.registry,
+				Inner:       &mockTransport{statusCode: 200, contentType: tt.contentType, body: tt.body},
+			}
+			req, _ := http.NewRequest("GET", "http://example.com/doc", nil)
+			resp, err := rp.RoundTrip(req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+
+			if !strings.Contains(string(body), tt.want) {
+				t.Errorf("expected %q in %q", tt.want, body)
+			}
+			if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/markdown") {
+				t.Errorf("Content-Type = %q, want text/markdown", ct)
+			}
+		})
+	}
+}
+
+func TestResponseProcessor_Feed(t *testing.T) {
+	feed := `<?xml version="1.0"?><rss version="2.0"><channel><title>Releases</title>
+<item><title>v2</title><link>/releases/v2</link><pubDate>Wed, 01 May 2024 08:00:00 GMT</pubDate><description>&lt;p&gt;New &lt;b&gt;API&lt;/b&gt;.&lt;/p&gt;</description></item>
+<item><title>v1</title><link>/releases/v1</link></item>
+</channel></rss>`
+	rp := &ResponseProcessor{
+		ConvertHTML:    true,
+		MaxFeedEntries: 1,
+		Inner:          &mockTransport{statusCode: 200, contentType: "application/rss+xml; charset=utf-8", body: feed},
+	}
+
+	req, _ := http.NewRequest("GET", "https://example.com/feed.xml", nil)
+	resp, err := rp.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	md := string(body)
+
+	for _, want := range []string{"# Releases", "## [v2](https://example.com/releases/v2)", "Published: 2024-05-01T08:00:00Z", "New **API**."} {
+		if !strings.Contains(md, want) {
+			t.Errorf("expected %q in %q", want, md)
+		}
+	}
+	if strings.Contains(md, "## [v1]") {
+		t.Errorf("expected entries beyond MaxFeedEntries to be left out, got %q", md)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/markdown") {
+		t.Errorf("Content-Type = %q, want text/markdown", ct)
+	}
+}
+
+func TestResponseProcessor_NonFeedXML(t *testing.T) {
+	sitemap := `<?xml version="1.0"?><urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9"><url><loc>https://example.com/</loc></url></urlset>`
+	rp := &ResponseProcessor{
+		ConvertHTML: true,
+		Inner:       &mockTransport{statusCode: 200, contentType: "application/xml", body: sitemap},
+	}
+
+	req, _ := http.NewRequest("GET", "https://example.com/sitemap.xml", nil)
+	resp, err := rp.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if string(body) != sitemap {
+		t.Errorf("body = %q, want the sitemap unchanged", body)
+	}
+	if got := resp.Header.Get("X-Conversion-Error"); got != "" {
+		t.Errorf("X-Conversion-Error = %q, want none for XML that is not a feed", got)
+	}
+}
+
+// testPDF returns a one-page PDF showing each line of text on its own
+// line, the first set as a heading.
+func testPDF(lines ...string) string {
+	var content strings.Builder
+	for i, line := range lines {
+		size := 11
+		if i == 0 {
+			size = 20
+		}
+		fmt.Fprintf(&content, "BT /F1 %d Tf 72 %d Td (%s) Tj ET\n", size, 740-30*i, line)
+	}
+	objs := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 4 0 R >> >> /Contents 5 0 R >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+	}
+	var b strings.Builder
+	b.WriteString("%PDF-1.4\n")
+	var xref strings.Builder
+	for i, obj := range objs {
+		fmt.Fprintf(&xref, "%010d 00000 n \n", b.Len())
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	start := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n%strailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+		len(objs)+1, xref.String(), len(objs)+1, start)
+	return b.String()
+}
+
+func TestResponseProcessor_PDF(t *testing.T) {
+	doc := testPDF("Spec", "The first paragraph.")
+	rp := &ResponseProcessor{
+		ConvertHTML: true,
+		Inner:       &mockTransport{statusCode: 200, contentType: "application/pdf", body: doc},
+	}
+
+	req, _ := http.NewRequest("GET", "https://example.com/spec.pdf", nil)
+	resp, err := rp.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if want := "# Spec\n\nThe first paragraph."; string(body) != want {
+		t.Errorf("body = %q, want %q", body, want)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/markdown") {
+		t.Errorf("Content-Type = %q, want text/markdown", ct)
+	}
+	if msg := resp.Header.Get("X-Conversion-Error"); msg != "" {
+		t.Errorf("unexpected X-Conversion-Error %q", msg)
+	}
+}
+
+func TestResponseProcessor_PDFNotConverted(t *testing.T) {
+	doc := testPDF("Spec", "The first paragraph.")
+	tests := []struct {
+		name    string
+		body    string
+		maxSize int64
+		wantErr string
+	}{
+		{"too large", doc, int64(len(doc) - 1), "body exceeds the " + strconv.Itoa(len(doc)-1) + " byte limit"},
+		{"malformed", "%PDF-1.4\ngarbage", 0, "reading PDF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp := &ResponseProcessor{
+				ConvertHTML: true,
+				MaxBodySize: tt.maxSize,
+				Inner:       &mockTransport{statusCode: 200, contentType: "application/pdf", body: tt.body},
+			}
+
+			req, _ := http.NewRequest("GET", "https://example.com/spec.pdf", nil)
+			resp, err := rp.RoundTrip(req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+
+			if string(body) != tt.body {
+				t.Errorf("expected the original PDF, got %q", body)
+			}
+			if ct := resp.Header.Get("Content-Type"); ct != "application/pdf" {
+				t.Errorf("Content-Type = %q, want application/pdf", ct)
+			}
+			if msg := resp.Header.Get("X-Conversion-Error"); !strings.Contains(msg, tt.wantErr) {
+				t.Errorf("X-Conversion-Error = %q, want it to contain %q", msg, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestResponseProcessor_DOCX(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create("word/document.xml")
+	w.Write([]byte(`<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>
+<w:p><w:pPr><w:pStyle w:val="Heading1"/></w:pPr><w:r><w:t>Notes</w:t></w:r></w:p>
+<w:p><w:r><w:t>Meeting moved to Friday.</w:t></w:r></w:p>
+</w:body></w:document>`))
+	zw.Close()
+
+	rp := &ResponseProcessor{
+		ConvertHTML: true,
+		Inner: &mockTransport{
+			statusCode:  200,
+			contentType: "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+			body:        buf.String(),
+		},
+	}
+
+	req, _ := http.NewRequest("GET", "https://example.com/notes.docx", nil)
+	resp, err := rp.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if want := "# Notes\n\nMeeting moved to Friday."; string(body) != want {
+		t.Errorf("body = %q, want %q", body, want)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/markdown") {
+		t.Errorf("Content-Type = %q, want text/markdown", ct)
+	}
+}
+
+func TestResponseProcessor_StructuredData(t *testing.T) {
+	dc, err := cache.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("cache.New: %v", err)
+	}
+	upstream := &validatingTransport{
+		body: `<html><head><meta property="og:title" content="Widget">
+<script type="application/ld+json">{"@type": "Product", "sku": "W-1", "offers": {"price": "9.50"}}</script>
+</head><body><h1>Widget</h1></body></html>`,
+		etag:   `"w1"`,
+		maxAge: 3600,
+	}
+	rp := &ResponseProcessor{ConvertHTML: true, StructuredData: true, Cache: dc, Inner: upstream}
+
+	for i, want := range []string{"MISS", "HIT"} {
+		req, _ := http.NewRequest("GET", "http://example.com/widget", nil)
+		resp, err := rp.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("request %d: unexpected error: %v", i, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if got := resp.Header.Get("X-Cache"); got != want {
+			t.Errorf("request %d: X-Cache = %q, want %q", i, got, want)
+		}
+		if !strings.HasPrefix(string(body), "# Widget\n\n## Structured data\n\n```json\n") || !strings.Contains(string(body), `"sku": "W-1"`) {
+			t.Errorf("request %d: expected a structured data appendix, got %q", i, body)
+		}
+		var data converter.StructuredData
+		if err := json.Unmarshal([]byte(resp.Header.Get("X-Structured-Data")), &data); err != nil {
+			t.Fatalf("request %d: X-Structured-Data is not JSON: %v", i, err)
+		}
+		if data.OpenGraph["og:title"] != "Widget" || len(data.JSONLD) != 1 {
+			t.Errorf("request %d: unexpected structured data %+v", i, data)
+		}
+	}
+	if upstream.calls != 1 {
+		t.Errorf("expected 1 upstream call, got %d", upstream.calls)
+	}
+}
+
+func TestResponseProcessor_StructuredDataOff(t *testing.T) {
+	rp := &ResponseProcessor{
+		ConvertHTML: true,
+		Inner: &mockTransport{statusCode: 200, contentType: "text/html",
+			body: `<head><meta property="og:title" content="Widget"></head><h1>Widget</h1>`},
+	}
+	req, _ := http.NewRequest("GET", "http://example.com/widget", nil)
+	resp, err := rp.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if string(body) != "# Widget" {
+		t.Errorf("expected no appendix, got %q", body)
+	}
+	if got := resp.Header.Get("X-Structured-Data"); got != "" {
+		t.Errorf("expected no X-Structured-Data header, got %q", got)
+	}
+}
+
+func TestResponseProcessor_Compact(t *testing.T) {
+	tc, _ := tokens.NewCounter("cl100k_base")
+
+	dc, err := cache.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("cache.New: %v", err)
+	}
+	upstream := &validatingTransport{
+		body: `<html><body><h1>Chart</h1><p><img src="data:image/png;base64,` + strings.Repeat("iVBO", 500) + `" alt="Sales">
+<a href="https://example.com/report?utm_source=mail&amp;id=7">Report</a></p></body></html>`,
+		etag:   `"c1"`,
+		maxAge: 3600,
+	}
+	rp := &ResponseProcessor{ConvertHTML: true, Compact: true, TokenCounter: tc, Cache: dc, Inner: upstream}
+
+	get := func(compact string) (*http.Response, string) {
+		t.Helper()
+		req, _ := http.NewRequest("GET", "http://example.com/chart", nil)
+		if compact != "" {
+			req.Header.Set("X-Compact", compact)
+		}
+		resp, err := rp.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	resp, compacted := get("")
+	if want := "# Chart\n\nSales [Report](https://example.com/report?id=7)"; compacted != want {
+		t.Errorf("compacted body = %q, want %q", compacted, want)
+	}
+	if tc != nil {
+		if got, want := resp.Header.Get("X-Token-Count"), strconv.Itoa(tc.Count(compacted)); got != want {
+			t.Errorf("X-Token-Count = %q, want the compacted count %q", got, want)
+		}
+	}
+
+	// The header turns compaction off, and the full conversion is cached
+	// separately.
+	for i, want := range []string{"HIT", "HIT"} {
+		resp, full := get("false")
+		if !strings.Contains(full, "data:image/png") || !strings.Contains(full, "utm_source") {
+			t.Errorf("request %d: expected the uncompacted Markdown, got %q", i, full)
+		}
+		if got := resp.Header.Get("X-Cache"); got != want {
+			t.Errorf("request %d: X-Cache = %q, want %q", i, got, want)
+		}
+	}
+	if _, again := get(""); again != compacted {
+		t.Errorf("cached compacted body = %q, want %q", again, compacted)
+	}
+	if upstream.calls != 1 {
+		t.Errorf("expected 1 upstream call, got %d", upstream.calls)
+	}
+}
+
+func TestResponseProcessor_TokenWindow(t *testing.T) {
+	tc, _ := tokens.NewCounter("cl100k_base")
+
+	upstream := &validatingTransport{
+		body:   `<html><body><h1>Guide</h1><p>First paragraph of the guide.</p><h2>Usage</h2><p>Second paragraph of the guide.</p></body></html>`,
+		etag:   `"w1"`,
+		maxAge: 3600,
+	}
+	rp := &ResponseProcessor{ConvertHTML: true, TokenCounter: tc, Inner: upstream}
+
+	get := func(offset, max string) (*http.Response, string) {
+		t.Helper()
+		req, _ := http.NewRequest("GET", "http://example.com/guide", nil)
+		req.Header.Set("X-Token-Offset", offset)
+		req.Header.Set("X-Max-Tokens", max)
+		resp, err := rp.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	full := "# Guide\n\nFirst paragraph of the guide.\n\n## Usage\n\nSecond paragraph of the guide."
+	if tc == nil {
+		// Without a token counter the headers are ignored.
+		resp, body := get("0", "5")
+		if body != full || resp.Header.Get("X-Token-Total") != "" {
+			t.Errorf("expected the whole document, got %q", body)
+		}
+		return
+	}
+
+	max := tc.Count("# Guide\n\nFirst paragraph of the guide.\n\n")
+	resp, first := get("", strconv.Itoa(max))
+	if want := "# Guide\n\nFirst paragraph of the guide."; first != want {
+		t.Errorf("first window = %q, want %q", first, want)
+	}
+	if got, want := resp.Header.Get("X-Token-Total"), strconv.Itoa(tc.Count(full)); got != want {
+		t.Errorf("X-Token-Total = %q, want %q", got, want)
+	}
+	if got, want := resp.Header.Get("X-Token-Count"), strconv.Itoa(tc.Count(first)); got != want {
+		t.Errorf("X-Token-Count = %q, want %q", got, want)
+	}
+	if got := resp.Header.Get("Vary"); got != markdownVaryHeader {
+		t.Errorf("Vary = %q", got)
+	}
+
+	resp, rest := get(resp.Header.Get("X-Next-Token-Offset"), "")
+	if want := "## Usage\n\nSecond paragraph of the guide."; rest != want {
+		t.Errorf("last window = %q, want %q", rest, want)
+	}
+	if got := resp.Header.Get("X-Next-Token-Offset"); got != "" {
+		t.Errorf("X-Next-Token-Offset = %q on the last window", got)
+	}
+}
+
+// markdownVaryHeader is the Vary header of a converted response whose
+// upstream sent none.
+const markdownVaryHeader = "accept, x-max-tokens, x-token-offset, x-extract, x-compact, x-markdown-heading-style, x-markdown-link-style, x-markdown-bullet, x-markdown-drop-images, x-markdown-raw-tables"
+
+func TestAddVary(t *testing.T) {
+	tests := []struct {
+		upstream []string
+		want     string
+	}{
+		{nil, "accept, x-max-tokens, x-token-offset"},
+		{[]string{"Accept-Language"}, "Accept-Language, accept, x-max-tokens, x-token-offset"},
+		{[]string{"Accept, Cookie", "X-Token-Offset"}, "Accept, Cookie, X-Token-Offset, x-max-tokens"},
+		{[]string{"*"}, "*"},
+	}
+	for _, tt := range tests {
+		h := http.Header{"Vary": tt.upstream}
+		addVary(h, "accept", "x-max-tokens", "x-token-offset")
+		if got := strings.Join(h.Values("Vary"), ", "); got != tt.want {
+			t.Errorf("addVary(%q) = %q, want %q", tt.upstream, got, tt.want)
+		}
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+
+	"github.com/rickcrawford/markdowninthemiddle/internal/fsutil"
 )
 
 // Writer writes converted Markdown files to a directory.
@@ -85,5 +87,7 @@ func (w *Writer) Write(rawURL string, markdown []byte) error {
 	}
 	filename := SafeFilename(rawURL)
 	path := filepath.Join(w.dir, filename)
-	return os.WriteFile(path, markdown, 0o644)
+	// Write atomically so readers and concurrent writers never see a
+	// truncated file.
+	return fsutil.WriteFileAtomic(path, markdown, 0o644)
 }
@@ -15,10 +15,12 @@ import (
 	"golang.org/x/net/http/httpproxy"
 
 	"github.com/rickcrawford/markdowninthemiddle/internal/cache"
+	"github.com/rickcrawford/markdowninthemiddle/internal/converter"
 	"github.com/rickcrawford/markdowninthemiddle/internal/filter"
 	"github.com/rickcrawford/markdowninthemiddle/internal/middleware"
 	"github.com/rickcrawford/markdowninthemiddle/internal/mitm"
 	"github.com/rickcrawford/markdowninthemiddle/internal/output"
+	"github.com/rickcrawford/markdowninthemiddle/internal/rules"
 	"github.com/rickcrawford/markdowninthemiddle/internal/templates"
 	"github.com/rickcrawford/markdowninthemiddle/internal/tokens"
 )
@@ -31,20 +33,35 @@ type Options struct {
 
 	TLSConfig *tls.Config
 
-	ConvertHTML   bool
-	ConvertJSON   bool
-	NegotiateOnly bool
-	MaxBodySize   int64
-	TLSInsecure   bool
+	ConvertHTML    bool
+	ConvertJSON    bool
+	NegotiateOnly  bool
+	Extract        string // "full" or "article"
+	Markdown       converter.MarkdownOptions
+	MaxFeedEntries int  // entries rendered per feed, 0 = all
+	StructuredData bool // append page structured data, set X-Structured-Data
+	Compact        bool // compact converted Markdown; X-Compact overrides
+	MaxBodySize    int64
+	TLSInsecure    bool
 
 	TokenCounter  *tokens.Counter
 	Cache         *cache.DiskCache
 	OutputWriter  *output.Writer
 	TemplateStore *templates.Store
-	Filter        *filter.Filter
-	Transport     http.RoundTripper
-	TransportType string // "http" or "chrome"
-	MITM          *mitm.Manager
+	RuleStore     *rules.Store
+	// FrontMatter prepends YAML front matter to converted responses;
+	// OutputFrontMatter does the same for OutputWriter files.
+	FrontMatter       bool
+	OutputFrontMatter bool
+	Filter            *filter.Filter
+	Transport         http.RoundTripper
+	TransportType     string // "http" or "chrome"
+	MITM              *mitm.Manager
+	// Offline answers requests from Cache only and refuses plain CONNECT
+	// tunnels, which would reach the network directly.
+	Offline bool
+	// Coalesce shares one upstream fetch among concurrent identical requests.
+	Coalesce bool
 }
 
 // New creates an *http.Server configured as a forward proxy.
@@ -89,16 +106,26 @@ func New(opts Options) *http.Server {
 
 	// The response-processing transport wraps the selected transport.
 	transport := &middleware.ResponseProcessor{
-		MaxBodySize:   opts.MaxBodySize,
-		ConvertHTML:   opts.ConvertHTML,
-		ConvertJSON:   opts.ConvertJSON,
-		NegotiateOnly: opts.NegotiateOnly,
-		TokenCounter:  opts.TokenCounter,
-		Cache:         opts.Cache,
-		OutputWriter:  opts.OutputWriter,
-		TemplateStore: opts.TemplateStore,
-		Inner:         innerTransport,
-		TransportType: opts.TransportType,
+		MaxBodySize:       opts.MaxBodySize,
+		ConvertHTML:       opts.ConvertHTML,
+		ConvertJSON:       opts.ConvertJSON,
+		NegotiateOnly:     opts.NegotiateOnly,
+		Extract:           opts.Extract,
+		Markdown:          opts.Markdown,
+		MaxFeedEntries:    opts.MaxFeedEntries,
+		TokenCounter:      opts.TokenCounter,
+		Cache:             opts.Cache,
+		OutputWriter:      opts.OutputWriter,
+		FrontMatter:       opts.FrontMatter,
+		OutputFrontMatter: opts.OutputFrontMatter,
+		StructuredData:    opts.StructuredData,
+		Compact:           opts.Compact,
+		TemplateStore:     opts.TemplateStore,
+		RuleStore:         opts.RuleStore,
+		Inner:             innerTransport,
+		TransportType:     opts.TransportType,
+		Offline:           opts.Offline,
+		Coalesce:          opts.Coalesce,
 	}
 
 	// CONNECT handler for HTTPS tunneling.
@@ -106,6 +133,8 @@ func New(opts Options) *http.Server {
 		if r.Method == http.MethodConnect {
 			if opts.MITM != nil {
 				handleConnectMITM(w, r, opts.MITM, transport)
+			} else if opts.Offline {
+				http.Error(w, "offline: HTTPS tunnels require MITM to be answered from cache", http.StatusGatewayTimeout)
 			} else {
 				handleConnect(w, r)
 			}
@@ -0,0 +1,104 @@
+package rules
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+
+	"github.com/rickcrawford/markdowninthemiddle/internal/converter"
+	"github.com/rickcrawford/markdowninthemiddle/internal/templates"
+)
+
+// Rule is the content of a rules file: CSS selectors for the elements to
+// keep and the elements to drop before conversion.
+type Rule struct {
+	Include string `yaml:"include"`
+	Exclude string `yaml:"exclude"`
+}
+
+// Store holds compiled selector rules keyed by URL patterns, matched the
+// same way as templates.Store.
+type Store struct {
+	// rules maps URL patterns to compiled selectors.
+	rules map[string]*converter.Selectors
+	// defaultRule is used when no pattern matches (from _default.yml).
+	defaultRule *converter.Selectors
+}
+
+// New loads selector rules from a directory. Each .yml or .yaml file's name
+// (without extension) is treated as a URL pattern where "__" is replaced by
+// "/", as for templates. A file named _default.yml applies to unmatched URLs.
+func New(dir string) (*Store, error) {
+	s := &Store{
+		rules: make(map[string]*converter.Selectors),
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		ext := filepath.Ext(name)
+		if ext != ".yml" && ext != ".yaml" {
+			continue
+		}
+
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		var rule Rule
+		if err := yaml.Unmarshal(content, &rule); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", name, err)
+		}
+		sel, err := converter.CompileSelectors(rule.Include, rule.Exclude)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		base := strings.TrimSuffix(name, ext)
+		if base == "_default" {
+			s.defaultRule = sel
+			continue
+		}
+
+		// Convert filename to URL pattern: "__" → "/"
+		pattern := strings.ReplaceAll(base, "__", "/")
+		s.rules[pattern] = sel
+	}
+
+	return s, nil
+}
+
+// Match returns the selectors for the best-matching URL pattern, the
+// default rule if none matches, or nil.
+func (s *Store) Match(rawURL string) *converter.Selectors {
+	if s == nil {
+		return nil
+	}
+	if pattern, ok := templates.MatchPattern(maps.Keys(s.rules), rawURL); ok {
+		return s.rules[pattern]
+	}
+	return s.defaultRule
+}
+
+// Len returns the number of rules loaded, including the default rule.
+func (s *Store) Len() int {
+	if s == nil {
+		return 0
+	}
+	n := len(s.rules)
+	if s.defaultRule != nil {
+		n++
+	}
+	return n
+}
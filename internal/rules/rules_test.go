@@ -0,0 +1,61 @@
+package rules
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNew_LoadsRules(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "docs.example.com__guide.yml"), []byte("include: main article\nexclude: .sidebar, nav, .ad\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "docs.example.com.yaml"), []byte("exclude: footer\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "_default.yml"), []byte("exclude: .cookie-banner\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "readme.txt"), []byte("not a rule"), 0644)
+
+	store, err := New(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if store.Len() != 3 {
+		t.Errorf("Len() = %d, want 3", store.Len())
+	}
+
+	tests := []struct {
+		url         string
+		wantInclude string
+		wantExclude string
+	}{
+		{"https://docs.example.com/guide/setup", "main article", ".sidebar, nav, .ad"},
+		{"https://docs.example.com/api", "", "footer"},
+		{"https://other.org/", "", ".cookie-banner"},
+	}
+	for _, tt := range tests {
+		sel := store.Match(tt.url)
+		if sel == nil {
+			t.Errorf("Match(%q) = nil", tt.url)
+			continue
+		}
+		if sel.Include != tt.wantInclude || sel.Exclude != tt.wantExclude {
+			t.Errorf("Match(%q) = %q / %q, want %q / %q", tt.url, sel.Include, sel.Exclude, tt.wantInclude, tt.wantExclude)
+		}
+	}
+}
+
+func TestNew_InvalidSelector(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "example.com.yml"), []byte("include: \"main >\"\n"), 0644)
+
+	_, err := New(dir)
+	if err == nil || !strings.Contains(err.Error(), "example.com.yml") {
+		t.Errorf("expected an error naming the file, got %v", err)
+	}
+}
+
+func TestStore_NilMatch(t *testing.T) {
+	var store *Store
+	if sel := store.Match("https://example.com/"); sel != nil {
+		t.Errorf("expected nil selectors from a nil store, got %+v", sel)
+	}
+}
@@ -1,6 +1,8 @@
 package templates
 
 import (
+	"iter"
+	"maps"
 	"os"
 	"path/filepath"
 	"strings"
@@ -65,36 +67,60 @@ func New(dir string) (*Store, error) {
 }
 
 // Match returns the template string for the best-matching URL pattern,
-// or empty string if no match (triggering auto-generation).
+// or empty string if no match (triggering auto-generation). An empty
+// template for the longest prefix match falls through to the host-only
+// patterns and the default template.
 func (s *Store) Match(rawURL string) string {
 	if s == nil {
 		return ""
 	}
+	if pattern, ok := prefixPattern(maps.Keys(s.templates), rawURL); ok && s.templates[pattern] != "" {
+		return s.templates[pattern]
+	}
+	if pattern, ok := hostPattern(maps.Keys(s.templates), rawURL); ok {
+		return s.templates[pattern]
+	}
+	return s.defaultTemplate
+}
+
+// MatchPattern returns the URL pattern that best matches rawURL. Patterns
+// and URLs are compared without their scheme. The longest pattern that is a
+// prefix of the URL wins; failing that, a host-only pattern (one without a
+// "/") matches any URL containing it. ok is false when nothing matches.
+func MatchPattern(patterns iter.Seq[string], rawURL string) (pattern string, ok bool) {
+	if pattern, ok := prefixPattern(patterns, rawURL); ok {
+		return pattern, true
+	}
+	return hostPattern(patterns, rawURL)
+}
 
+// prefixPattern returns the longest pattern that is a prefix of rawURL.
+func prefixPattern(patterns iter.Seq[string], rawURL string) (pattern string, ok bool) {
 	compareURL := stripScheme(rawURL)
 
 	// Exact prefix match: find the longest matching pattern.
 	var bestPattern string
-	var bestTemplate string
-	for pattern, tpl := range s.templates {
+	for pattern := range patterns {
 		p := stripScheme(pattern)
-		if strings.HasPrefix(compareURL, p) && len(p) > len(bestPattern) {
-			bestPattern = p
-			bestTemplate = tpl
+		if strings.HasPrefix(compareURL, p) && len(p) > len(stripScheme(bestPattern)) {
+			bestPattern = pattern
 		}
 	}
-	if bestTemplate != "" {
-		return bestTemplate
-	}
+	return bestPattern, bestPattern != ""
+}
+
+// hostPattern returns a host-only pattern contained in rawURL.
+func hostPattern(patterns iter.Seq[string], rawURL string) (pattern string, ok bool) {
+	compareURL := stripScheme(rawURL)
 
 	// Check host-only matches (pattern without path matches any path on that host).
-	for pattern, tpl := range s.templates {
+	for pattern := range patterns {
 		p := stripScheme(pattern)
 		// If pattern has no "/" after the scheme-less form, treat as host prefix.
 		if !strings.Contains(p, "/") && strings.Contains(compareURL, p) {
-			return tpl
+			return pattern, true
 		}
 	}
 
-	return s.defaultTemplate
+	return "", false
 }
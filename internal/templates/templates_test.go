@@ -77,6 +77,24 @@ func TestStore_Match_FallbackToDefault(t *testing.T) {
 	}
 }
 
+func TestStore_Match_EmptyTemplateFallsThrough(t *testing.T) {
+	store := &Store{
+		templates: map[string]string{
+			"http://api.example.com/users": "",
+			"api.example.com":              "host-template",
+		},
+		defaultTemplate: "default-tpl",
+	}
+	if got := store.Match("http://api.example.com/users/1"); got != "host-template" {
+		t.Errorf("expected the host template, got %q", got)
+	}
+
+	delete(store.templates, "api.example.com")
+	if got := store.Match("http://api.example.com/users/1"); got != "default-tpl" {
+		t.Errorf("expected the default template, got %q", got)
+	}
+}
+
 func TestStore_Match_NoMatch(t *testing.T) {
 	store := &Store{
 		templates: map[string]string{
@@ -2,6 +2,7 @@ package tokens
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/pkoukk/tiktoken-go"
 )
@@ -9,6 +10,8 @@ import (
 // Counter counts tokens using a specific TikToken encoding.
 type Counter struct {
 	enc *tiktoken.Tiktoken
+	// lengths caches the length in bytes of each token ID seen.
+	lengths sync.Map
 }
 
 // NewCounter creates a token counter for the given encoding name
@@ -0,0 +1,137 @@
+package tokens
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Window is a token-bounded part of a document, as returned by
+// Counter.Window.
+type Window struct {
+	// Text is the part of the document in the window.
+	Text string
+	// Total is the number of tokens in the whole document.
+	Total int
+	// Next is the token offset of the following window, or -1 when the
+	// window reaches the end of the document.
+	Next int
+}
+
+// Window returns the part of a Markdown document that starts offset tokens
+// in and holds at most maxTokens tokens; maxTokens <= 0 means no limit.
+// The window ends on a block boundary, before a paragraph or heading, so
+// Next offsets fall on one too. A block that does not fit on its own is cut
+// at a line break, or at the token limit when it has none.
+func (c *Counter) Window(text string, offset, maxTokens int) Window {
+	ids := c.enc.Encode(text, nil, nil)
+	lengths := make([]int, len(ids))
+	for i, id := range ids {
+		lengths[i] = c.tokenLen(id)
+	}
+	return window(text, tokenEnds(text, lengths), offset, maxTokens)
+}
+
+// tokenLen returns the length in bytes of token id, decoding each token
+// only once per Counter.
+func (c *Counter) tokenLen(id int) int {
+	if n, ok := c.lengths.Load(id); ok {
+		return n.(int)
+	}
+	n := len(c.enc.Decode([]int{id}))
+	c.lengths.Store(id, n)
+	return n
+}
+
+// tokenEnds returns the byte offsets where tokens of the given lengths end
+// in text. Tokens can split a multibyte character; such an end is moved
+// back to the start of the character, which then falls wholly in the
+// following token, so windows always hold valid UTF-8.
+func tokenEnds(text string, lengths []int) []int {
+	ends := make([]int, len(lengths))
+	pos := 0
+	for i, n := range lengths {
+		pos += n
+		end := min(pos, len(text))
+		for end < len(text) && !utf8.RuneStart(text[end]) {
+			end--
+		}
+		ends[i] = end
+	}
+	return ends
+}
+
+// window implements Counter.Window for a document split into tokens that
+// end at the byte offsets ends.
+func window(text string, ends []int, offset, maxTokens int) Window {
+	total := len(ends)
+	w := Window{Total: total, Next: -1}
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= total {
+		return w
+	}
+	// at returns the byte offset where token i starts.
+	at := func(i int) int {
+		if i == 0 {
+			return 0
+		}
+		return ends[i-1]
+	}
+
+	end := total
+	if maxTokens > 0 && offset+maxTokens < total {
+		end = offset + maxTokens
+		blocks := blockStarts(text)
+		lineBreak := -1
+		for i := end; i > offset; i-- {
+			p := at(i)
+			if blocks[p] {
+				end, lineBreak = i, -1
+				break
+			}
+			if lineBreak < 0 && text[p-1] == '\n' {
+				lineBreak = i
+			}
+		}
+		if lineBreak > 0 {
+			end = lineBreak
+		}
+		w.Next = end
+	}
+	w.Text = strings.TrimSpace(text[at(offset):at(end)])
+	return w
+}
+
+// blockStarts returns the byte offsets of the lines that start a Markdown
+// block: headings and the lines after blank lines and headings. Lines
+// inside fenced code blocks are never block starts.
+func blockStarts(text string) map[int]bool {
+	starts := map[int]bool{}
+	fence := ""
+	blank, heading := true, false
+	pos := 0
+	for _, line := range strings.SplitAfter(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence != "":
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				fence = ""
+			}
+		case trimmed == "":
+		default:
+			if blank || heading || strings.HasPrefix(trimmed, "#") {
+				starts[pos] = true
+			}
+			for _, f := range []string{"```", "~~~"} {
+				if strings.HasPrefix(trimmed, f) {
+					fence = trimmed[:len(trimmed)-len(strings.TrimLeft(trimmed, f[:1]))]
+				}
+			}
+		}
+		blank = trimmed == ""
+		heading = fence == "" && strings.HasPrefix(trimmed, "#")
+		pos += len(line)
+	}
+	return starts
+}
@@ -0,0 +1,160 @@
+package tokens
+
+import (
+	"strings"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+)
+
+// wordEnds splits text into tokens of one word and the whitespace after
+// it, returning their end offsets.
+func wordEnds(text string) []int {
+	var ends []int
+	inSpace := false
+	for i, r := range text {
+		space := unicode.IsSpace(r)
+		if i > 0 && inSpace && !space {
+			ends = append(ends, i)
+		}
+		inSpace = space
+	}
+	if text != "" {
+		ends = append(ends, len(text))
+	}
+	return ends
+}
+
+func TestWindow(t *testing.T) {
+	doc := "# Guide\n\nOne two three.\n\nFour five six seven.\n\n## Next\nEight nine.\n\n```\ncode line\n\nmore code\n```"
+	ends := wordEnds(doc)
+
+	tests := []struct {
+		name   string
+		offset int
+		max    int
+		want   string
+		next   int
+	}{
+		{name: "whole document", offset: 0, max: 0, want: doc, next: -1},
+		{name: "first block fits", offset: 0, max: 3, want: "# Guide", next: 2},
+		{name: "two blocks", offset: 0, max: 6, want: "# Guide\n\nOne two three.", next: 5},
+		{name: "heading boundary", offset: 5, max: 4, want: "Four five six seven.", next: 9},
+		{name: "paragraph after heading", offset: 9, max: 3, want: "## Next", next: 11},
+		{name: "next block too long", offset: 11, max: 4, want: "Eight nine.", next: 13},
+		{name: "code block cut at a line break", offset: 13, max: 4, want: "```\ncode line", next: 16},
+		{name: "last window", offset: 13, max: 50, want: "```\ncode line\n\nmore code\n```", next: -1},
+		{name: "past the end", offset: 99, max: 5, want: "", next: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := window(doc, ends, tt.offset, tt.max)
+			if w.Text != tt.want || w.Next != tt.next || w.Total != len(ends) {
+				t.Errorf("window(%d, %d) = %q, next %d, total %d; want %q, next %d, total %d",
+					tt.offset, tt.max, w.Text, w.Next, w.Total, tt.want, tt.next, len(ends))
+			}
+		})
+	}
+}
+
+func TestWindow_LongBlock(t *testing.T) {
+	doc := "alpha beta\ngamma delta\nepsilon zeta eta theta"
+	ends := wordEnds(doc)
+
+	// A block too long for the window is cut at a line break...
+	w := window(doc, ends, 0, 5)
+	if w.Text != "alpha beta\ngamma delta" || w.Next != 4 {
+		t.Errorf("got %q, next %d", w.Text, w.Next)
+	}
+	// ...or at the token limit when it has none.
+	w = window(doc, ends, 4, 2)
+	if w.Text != "epsilon zeta" || w.Next != 6 {
+		t.Errorf("got %q, next %d", w.Text, w.Next)
+	}
+}
+
+func TestWindow_PagesThroughDocument(t *testing.T) {
+	var b strings.Builder
+	for i := range 40 {
+		if i%7 == 0 {
+			b.WriteString("## Section\n\n")
+		}
+		b.WriteString("Paragraph with a few words in it.\n\n")
+	}
+	doc := strings.TrimSpace(b.String())
+	ends := wordEnds(doc)
+
+	var pages []string
+	for offset := 0; offset >= 0; {
+		w := window(doc, ends, offset, 20)
+		if w.Next >= 0 && w.Next <= offset {
+			t.Fatalf("window at %d did not advance: next %d", offset, w.Next)
+		}
+		pages = append(pages, w.Text)
+		offset = w.Next
+	}
+	if got := strings.Join(pages, "\n\n"); got != doc {
+		t.Errorf("pages do not add up to the document:\n%s", got)
+	}
+}
+
+func TestCounter_Window(t *testing.T) {
+	c := newTestCounter(t)
+
+	doc := "# Title\n\nFirst paragraph of the document.\n\nSecond paragraph of the document."
+	w := c.Window(doc, 0, c.Count("# Title\n\nFirst paragraph of the document.\n\n"))
+	if w.Text != "# Title\n\nFirst paragraph of the document." {
+		t.Errorf("first window = %q", w.Text)
+	}
+	if w.Total != c.Count(doc) {
+		t.Errorf("Total = %d, want %d", w.Total, c.Count(doc))
+	}
+	w = c.Window(doc, w.Next, 0)
+	if w.Text != "Second paragraph of the document." || w.Next != -1 {
+		t.Errorf("second window = %q, next %d", w.Text, w.Next)
+	}
+}
+
+func TestTokenEnds_SplitRunes(t *testing.T) {
+	// Two-byte tokens split the three-byte CJK characters and the
+	// four-byte emoji, and there is no line break to cut at.
+	doc := "日本語のテキスト🙂と絵文字🎉を含む文章"
+	lengths := make([]int, (len(doc)+1)/2)
+	for i := range lengths {
+		lengths[i] = 2
+	}
+	ends := tokenEnds(doc, lengths)
+
+	for maxTokens := 1; maxTokens <= 5; maxTokens++ {
+		var b strings.Builder
+		for offset := 0; offset >= 0; {
+			w := window(doc, ends, offset, maxTokens)
+			if !utf8.ValidString(w.Text) {
+				t.Fatalf("window(%d, %d) = %q is not valid UTF-8", offset, maxTokens, w.Text)
+			}
+			b.WriteString(w.Text)
+			offset = w.Next
+		}
+		if b.String() != doc {
+			t.Errorf("windows of %d tokens add up to %q, want %q", maxTokens, b.String(), doc)
+		}
+	}
+}
+
+func TestCounter_Window_Multibyte(t *testing.T) {
+	c := newTestCounter(t)
+
+	doc := strings.Repeat("日本語のテキスト🙂と絵文字🎉", 20)
+	var b strings.Builder
+	for offset := 0; offset >= 0; {
+		w := c.Window(doc, offset, 7)
+		if !utf8.ValidString(w.Text) {
+			t.Fatalf("window at %d = %q is not valid UTF-8", offset, w.Text)
+		}
+		b.WriteString(w.Text)
+		offset = w.Next
+	}
+	if b.String() != doc {
+		t.Errorf("windows add up to %q, want %q", b.String(), doc)
+	}
+}